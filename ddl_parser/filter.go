@@ -98,8 +98,13 @@ type acceptDDLType struct {
 	ddlType map[string]struct{}
 }
 
+// Apply 同时匹配细分前的类型，如 ALTER TABLE 匹配 ADD PARTITION，DROP TABLE 匹配 DROP VIEW
 func (t *acceptDDLType) Apply(stmt Statement) bool {
-	_, ok := t.ddlType[stmt.DDLType().String()]
+	ddlType := stmt.DDLType()
+	if _, ok := t.ddlType[ddlType.String()]; ok {
+		return true
+	}
+	_, ok := t.ddlType[ddlType.Base().String()]
 	return ok
 }
 
@@ -323,3 +328,44 @@ func (o *ignoreTableOption) Apply(s Statement) bool {
 //	}
 //	return false
 //}
+
+// MatchDatabaseTable 库名按 glob 匹配，表名命中 acceptTables 且不命中 ignoreTables 即通过，库级 DDL 只匹配库名
+func MatchDatabaseTable(databasePattern string, acceptTables, ignoreTables []string) FilterOption {
+	return &matchDatabaseTableOption{
+		databasePattern: databasePattern,
+		acceptTables:    acceptTables,
+		ignoreTables:    ignoreTables,
+	}
+}
+
+type matchDatabaseTableOption struct {
+	databasePattern string
+	acceptTables    []string
+	ignoreTables    []string
+}
+
+func (o *matchDatabaseTableOption) matchTable(table string) bool {
+	if match.MatchRegex(table, o.ignoreTables) {
+		return false
+	}
+	return len(o.acceptTables) == 0 || match.MatchRegex(table, o.acceptTables)
+}
+
+func (o *matchDatabaseTableOption) Apply(s Statement) bool {
+	if ds, ok := s.(renameTableStatement); ok {
+		oldDatabase, oldTable := ds.OldTable()
+		newDatabase, newTable := ds.NewTable()
+		if !match.Glob(o.databasePattern, oldDatabase) || !match.Glob(o.databasePattern, newDatabase) {
+			return false
+		}
+		return o.matchTable(oldTable) || o.matchTable(newTable)
+	}
+	if ds, ok := s.(tableStatement); ok {
+		return match.Glob(o.databasePattern, ds.Database()) && o.matchTable(ds.Table())
+	}
+	if ds, ok := s.(databaseStatement); ok {
+		return match.Glob(o.databasePattern, ds.Database())
+	}
+	log.Warnf("unable to determine if Database pattern %v is acceptable ddl type:%v", o.databasePattern, s.DDLType())
+	return false
+}
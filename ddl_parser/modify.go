@@ -17,6 +17,13 @@ const (
 )
 
 func Modify(stmt Statement, opts ...ModifyOption) {
+	for _, opt := range sortByPriority(opts) {
+		opt.Apply(stmt)
+	}
+	return
+}
+
+func sortByPriority(opts []ModifyOption) []ModifyOption {
 	highestPriorityList, firstPriorityList, secondPriorityList, lowestPriorityList := []ModifyOption{}, []ModifyOption{}, []ModifyOption{}, []ModifyOption{}
 	for _, opt := range opts {
 		switch opt.Priority() {
@@ -30,20 +37,11 @@ func Modify(stmt Statement, opts ...ModifyOption) {
 			lowestPriorityList = append(lowestPriorityList, opt)
 		}
 	}
-	for _, opt := range highestPriorityList {
-		opt.Apply(stmt)
-	}
-	for _, opt := range firstPriorityList {
-		opt.Apply(stmt)
-	}
-	for _, opt := range secondPriorityList {
-		opt.Apply(stmt)
-	}
-	for _, opt := range lowestPriorityList {
-		opt.Apply(stmt)
-	}
-
-	return
+	list := make([]ModifyOption, 0, len(opts))
+	list = append(list, highestPriorityList...)
+	list = append(list, firstPriorityList...)
+	list = append(list, secondPriorityList...)
+	return append(list, lowestPriorityList...)
 }
 
 func WithDatabaseRename(old, new string) ModifyOption {
@@ -86,9 +84,22 @@ func (o *databaseRenameOption) Apply(s Statement) {
 			}
 		}
 	}
+
+	if rts, ok := s.(referTableStatement); ok {
+		database, table := rts.ReferTable()
+		if database == o.old {
+			rts.ReplaceReferTable(o.new, table)
+		}
+	}
 	return
 }
 
+func (o *databaseRenameOption) applyRowMeta(meta *RowMeta) {
+	if meta.Database == o.old {
+		meta.Database = o.new
+	}
+}
+
 func WithTableRename(database string, old, new string) ModifyOption {
 	return &tableRenameOption{
 		database: database,
@@ -134,9 +145,22 @@ func (o *tableRenameOption) Apply(s Statement) {
 			rts.ReplaceNewTable(database, o.new)
 		}
 	}
+
+	if rts, ok := s.(referTableStatement); ok {
+		database, table := rts.ReferTable()
+		if database == o.database && table == o.old {
+			rts.ReplaceReferTable(database, o.new)
+		}
+	}
 	return
 }
 
+func (o *tableRenameOption) applyRowMeta(meta *RowMeta) {
+	if meta.Database == o.database && meta.Table == o.old {
+		meta.Table = o.new
+	}
+}
+
 func WithColumnRename(database, table, oldColumn, newColumn string) ModifyOption {
 	return &columnRenameOption{
 		database:  database,
@@ -182,6 +206,14 @@ func (o *columnRenameOption) Apply(s Statement) {
 	return
 }
 
+func (o *columnRenameOption) ApplyRow(meta RowMeta, data, old map[string]any) {
+	if meta.Database != o.database || meta.Table != o.table {
+		return
+	}
+	renameRowColumn(data, o.oldColumn, o.newColumn)
+	renameRowColumn(old, o.oldColumn, o.newColumn)
+}
+
 func RemoveColumn(database, table, column string) ModifyOption {
 	return &columnRemoveOption{
 		database: database,
@@ -228,3 +260,126 @@ func (o *columnRemoveOption) Apply(s Statement) {
 
 	return
 }
+
+func (o *columnRemoveOption) ApplyRow(meta RowMeta, data, old map[string]any) {
+	if meta.Database != o.database || meta.Table != o.table {
+		return
+	}
+	delete(data, o.column)
+	delete(old, o.column)
+}
+
+// WithColumnType 修改列类型，如 int 放宽为 bigint；库表列均为源端名称，行数据的值按新类型转换，见 convertColumnValue
+func WithColumnType(database, table, column, tp string) ModifyOption {
+	return &columnTypeOption{
+		database: database,
+		table:    table,
+		column:   column,
+		tp:       tp,
+	}
+}
+
+type columnTypeOption struct {
+	database string
+	table    string
+	column   string
+	tp       string
+}
+
+func (o *columnTypeOption) Priority() int {
+	return HighestPriority
+}
+
+func (o *columnTypeOption) Apply(s Statement) {
+	if ds, ok := s.(columnDefinitionStatement); ok {
+		if ds.Database() == o.database && ds.Table() == o.table {
+			ds.ReplaceColumnType(o.column, o.tp)
+		}
+	}
+}
+
+func (o *columnTypeOption) ApplyRow(meta RowMeta, data, old map[string]any) {
+	if meta.Database != o.database || meta.Table != o.table {
+		return
+	}
+	convertRowColumn(meta, data, o.column, o.tp)
+	convertRowColumn(meta, old, o.column, o.tp)
+}
+
+// WithColumnDefault 设置列的默认值，行数据中没有该列时写入默认值
+func WithColumnDefault(database, table, column string, value any) ModifyOption {
+	return &columnDefaultOption{
+		database: database,
+		table:    table,
+		column:   column,
+		value:    value,
+	}
+}
+
+type columnDefaultOption struct {
+	database string
+	table    string
+	column   string
+	value    any
+}
+
+func (o *columnDefaultOption) Priority() int {
+	return HighestPriority
+}
+
+func (o *columnDefaultOption) Apply(s Statement) {
+	if ds, ok := s.(columnDefinitionStatement); ok {
+		if ds.Database() == o.database && ds.Table() == o.table {
+			ds.ReplaceColumnDefault(o.column, o.value)
+		}
+	}
+}
+
+func (o *columnDefaultOption) ApplyRow(meta RowMeta, data, _ map[string]any) {
+	if data == nil || meta.Database != o.database || meta.Table != o.table {
+		return
+	}
+	if _, ok := data[o.column]; !ok {
+		data[o.column] = o.value
+	}
+}
+
+// WithAddColumn 建表时追加列，行数据中该列的值由 value 根据行的来源生成，value 为 nil 时使用列默认值
+func WithAddColumn(database, table string, column ColumnDefinition, value ColumnValue) ModifyOption {
+	return &addColumnOption{
+		database: database,
+		table:    table,
+		column:   column,
+		value:    value,
+	}
+}
+
+type addColumnOption struct {
+	database string
+	table    string
+	column   ColumnDefinition
+	value    ColumnValue
+}
+
+func (o *addColumnOption) Priority() int {
+	return HighestPriority
+}
+
+func (o *addColumnOption) Apply(s Statement) {
+	if ds, ok := s.(addColumnStatement); ok {
+		if ds.Database() == o.database && ds.Table() == o.table {
+			ds.AddColumn(o.column)
+		}
+	}
+}
+
+func (o *addColumnOption) ApplyRow(meta RowMeta, data, _ map[string]any) {
+	if data == nil || meta.Database != o.database || meta.Table != o.table {
+		return
+	}
+	if o.value == nil {
+		data[o.column.Name] = o.column.Default
+		return
+	}
+	data[o.column.Name] = o.value(meta)
+}
@@ -0,0 +1,375 @@
+package ddl_parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/xuenqlve/common/errors"
+	"github.com/xuenqlve/common/transform"
+)
+
+// RouterConfig 声明式的库、表、列及 topic 路由规则，按顺序匹配，第一个命中的规则生效：
+//
+//	[[tables]]
+//	regex = 'shard_(\d+)\.orders_.*'
+//	target = "all.orders"
+//	merge = true
+//	[tables.columns]
+//	order_no = "no"
+//
+//	[[topics]]
+//	pattern = "binlog_*"
+//	target = "cdc_$1"
+type RouterConfig struct {
+	// Databases 匹配库名，target 为目标库名；表没有命中 Tables 规则时使用
+	Databases []RouteRule `mapstructure:"databases" toml:"databases" json:"databases" yaml:"databases"`
+	// Tables 匹配 database.table（MongoDB 为 namespace），target 为 database.table
+	Tables []RouteRule `mapstructure:"tables" toml:"tables" json:"tables" yaml:"tables"`
+	// Topics 匹配 kafka topic
+	Topics []RouteRule `mapstructure:"topics" toml:"topics" json:"topics" yaml:"topics"`
+}
+
+// RouteRule pattern 为 glob，每个 * 是一个捕获组；regex 为完整匹配的正则，二者选一。
+// target 中使用 $1、${1} 引用捕获组，$1 后紧跟字母、数字或下划线时也只引用第 1 组
+type RouteRule struct {
+	Pattern string `mapstructure:"pattern" toml:"pattern" json:"pattern" yaml:"pattern"`
+	Regex   string `mapstructure:"regex" toml:"regex" json:"regex" yaml:"regex"`
+	Target  string `mapstructure:"target" toml:"target" json:"target" yaml:"target"`
+	// Columns 列重命名，只用于 Tables
+	Columns map[string]string `mapstructure:"columns" toml:"columns" json:"columns" yaml:"columns"`
+	// Merge 允许多个源路由到同一个目标
+	Merge bool `mapstructure:"merge" toml:"merge" json:"merge" yaml:"merge"`
+}
+
+// LoadRouterConfig 通过 transform.ConfigFromFile 读取 toml、json、yaml 配置
+func LoadRouterConfig(path string) (*RouterConfig, error) {
+	data, err := transform.ConfigFromFile(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	content, err := json.Marshal(data)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	cfg := &RouterConfig{}
+	if err = json.Unmarshal(content, cfg); err != nil {
+		return nil, errors.Annotatef(err, "router config %s", path)
+	}
+	return cfg, nil
+}
+
+type routeRule struct {
+	RouteRule
+	index  int
+	regex  *regexp.Regexp
+	target string
+}
+
+// groupReference target 中的 $$ 及 $n 引用
+var groupReference = regexp.MustCompile(`\$\$|\$[0-9]+`)
+
+// expandTarget regexp.Expand 把 $1_x 当作名为 1_x 的组，将 $n 改写为 ${n}
+func expandTarget(target string) string {
+	return groupReference.ReplaceAllStringFunc(target, func(ref string) string {
+		if ref == "$$" {
+			return ref
+		}
+		return "${" + ref[1:] + "}"
+	})
+}
+
+func newRouteRule(kind string, index int, rule RouteRule) (*routeRule, error) {
+	if rule.Target == "" {
+		return nil, fmt.Errorf("router %s rule %d target is empty", kind, index)
+	}
+	expr := rule.Regex
+	switch {
+	case rule.Pattern != "" && rule.Regex != "":
+		return nil, fmt.Errorf("router %s rule %d has both pattern and regex", kind, index)
+	case rule.Pattern != "":
+		parts := strings.Split(rule.Pattern, "*")
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		expr = strings.Join(parts, "(.*)")
+	case rule.Regex == "":
+		return nil, fmt.Errorf("router %s rule %d needs pattern or regex", kind, index)
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, errors.Annotatef(err, "router %s rule %d", kind, index)
+	}
+	return &routeRule{RouteRule: rule, index: index, regex: re, target: expandTarget(rule.Target)}, nil
+}
+
+func (r *routeRule) route(name string) (string, bool) {
+	match := r.regex.FindStringSubmatchIndex(name)
+	if match == nil {
+		return "", false
+	}
+	return string(r.regex.ExpandString(nil, r.target, name, match)), true
+}
+
+// Router 按 RouterConfig 改写库表名、列名及 topic。
+// 作为 ModifyOption 用于 DDL，作为 RowModifyOption 用于行数据的列重命名；
+// 与 WithTableRename 等选项同时使用时，DDL 与行数据中路由匹配的都是这些选项改写后的名称
+type Router struct {
+	databases []*routeRule
+	tables    []*routeRule
+	topics    []*routeRule
+}
+
+func NewRouter(cfg RouterConfig) (*Router, error) {
+	r := &Router{}
+	var err error
+	if r.databases, err = newRouteRules("databases", cfg.Databases); err != nil {
+		return nil, err
+	}
+	if r.tables, err = newRouteRules("tables", cfg.Tables); err != nil {
+		return nil, err
+	}
+	if r.topics, err = newRouteRules("topics", cfg.Topics); err != nil {
+		return nil, err
+	}
+	targets := map[string]*routeRule{}
+	for _, rule := range r.tables {
+		if !strings.Contains(rule.Target, ".") {
+			return nil, fmt.Errorf("router tables rule %d target %s must be database.table", rule.index, rule.Target)
+		}
+		// 固定目标的多个规则列映射必须一致
+		if strings.Contains(rule.Target, "$") {
+			continue
+		}
+		if exist, ok := targets[rule.Target]; ok && !sameColumns(exist.Columns, rule.Columns) {
+			return nil, fmt.Errorf("router tables rule %d and %d merge into %s with different columns", exist.index, rule.index, rule.Target)
+		}
+		targets[rule.Target] = rule
+	}
+	return r, nil
+}
+
+// NewRouterFromFile LoadRouterConfig 后 NewRouter
+func NewRouterFromFile(path string) (*Router, error) {
+	cfg, err := LoadRouterConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewRouter(*cfg)
+}
+
+func newRouteRules(kind string, rules []RouteRule) ([]*routeRule, error) {
+	list := make([]*routeRule, 0, len(rules))
+	for i, rule := range rules {
+		r, err := newRouteRule(kind, i, rule)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, nil
+}
+
+func (r *Router) matchTable(database, table string) (*routeRule, Table) {
+	for _, rule := range r.tables {
+		if target, ok := rule.route(database + "." + table); ok {
+			targetDatabase, targetTable, _ := strings.Cut(target, ".")
+			return rule, Table{Database: targetDatabase, Table: targetTable}
+		}
+	}
+	rule, target := r.matchDatabase(database)
+	return rule, Table{Database: target, Table: table}
+}
+
+func (r *Router) matchDatabase(database string) (*routeRule, string) {
+	for _, rule := range r.databases {
+		if target, ok := rule.route(database); ok {
+			return rule, target
+		}
+	}
+	return nil, database
+}
+
+// RouteDatabase 返回库路由后的名称，没有命中时原样返回
+func (r *Router) RouteDatabase(database string) string {
+	_, target := r.matchDatabase(database)
+	return target
+}
+
+// RouteTable 返回表路由后的库表名
+func (r *Router) RouteTable(database, table string) (string, string) {
+	_, target := r.matchTable(database, table)
+	return target.Database, target.Table
+}
+
+// RouteColumn 返回列路由后的名称
+func (r *Router) RouteColumn(database, table, column string) string {
+	rule, _ := r.matchTable(database, table)
+	if rule != nil {
+		if target, ok := rule.Columns[column]; ok {
+			return target
+		}
+	}
+	return column
+}
+
+// RouteNamespace MongoDB namespace database.collection 按 Tables 规则路由
+func (r *Router) RouteNamespace(ns string) string {
+	database, collection, ok := strings.Cut(ns, ".")
+	if !ok {
+		return r.RouteDatabase(ns)
+	}
+	database, collection = r.RouteTable(database, collection)
+	return database + "." + collection
+}
+
+// RouteTopic 返回 kafka topic 路由后的名称
+func (r *Router) RouteTopic(topic string) string {
+	for _, rule := range r.topics {
+		if target, ok := rule.route(topic); ok {
+			return target
+		}
+	}
+	return topic
+}
+
+// CheckTables 启动时检查源表的路由：多个表路由到同一目标时规则必须开启 merge，且列映射一致
+func (r *Router) CheckTables(tables []Table) error {
+	routes := map[string][]routeSource{}
+	for _, table := range tables {
+		rule, target := r.matchTable(table.Database, table.Table)
+		key := target.Database + "." + target.Table
+		routes[key] = append(routes[key], routeSource{name: table.Database + "." + table.Table, rule: rule})
+	}
+	return checkMerge("table", routes)
+}
+
+// CheckTopics 同 CheckTables，检查 topic 的多对一路由
+func (r *Router) CheckTopics(topics []string) error {
+	routes := map[string][]routeSource{}
+	for _, topic := range topics {
+		var matched *routeRule
+		target := topic
+		for _, rule := range r.topics {
+			if t, ok := rule.route(topic); ok {
+				matched, target = rule, t
+				break
+			}
+		}
+		routes[target] = append(routes[target], routeSource{name: topic, rule: matched})
+	}
+	return checkMerge("topic", routes)
+}
+
+type routeSource struct {
+	name string
+	rule *routeRule
+}
+
+func checkMerge(kind string, routes map[string][]routeSource) error {
+	targets := make([]string, 0, len(routes))
+	for target := range routes {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	for _, target := range targets {
+		sources := routes[target]
+		if len(sources) < 2 {
+			continue
+		}
+		for _, source := range sources {
+			if source.rule == nil || !source.rule.Merge {
+				return fmt.Errorf("router %s %s merge into %s, set merge = true on the rule to allow it", kind, source.name, target)
+			}
+			if !sameColumns(sources[0].rule.Columns, source.rule.Columns) {
+				return fmt.Errorf("router %s %s and %s merge into %s with different columns", kind, sources[0].name, source.name, target)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Router) Priority() int {
+	return LowestPriority
+}
+
+func (r *Router) Apply(s Statement) {
+	// 列按源表匹配，先于表重命名
+	if ts, ok := s.(tableStatement); ok {
+		if rule, _ := r.matchTable(ts.Database(), ts.Table()); rule != nil {
+			for old, new := range rule.Columns {
+				(&columnRenameOption{database: ts.Database(), table: ts.Table(), oldColumn: old, newColumn: new}).Apply(s)
+			}
+		}
+	}
+
+	if ads, ok := s.(alterTableStatement); ok && ads.AlterType() == string(RenameTable) {
+		database, table := ads.RenameNewTable()
+		if target := r.routeTable(database, table); target != (Table{Database: database, Table: table}) {
+			ads.ReplaceNewTable(target.Database, target.Table)
+		}
+	}
+	if rts, ok := s.(referTableStatement); ok {
+		database, table := rts.ReferTable()
+		if target := r.routeTable(database, table); target != (Table{Database: database, Table: table}) {
+			rts.ReplaceReferTable(target.Database, target.Table)
+		}
+	}
+	if rts, ok := s.(renameTableStatement); ok {
+		database, table := rts.OldTable()
+		target := r.routeTable(database, table)
+		rts.ReplaceOldTable(target.Database, target.Table)
+		database, table = rts.NewTable()
+		target = r.routeTable(database, table)
+		rts.ReplaceNewTable(target.Database, target.Table)
+		return
+	}
+
+	if ts, ok := s.(tableStatement); ok {
+		database, table := ts.Database(), ts.Table()
+		target := r.routeTable(database, table)
+		if target.Table != table {
+			ts.ReplaceTable(table, target.Table)
+		}
+		if target.Database != database {
+			ts.ReplaceDatabase(database, target.Database)
+		}
+		return
+	}
+	if ds, ok := s.(databaseStatement); ok {
+		database := ds.Database()
+		if target := r.RouteDatabase(database); target != database {
+			ds.ReplaceDatabase(database, target)
+		}
+	}
+}
+
+func (r *Router) routeTable(database, table string) Table {
+	_, target := r.matchTable(database, table)
+	return target
+}
+
+func (r *Router) ApplyRow(meta RowMeta, data, old map[string]any) {
+	rule, _ := r.matchTable(meta.Database, meta.Table)
+	if rule == nil {
+		return
+	}
+	for oldColumn, newColumn := range rule.Columns {
+		renameRowColumn(data, oldColumn, newColumn)
+		renameRowColumn(old, oldColumn, newColumn)
+	}
+}
+
+func sameColumns(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
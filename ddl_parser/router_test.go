@@ -0,0 +1,96 @@
+package ddl_parser
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	path := t.TempDir() + "/router.toml"
+	config := `
+[[tables]]
+regex = 'shard_(\d+)\.orders_.*'
+target = "all.orders"
+merge = true
+[tables.columns]
+order_no = "no"
+
+[[databases]]
+pattern = "shard_*"
+target = "db_$1"
+
+[[topics]]
+pattern = "binlog_*"
+target = "cdc_${1}"
+`
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	router, err := NewRouterFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = router.CheckTables([]Table{{Database: "shard_1", Table: "orders_1"}, {Database: "shard_2", Table: "orders_2"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = router.CheckTables([]Table{{Database: "shard_1", Table: "users"}, {Database: "db_1", Table: "users"}}); err == nil {
+		t.Fatal("expected merge conflict")
+	}
+	if database, table := router.RouteTable("shard_1", "orders_9"); database != "all" || table != "orders" {
+		t.Fatalf("table: %s.%s", database, table)
+	}
+	if column := router.RouteColumn("shard_1", "orders_9", "order_no"); column != "no" {
+		t.Fatalf("column: %s", column)
+	}
+	if ns := router.RouteNamespace("shard_3.users"); ns != "db_3.users" {
+		t.Fatalf("namespace: %s", ns)
+	}
+	if topic := router.RouteTopic("binlog_orders"); topic != "cdc_orders" {
+		t.Fatalf("topic: %s", topic)
+	}
+
+	data := map[string]any{"order_no": 1}
+	ModifyRow(RowMeta{Database: "shard_1", Table: "orders_1"}, data, nil, router)
+	if data["no"] != 1 || len(data) != 1 {
+		t.Fatalf("data: %v", data)
+	}
+
+	// 行数据与 DDL 一样按表重命名后的名称匹配路由
+	data = map[string]any{"order_no": 1}
+	ModifyRow(RowMeta{Database: "shard_1", Table: "legacy"}, data, nil, WithTableRename("shard_1", "legacy", "orders_legacy"), router)
+	if data["no"] != 1 || len(data) != 1 {
+		t.Fatalf("renamed table data: %v", data)
+	}
+}
+
+func TestRouterRules(t *testing.T) {
+	if _, err := NewRouter(RouterConfig{Tables: []RouteRule{{Pattern: "db.*", Regex: "db\\..*", Target: "x.y"}}}); err == nil {
+		t.Fatal("expected pattern and regex conflict")
+	}
+	if _, err := NewRouter(RouterConfig{Tables: []RouteRule{{Pattern: "db.*", Target: "x"}}}); err == nil {
+		t.Fatal("expected database.table target")
+	}
+	_, err := NewRouter(RouterConfig{Tables: []RouteRule{
+		{Pattern: "a.*", Target: "x.y", Columns: map[string]string{"a": "b"}},
+		{Pattern: "b.*", Target: "x.y"},
+	}})
+	if err == nil {
+		t.Fatal("expected different columns conflict")
+	}
+}
+
+func TestRouteTopicGroupReference(t *testing.T) {
+	router, err := NewRouter(RouterConfig{Topics: []RouteRule{
+		{Pattern: "binlog_*", Target: "cdc_$1_v2"},
+		{Regex: `(?P<name>.*)\.events`, Target: "${name}_$$"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topic := router.RouteTopic("binlog_orders"); topic != "cdc_orders_v2" {
+		t.Fatalf("route topic: %s", topic)
+	}
+	if topic := router.RouteTopic("app.events"); topic != "app_$" {
+		t.Fatalf("route named topic: %s", topic)
+	}
+}
@@ -0,0 +1,143 @@
+package ddl_parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuenqlve/common/log"
+	"github.com/xuenqlve/common/schema_store"
+	"github.com/xuenqlve/common/transform"
+)
+
+// RowMeta 行数据的来源，库表为源端名称；ModifyRow 中库表重命名之后的选项看到的是重命名后的名称
+type RowMeta struct {
+	Database string
+	Table    string
+	CommitTs time.Time
+	OpType   schema_store.DML
+}
+
+// RowModifyOption 同时作用于行数据的 ModifyOption，data 为变更后镜像，old 为变更前镜像，均可能为 nil
+type RowModifyOption interface {
+	ModifyOption
+	ApplyRow(meta RowMeta, data, old map[string]any)
+}
+
+// ModifyRow 按 Modify 相同的优先级把选项应用到行数据，保证 DDL 与行数据的改写一致：
+// 库表重命名改写 meta，之后的选项与 DDL 一样按重命名后的库表匹配；其他没有实现 RowModifyOption 的选项忽略
+func ModifyRow(meta RowMeta, data, old map[string]any, opts ...ModifyOption) {
+	for _, opt := range sortByPriority(opts) {
+		if mo, ok := opt.(rowMetaModifyOption); ok {
+			mo.applyRowMeta(&meta)
+		}
+		if ro, ok := opt.(RowModifyOption); ok {
+			ro.ApplyRow(meta, data, old)
+		}
+	}
+}
+
+// rowMetaModifyOption 改写行数据来源库表的选项
+type rowMetaModifyOption interface {
+	applyRowMeta(meta *RowMeta)
+}
+
+// ColumnValue 根据行的来源生成派生列的值
+type ColumnValue func(meta RowMeta) any
+
+// ConstantValue 常量列
+func ConstantValue(value any) ColumnValue {
+	return func(RowMeta) any {
+		return value
+	}
+}
+
+// SourceDatabaseValue 源库名
+func SourceDatabaseValue() ColumnValue {
+	return func(meta RowMeta) any {
+		return meta.Database
+	}
+}
+
+// SourceTableValue 源表名
+func SourceTableValue() ColumnValue {
+	return func(meta RowMeta) any {
+		return meta.Table
+	}
+}
+
+// CommitTsValue 源端提交时间
+func CommitTsValue() ColumnValue {
+	return func(meta RowMeta) any {
+		return meta.CommitTs
+	}
+}
+
+// OpTypeValue 变更类型 insert、update、delete
+func OpTypeValue() ColumnValue {
+	return func(meta RowMeta) any {
+		return string(meta.OpType)
+	}
+}
+
+func renameRowColumn(row map[string]any, old, new string) {
+	if value, ok := row[old]; ok {
+		delete(row, old)
+		row[new] = value
+	}
+}
+
+func convertRowColumn(meta RowMeta, row map[string]any, column, tp string) {
+	value, ok := row[column]
+	if !ok || value == nil {
+		return
+	}
+	converted, err := convertColumnValue(value, tp)
+	if err != nil {
+		log.Warnf("%s.%s column %s value %v convert to %s err: %v", meta.Database, meta.Table, column, value, tp, err)
+		return
+	}
+	row[column] = converted
+}
+
+// convertColumnValue 按列类型转换值：整数为 int64（unsigned 为 uint64），float、double 为 float64，
+// decimal 及字符串类型为 string 以保留精度，其他类型原样返回
+func convertColumnValue(value any, tp string) (any, error) {
+	tp = strings.ToLower(strings.TrimSpace(tp))
+	base := tp
+	if i := strings.IndexAny(base, "( "); i >= 0 {
+		base = base[:i]
+	}
+	switch base {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint":
+		if !strings.Contains(tp, "unsigned") {
+			return transform.ToInt(value)
+		}
+		if v, ok := value.(uint64); ok {
+			return v, nil
+		}
+		v, err := transform.ToInt(value)
+		if err != nil {
+			return nil, err
+		}
+		if v < 0 {
+			return nil, fmt.Errorf("negative value %d for unsigned column", v)
+		}
+		return uint64(v), nil
+	case "float", "double", "real":
+		return transform.ToFloat64(value)
+	case "decimal", "numeric":
+		// 避免浮点数转为科学计数法
+		switch v := value.(type) {
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case float32:
+			return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+		}
+		return transform.ToString(value)
+	case "char", "varchar", "tinytext", "text", "mediumtext", "longtext":
+		return transform.ToString(value)
+	}
+	return value, nil
+}
@@ -0,0 +1,44 @@
+package ddl_parser
+
+import "testing"
+
+func TestConvertColumnValue(t *testing.T) {
+	cases := []struct {
+		value    any
+		tp       string
+		expected any
+	}{
+		{int32(1), "bigint", int64(1)},
+		{"42", "int(11)", int64(42)},
+		{uint64(1 << 63), "bigint unsigned", uint64(1 << 63)},
+		{int64(7), "int unsigned", uint64(7)},
+		{int64(3), "double", float64(3)},
+		{1e21, "decimal(30,2)", "1000000000000000000000"},
+		{12, "varchar(32)", "12"},
+		{[]byte("x"), "blob", []byte("x")},
+	}
+	for _, c := range cases {
+		v, err := convertColumnValue(c.value, c.tp)
+		if err != nil {
+			t.Fatalf("%v %s: %v", c.value, c.tp, err)
+		}
+		if b, ok := c.expected.([]byte); ok {
+			if string(v.([]byte)) != string(b) {
+				t.Fatalf("%v %s: %v", c.value, c.tp, v)
+			}
+			continue
+		}
+		if v != c.expected {
+			t.Fatalf("%v %s: %v(%T)", c.value, c.tp, v, v)
+		}
+	}
+	if _, err := convertColumnValue(int64(-1), "int unsigned"); err == nil {
+		t.Fatal("expected negative unsigned error")
+	}
+
+	data := map[string]any{"id": "5", "name": "a"}
+	ModifyRow(RowMeta{Database: "db", Table: "t"}, data, nil, WithColumnType("db", "t", "id", "bigint"))
+	if data["id"] != int64(5) || data["name"] != "a" {
+		t.Fatalf("data: %v", data)
+	}
+}
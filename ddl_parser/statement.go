@@ -39,8 +39,19 @@ const (
 	RemoveTableColumn
 	RemoveTableConstraintsColumn
 	ReplaceAlterTable
+	ReplaceReferTable
+	ReplaceColumnType
+	ReplaceColumnDefault
+	AddTableColumn
 )
 
+// ColumnDefinition 新增列的定义，Type 为目标库的类型文本，如 bigint、varchar(64)；Default 为 nil 时不设置默认值
+type ColumnDefinition struct {
+	Name    string
+	Type    string
+	Default any
+}
+
 func NewDatabaseStatement(stmt Statement, database string, resetDb bool) *DatabaseStatement {
 	return &DatabaseStatement{
 		Statement: stmt,
@@ -70,6 +81,12 @@ type renameTableStatement interface {
 	ReplaceNewTable(database string, table string)
 }
 
+type referTableStatement interface {
+	tableStatement
+	ReferTable() (string, string)
+	ReplaceReferTable(database string, table string)
+}
+
 type createTableStatement interface {
 	tableStatement
 	Columns() []string
@@ -77,6 +94,17 @@ type createTableStatement interface {
 	RemoveColumn(column string)
 }
 
+type columnDefinitionStatement interface {
+	tableStatement
+	ReplaceColumnType(column, tp string)
+	ReplaceColumnDefault(column string, value any)
+}
+
+type addColumnStatement interface {
+	tableStatement
+	AddColumn(column ColumnDefinition)
+}
+
 type tableConstraintsStatement interface {
 	tableStatement
 	IndexColumns() (string, []string)
@@ -172,6 +200,13 @@ type CreateTableColumnStatement struct {
 	removeColumn     []string
 	removeConstraint map[string][]string
 
+	comment        string
+	columnComments map[string]string
+
+	columnTypes    map[string]string
+	columnDefaults map[string]any
+	addColumns     []ColumnDefinition
+
 	dirty bool
 }
 
@@ -193,10 +228,30 @@ func NewCreateTableColumnStatement(stmt Statement, database string, resetDb bool
 		replaceColumn:      map[string]string{},
 		removeColumn:       []string{},
 		removeConstraint:   map[string][]string{},
+		columnComments:     map[string]string{},
+		columnTypes:        map[string]string{},
+		columnDefaults:     map[string]any{},
+		addColumns:         []ColumnDefinition{},
 		dirty:              false,
 	}
 }
 
+// SetComments 表注释及列注释，只用于读取，不参与 SQL 改写
+func (s *CreateTableColumnStatement) SetComments(comment string, columnComments map[string]string) {
+	s.comment = comment
+	if columnComments != nil {
+		s.columnComments = columnComments
+	}
+}
+
+func (s *CreateTableColumnStatement) Comment() string {
+	return s.comment
+}
+
+func (s *CreateTableColumnStatement) ColumnComments() map[string]string {
+	return s.columnComments
+}
+
 func (s *CreateTableColumnStatement) Columns() []string {
 	return s.columns
 }
@@ -224,6 +279,10 @@ func (s *CreateTableColumnStatement) ReplaceColumn(old, new string) {
 		s.dirty = true
 		s.replaceColumn[old] = new
 		s.columns = newColumns
+		if comment, ok := s.columnComments[old]; ok {
+			delete(s.columnComments, old)
+			s.columnComments[new] = comment
+		}
 	}
 	for index, columns := range s.constraints {
 		newCols := make([]string, 0, len(columns))
@@ -261,6 +320,7 @@ func (s *CreateTableColumnStatement) RemoveColumn(column string) {
 		s.columns = newColumns
 		s.removeColumn = append(s.removeColumn, column)
 		s.dirty = true
+		delete(s.columnComments, column)
 	}
 
 	for index, columns := range s.constraints {
@@ -285,8 +345,54 @@ func (s *CreateTableColumnStatement) RemoveColumn(column string) {
 	return
 }
 
+// ReplaceColumnType 修改列类型，列名为修改前的名称
+func (s *CreateTableColumnStatement) ReplaceColumnType(column, tp string) {
+	if !s.existColumn(column) {
+		return
+	}
+	s.columnTypes[column] = tp
+	s.dirty = true
+}
+
+// ReplaceColumnDefault 设置列的默认值
+func (s *CreateTableColumnStatement) ReplaceColumnDefault(column string, value any) {
+	if !s.existColumn(column) {
+		return
+	}
+	s.columnDefaults[column] = value
+	s.dirty = true
+}
+
+// AddColumn 在表尾追加列，同名列已存在时忽略
+func (s *CreateTableColumnStatement) AddColumn(column ColumnDefinition) {
+	if s.existColumn(column.Name) {
+		return
+	}
+	s.columns = append(s.columns, column.Name)
+	s.addColumns = append(s.addColumns, column)
+	s.dirty = true
+}
+
+func (s *CreateTableColumnStatement) existColumn(column string) bool {
+	for _, col := range s.columns {
+		if col == column {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *CreateTableColumnStatement) GenerateSQL() (any, error) {
 	if s.dirty {
+		if len(s.columnTypes) > 0 {
+			s.SubmitModification(ReplaceColumnType, s.columnTypes)
+		}
+		if len(s.columnDefaults) > 0 {
+			s.SubmitModification(ReplaceColumnDefault, s.columnDefaults)
+		}
+		if len(s.addColumns) > 0 {
+			s.SubmitModification(AddTableColumn, s.addColumns)
+		}
 		if len(s.replaceConstraints) > 0 {
 			s.SubmitModification(ReplaceTableColumnMap, s.replaceColumn)
 		}
@@ -308,6 +414,34 @@ type Table struct {
 	Table    string
 }
 
+// CreateTableLikeStatement CREATE TABLE ... LIKE，referTable 为复制结构的源表
+type CreateTableLikeStatement struct {
+	tableStatement
+	referTable Table
+}
+
+func NewCreateTableLikeStatement(stmt Statement, database string, resetDb bool, table string, referTable Table) *CreateTableLikeStatement {
+	return &CreateTableLikeStatement{
+		tableStatement: NewTableStatement(stmt, database, resetDb, table),
+		referTable:     referTable,
+	}
+}
+
+func (s *CreateTableLikeStatement) ReferTable() (string, string) {
+	return s.referTable.Database, s.referTable.Table
+}
+
+func (s *CreateTableLikeStatement) ReplaceReferTable(database string, table string) {
+	s.referTable.Database = database
+	s.referTable.Table = table
+}
+
+// GenerateSQL 源表总是带上库名，未指定库名时与建表语句的默认库一致
+func (s *CreateTableLikeStatement) GenerateSQL() (any, error) {
+	s.SubmitModification(ReplaceReferTable, s.referTable)
+	return s.tableStatement.GenerateSQL()
+}
+
 func NewRenameTableStatement(stmt Statement, old, new Table, resetDb bool) *RenameTableStatement {
 	return &RenameTableStatement{
 		Statement: stmt,
@@ -437,9 +571,11 @@ type AlterTableStatement struct {
 	tableStatement
 	spec AlterSpec
 
-	replaceColumn map[string]string
-	removeColumn  []string
-	dirty         bool
+	replaceColumn  map[string]string
+	removeColumn   []string
+	columnTypes    map[string]string
+	columnDefaults map[string]any
+	dirty          bool
 }
 
 type AlterType string
@@ -459,6 +595,11 @@ const (
 	AddConstraint AlterType = "ADD CONSTRAINT"
 	DropIndex     AlterType = "DROP INDEX"
 	RenameIndex   AlterType = "RENAME INDEX"
+	// TableOption ENGINE、CHARSET、COMMENT 等表选项
+	TableOption       AlterType = "TABLE OPTION"
+	AddPartition      AlterType = "ADD PARTITION"
+	DropPartition     AlterType = "DROP PARTITION"
+	TruncatePartition AlterType = "TRUNCATE PARTITION"
 )
 
 type AlterSpec struct {
@@ -483,6 +624,14 @@ type AlterSpec struct {
 	// rename index
 	OldConstraint string
 	NewConstraint string
+
+	// table option comment
+	Comment string
+	// add modify change 中带 COMMENT 的列
+	ColumnComments map[string]string
+
+	// add、drop、truncate partition
+	Partitions []string
 }
 
 func NewAlterTableStatement(stmt Statement, database string, resetDb bool, table string, spec AlterSpec) *AlterTableStatement {
@@ -491,6 +640,8 @@ func NewAlterTableStatement(stmt Statement, database string, resetDb bool, table
 		spec:           spec,
 		replaceColumn:  map[string]string{},
 		removeColumn:   []string{},
+		columnTypes:    map[string]string{},
+		columnDefaults: map[string]any{},
 		dirty:          false,
 	}
 }
@@ -504,6 +655,10 @@ func (s *AlterTableStatement) AlterType() string {
 }
 
 func (s *AlterTableStatement) ReplaceColumn(old, new string) {
+	if comment, ok := s.spec.ColumnComments[old]; ok {
+		delete(s.spec.ColumnComments, old)
+		s.spec.ColumnComments[new] = comment
+	}
 	switch s.spec.Type {
 	case AddColumn, ModifyColumn, AlterColumn:
 		cols := make([]string, 0, len(s.spec.Columns))
@@ -579,6 +734,7 @@ func (s *AlterTableStatement) ReplaceColumn(old, new string) {
 }
 
 func (s *AlterTableStatement) RemoveColumn(column string) {
+	delete(s.spec.ColumnComments, column)
 	switch s.spec.Type {
 	case AddColumn, ModifyColumn, AlterColumn:
 		cols := make([]string, 0, len(s.spec.Columns))
@@ -668,6 +824,36 @@ func (s *AlterTableStatement) FilterRemoveColumn(column string) bool {
 	return false
 }
 
+// ReplaceColumnType 修改 ADD、MODIFY、CHANGE 中列的类型
+func (s *AlterTableStatement) ReplaceColumnType(column, tp string) {
+	if !s.definedColumn(column) {
+		return
+	}
+	s.columnTypes[column] = tp
+	s.dirty = true
+}
+
+// ReplaceColumnDefault 设置 ADD、MODIFY、CHANGE、ALTER COLUMN 中列的默认值
+func (s *AlterTableStatement) ReplaceColumnDefault(column string, value any) {
+	if !s.definedColumn(column) && !(s.spec.Type == AlterColumn && s.ExistColumn(column)) {
+		return
+	}
+	s.columnDefaults[column] = value
+	s.dirty = true
+}
+
+func (s *AlterTableStatement) definedColumn(column string) bool {
+	switch s.spec.Type {
+	case AddColumn, ModifyColumn, ChangeColumn:
+		for _, col := range s.spec.Columns {
+			if col == column {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (s *AlterTableStatement) RenameNewTable() (string, string) {
 	if s.spec.Type == RenameTable {
 		return s.spec.NewTable.Database, s.spec.NewTable.Table
@@ -692,6 +878,12 @@ func (s *AlterTableStatement) GenerateSQL() (any, error) {
 		if len(s.removeColumn) > 0 {
 			s.SubmitModification(RemoveTableColumn, s.removeColumn)
 		}
+		if len(s.columnTypes) > 0 {
+			s.SubmitModification(ReplaceColumnType, s.columnTypes)
+		}
+		if len(s.columnDefaults) > 0 {
+			s.SubmitModification(ReplaceColumnDefault, s.columnDefaults)
+		}
 	}
 	if s.spec.Type == RenameTable {
 		s.SubmitModification(ReplaceAlterTable, s.spec.NewTable)
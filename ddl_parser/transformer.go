@@ -1,12 +1,42 @@
 package ddl_parser
 
 import (
+	"errors"
 	"fmt"
+
+	"github.com/xuenqlve/common/schema_store"
+)
+
+// 注册转换器使用的数据库类型
+const (
+	DatabaseMySQL      = "mysql"
+	DatabaseMongoDB    = "mongodb"
+	DatabaseClickHouse = "clickhouse"
 )
 
 // 全局实例，提供便捷的转换方法
 var GlobalTransformer = NewStatementTransformer()
 
+// SkippedError 目标库无法表达的操作，调用方记录后跳过该语句即可
+type SkippedError struct {
+	DDLType schema_store.DDL
+	Reason  string
+}
+
+func (e *SkippedError) Error() string {
+	return fmt.Sprintf("skip %s: %s", e.DDLType, e.Reason)
+}
+
+func NewSkippedError(ddlType schema_store.DDL, format string, args ...any) error {
+	return &SkippedError{DDLType: ddlType, Reason: fmt.Sprintf(format, args...)}
+}
+
+// IsSkipped 判断转换结果是否为跳过
+func IsSkipped(err error) bool {
+	var skipped *SkippedError
+	return errors.As(err, &skipped)
+}
+
 type TransformerOption interface {
 	Transformer(src Statement) (bool, Statement, error)
 }
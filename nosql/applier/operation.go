@@ -0,0 +1,186 @@
+package applier
+
+import (
+	"strings"
+
+	"github.com/xuenqlve/common/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	errCodeNamespaceNotFound = 26
+	errCodeIndexNotFound     = 27
+	errCodeNamespaceExists   = 48
+	errCodeDuplicateKey      = 11000
+
+	primaryIndexName = "_id_"
+)
+
+var unordered = options.BulkWrite().SetOrdered(false)
+
+type operationType int
+
+const (
+	opReplace operationType = iota
+	opUpdate
+	opDelete
+)
+
+// operation 一条文档变更，replace 时 document 为替换后的文档，update 时为 update 语句；
+// ts 为变更的 ClusterTime，未知时为 0
+type operation struct {
+	tp         operationType
+	database   string
+	collection string
+	key        bson.D
+	document   bson.D
+	ts         int64
+}
+
+func replaceOperation(database, collection string, key, document bson.D) operation {
+	return operation{tp: opReplace, database: database, collection: collection, key: key, document: document}
+}
+
+func updateOperation(database, collection string, key, update bson.D) operation {
+	return operation{tp: opUpdate, database: database, collection: collection, key: key, document: update}
+}
+
+func deleteOperation(database, collection string, key bson.D) operation {
+	return operation{tp: opDelete, database: database, collection: collection, key: key}
+}
+
+func (op operation) at(ts int64) operation {
+	op.ts = ts
+	return op
+}
+
+func (op operation) model() mongo.WriteModel {
+	switch op.tp {
+	case opReplace:
+		return mongo.NewReplaceOneModel().SetFilter(op.key).SetReplacement(op.document).SetUpsert(true)
+	case opUpdate:
+		return mongo.NewUpdateOneModel().SetFilter(op.key).SetUpdate(op.document)
+	default:
+		return mongo.NewDeleteOneModel().SetFilter(op.key)
+	}
+}
+
+// keyString 同一文档的变更分轮的依据。分片集合的 DocumentKey 包含片键，
+// 而 OnInsertEvent 只能从文档取 _id，因此只按 _id 区分文档
+func (op operation) keyString() string {
+	key := op.key
+	if id := lookupPath(op.key, "_id"); id != nil {
+		key = bson.D{{Key: "_id", Value: id}}
+	}
+	raw, err := bson.Marshal(key)
+	if err != nil {
+		return op.database + "." + op.collection
+	}
+	return string(raw)
+}
+
+// collectionGroup 一个集合的变更，同一文档的第 n 次变更在第 n 轮
+type collectionGroup struct {
+	database   string
+	collection string
+	rounds     [][]operation
+}
+
+func groupOperations(ops []operation) []*collectionGroup {
+	var (
+		groups []*collectionGroup
+		index  = make(map[string]*collectionGroup)
+		counts = make(map[string]map[string]int)
+	)
+	for _, op := range ops {
+		ns := op.database + "." + op.collection
+		group, ok := index[ns]
+		if !ok {
+			group = &collectionGroup{database: op.database, collection: op.collection}
+			index[ns] = group
+			counts[ns] = make(map[string]int)
+			groups = append(groups, group)
+		}
+		key := op.keyString()
+		round := counts[ns][key]
+		counts[ns][key] = round + 1
+		if round == len(group.rounds) {
+			group.rounds = append(group.rounds, nil)
+		}
+		group.rounds[round] = append(group.rounds[round], op)
+	}
+	return groups
+}
+
+// conflictFilter 占用同一唯一键的其他文档。优先使用服务端返回的 keyValue，
+// 否则 replace 按 uniqueIndexes 中各唯一索引取文档的值；无法确定时返回 nil
+func conflictFilter(op operation, writeErr mongo.WriteError, uniqueIndexes map[string][]string) bson.D {
+	exclude := bson.E{Key: "_id", Value: bson.D{{Key: "$ne", Value: lookupPath(op.key, "_id")}}}
+	if value, err := writeErr.Raw.LookupErr("keyValue"); err == nil {
+		keyValue := bson.D{}
+		if raw, ok := value.DocumentOK(); ok && bson.Unmarshal(raw, &keyValue) == nil && len(keyValue) > 0 {
+			return append(keyValue, exclude)
+		}
+	}
+	if op.tp != opReplace {
+		return nil
+	}
+	conds := bson.A{}
+	for name, fields := range uniqueIndexes {
+		if name == primaryIndexName {
+			continue
+		}
+		cond := bson.D{}
+		for _, field := range fields {
+			value := lookupPath(op.document, field)
+			if value == nil {
+				cond = nil
+				break
+			}
+			cond = append(cond, bson.E{Key: field, Value: value})
+		}
+		if len(cond) > 0 {
+			conds = append(conds, cond)
+		}
+	}
+	if len(conds) == 0 {
+		return nil
+	}
+	return bson.D{{Key: "$or", Value: conds}, exclude}
+}
+
+// lookupPath 按 a.b 取嵌套文档的值
+func lookupPath(doc bson.D, path string) any {
+	head, rest, nested := strings.Cut(path, ".")
+	for _, e := range doc {
+		if e.Key != head {
+			continue
+		}
+		if !nested {
+			return e.Value
+		}
+		if sub, ok := e.Value.(bson.D); ok {
+			return lookupPath(sub, rest)
+		}
+		return nil
+	}
+	return nil
+}
+
+func idKey(doc bson.D) bson.D {
+	if id := lookupPath(doc, "_id"); id != nil {
+		return bson.D{{Key: "_id", Value: id}}
+	}
+	return nil
+}
+
+// ignorableDDLError 重放时 DDL 已经执行过
+func ignorableDDLError(err error) bool {
+	se, ok := errors.Cause(err).(mongo.ServerError)
+	if !ok {
+		return false
+	}
+	return se.HasErrorCode(errCodeNamespaceNotFound) || se.HasErrorCode(errCodeIndexNotFound) || se.HasErrorCode(errCodeNamespaceExists)
+}
@@ -0,0 +1,56 @@
+package applier
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestGroupOperations(t *testing.T) {
+	key1, key2 := bson.D{{Key: "_id", Value: 1}}, bson.D{{Key: "_id", Value: 2}}
+	groups := groupOperations([]operation{
+		replaceOperation("db", "a", key1, bson.D{{Key: "_id", Value: 1}}),
+		updateOperation("db", "a", key1, bson.D{{Key: "$set", Value: bson.D{{Key: "x", Value: 1}}}}),
+		replaceOperation("db", "b", key1, bson.D{{Key: "_id", Value: 1}}),
+		deleteOperation("db", "a", key2),
+		deleteOperation("db", "a", key1),
+	})
+	if len(groups) != 2 || groups[0].collection != "a" || groups[1].collection != "b" {
+		t.Fatalf("groups: %v", groups)
+	}
+	rounds := groups[0].rounds
+	if len(rounds) != 3 || len(rounds[0]) != 2 || rounds[1][0].tp != opUpdate || rounds[2][0].tp != opDelete {
+		t.Fatalf("rounds: %v", rounds)
+	}
+
+	// 分片集合 DocumentKey 包含片键，与 OnInsertEvent 的 {_id} 属于同一文档
+	shardKey := bson.D{{Key: "region", Value: "a"}, {Key: "_id", Value: 1}}
+	groups = groupOperations([]operation{
+		replaceOperation("db", "a", key1, bson.D{{Key: "_id", Value: 1}, {Key: "region", Value: "a"}}),
+		updateOperation("db", "a", shardKey, bson.D{{Key: "$set", Value: bson.D{{Key: "x", Value: 1}}}}),
+	})
+	if len(groups[0].rounds) != 2 {
+		t.Fatalf("shard key rounds: %v", groups[0].rounds)
+	}
+}
+
+func TestConflictFilter(t *testing.T) {
+	op := replaceOperation("db", "a", bson.D{{Key: "_id", Value: 1}},
+		bson.D{{Key: "_id", Value: 1}, {Key: "user", Value: bson.D{{Key: "email", Value: "a@b.c"}}}})
+	unique := map[string][]string{"_id_": {"_id"}, "email_1": {"user.email"}, "phone_1": {"phone"}}
+
+	filter := conflictFilter(op, mongo.WriteError{Code: errCodeDuplicateKey}, unique)
+	if len(filter) != 2 || filter[0].Key != "$or" || len(filter[0].Value.(bson.A)) != 1 {
+		t.Fatalf("filter: %v", filter)
+	}
+
+	raw, _ := bson.Marshal(bson.D{{Key: "code", Value: errCodeDuplicateKey}, {Key: "keyValue", Value: bson.D{{Key: "phone", Value: "1"}}}})
+	filter = conflictFilter(updateOperation("db", "a", op.key, bson.D{}), mongo.WriteError{Code: errCodeDuplicateKey, Raw: raw}, nil)
+	if len(filter) != 2 || filter[0].Key != "phone" || filter[1].Key != "_id" {
+		t.Fatalf("key value filter: %v", filter)
+	}
+	if conflictFilter(updateOperation("db", "a", op.key, bson.D{}), mongo.WriteError{Code: errCodeDuplicateKey}, unique) != nil {
+		t.Fatal("update without keyValue can not be resolved")
+	}
+}
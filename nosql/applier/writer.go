@@ -0,0 +1,353 @@
+package applier
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xuenqlve/common/errors"
+	"github.com/xuenqlve/common/log"
+	"github.com/xuenqlve/common/nosql/mongodb_schema"
+	"github.com/xuenqlve/common/nosql/oplog"
+	"github.com/xuenqlve/common/schema_store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	DefaultBatchSize     = 500
+	DefaultFlushInterval = 100 * time.Millisecond
+)
+
+type Config struct {
+	BatchSize     int           `mapstructure:"batch-size" toml:"batch-size" json:"batch-size" yaml:"batch-size"`
+	FlushInterval time.Duration `mapstructure:"flush-interval" toml:"flush-interval" json:"flush-interval" yaml:"flush-interval"`
+	// ReplayUntil 重放窗口结束的位点时间戳（oplog.Position.Timestamp），一般为重启前最后写入的位点。
+	// 只有 ClusterTime 不晚于该值的 ChangeEvent 遇到唯一索引冲突时才删除占用唯一键的文档后重试，
+	// 为 0 或其他变更遇到冲突直接返回错误
+	ReplayUntil int64 `mapstructure:"replay-until" toml:"replay-until" json:"replay-until" yaml:"replay-until"`
+}
+
+func (c *Config) init() {
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = DefaultFlushInterval
+	}
+}
+
+// Writer 实现 oplog.EventHandler 及 oplog.ChangeEventHandler，将变更按集合 BulkWrite 写入目标 MongoDB。
+// 同一文档的变更按顺序分轮写入，不同文档在一轮内 unordered 写入；insert、replace 使用 upsert 替换，
+// 不存在的文档的 update、delete 直接忽略，保证重放幂等。重放窗口（ReplayUntil）内唯一索引冲突时删除占用该键的其他文档后重试
+type Writer struct {
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+
+	cfg         Config
+	client      *mongo.Client
+	schemaStore schema_store.SchemaStore
+
+	mu     sync.Mutex
+	buffer []operation
+	// pending 缓存中最后收到的位点，flush 成功后成为 applied
+	pending    *oplog.Position
+	applied    oplog.Position
+	hasApplied bool
+	err        error
+}
+
+// NewWriter schemaStore 用于获取目标集合的唯一索引，一般为 schema_store.NewBaseSchemaStore(mongodb_schema.NewSchema(client))，
+// 为 nil 时只依赖服务端返回的冲突键处理唯一索引冲突
+func NewWriter(ctx context.Context, cfg Config, client *mongo.Client, schemaStore schema_store.SchemaStore) *Writer {
+	cfg.init()
+	ctxWithCancel, cancelFunc := context.WithCancel(ctx)
+	return &Writer{
+		ctx:         ctxWithCancel,
+		cancelFunc:  cancelFunc,
+		cfg:         cfg,
+		client:      client,
+		schemaStore: schemaStore,
+	}
+}
+
+// Start 启动定时 flush
+func (w *Writer) Start() {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(w.cfg.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.ctx.Done():
+				return
+			case <-ticker.C:
+				if err := w.Flush(); err != nil {
+					log.Errorf("mongodb writer flush err: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Close 写完缓存的变更后停止
+func (w *Writer) Close() error {
+	err := w.Flush()
+	w.cancelFunc()
+	w.wg.Wait()
+	return err
+}
+
+func (w *Writer) OnChangeEvent(event *oplog.ChangeEvent) error {
+	key := event.DocumentKey
+	ts := oplog.TimeStampToInt64(event.ClusterTime)
+	switch event.OperationType {
+	case "insert", "replace":
+		return w.add(replaceOperation(event.Database, event.Collection, key, event.FullDocument).at(ts))
+	case "update":
+		for _, update := range event.UpdateDocuments() {
+			if err := w.add(updateOperation(event.Database, event.Collection, key, update).at(ts)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "delete":
+		return w.add(deleteOperation(event.Database, event.Collection, key).at(ts))
+	}
+	return fmt.Errorf("mongodb writer unknown change event %s", event.OperationType)
+}
+
+func (w *Writer) OnInsertEvent(database, collection string, object bson.D) error {
+	return w.add(replaceOperation(database, collection, idKey(object), object))
+}
+
+// OnUpdateEvent Reader 使用完整文档时 object 为 {$set: fullDocument}，按替换处理
+func (w *Writer) OnUpdateEvent(database, collection string, key bson.D, object bson.D) error {
+	if len(object) == 1 && object[0].Key == "$set" {
+		if doc, ok := object[0].Value.(bson.D); ok && len(idKey(doc)) > 0 {
+			return w.add(replaceOperation(database, collection, key, doc))
+		}
+	}
+	return w.add(updateOperation(database, collection, key, object))
+}
+
+func (w *Writer) OnDeleteEvent(database, collection string, key bson.D) error {
+	return w.add(deleteOperation(database, collection, key))
+}
+
+// OnDDLEvent 先写完缓存的变更再执行 DDL
+func (w *Writer) OnDDLEvent(event oplog.Event) error {
+	if err := w.Flush(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := w.execDDL(event); err != nil {
+		w.setErr(err)
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// OnPosSynced 记录位点，位点之前的变更全部写入后才会成为 AppliedPosition
+func (w *Writer) OnPosSynced(pos oplog.Position, force bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	if len(w.buffer) == 0 {
+		w.applied, w.hasApplied = pos, true
+		w.pending = nil
+		return nil
+	}
+	w.pending = &pos
+	return nil
+}
+
+func (w *Writer) SyncedTimestamp(timestamp uint32) {}
+
+// AppliedPosition 已安全写入的最高位点
+func (w *Writer) AppliedPosition() (oplog.Position, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.applied, w.hasApplied
+}
+
+func (w *Writer) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *Writer) setErr(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *Writer) add(op operation) error {
+	w.mu.Lock()
+	if w.err != nil {
+		w.mu.Unlock()
+		return w.err
+	}
+	w.buffer = append(w.buffer, op)
+	full := len(w.buffer) >= w.cfg.BatchSize
+	w.mu.Unlock()
+	if full {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Flush 写入缓存的全部变更
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	if len(w.buffer) > 0 {
+		if err := w.write(w.buffer); err != nil {
+			w.err = err
+			return err
+		}
+		w.buffer = w.buffer[:0]
+	}
+	if w.pending != nil {
+		w.applied, w.hasApplied = *w.pending, true
+		w.pending = nil
+	}
+	return nil
+}
+
+// write 按集合分组，每个集合按轮次依次 BulkWrite
+func (w *Writer) write(ops []operation) error {
+	for _, group := range groupOperations(ops) {
+		coll := w.client.Database(group.database).Collection(group.collection)
+		for _, round := range group.rounds {
+			if err := w.bulkWrite(coll, group, round); err != nil {
+				return errors.Annotatef(err, "bulk write %s.%s", group.database, group.collection)
+			}
+		}
+	}
+	return nil
+}
+
+func (w *Writer) bulkWrite(coll *mongo.Collection, group *collectionGroup, round []operation) error {
+	models := make([]mongo.WriteModel, 0, len(round))
+	for _, op := range round {
+		models = append(models, op.model())
+	}
+	_, err := coll.BulkWrite(w.ctx, models, unordered)
+	if err == nil {
+		return nil
+	}
+	bwe, ok := err.(mongo.BulkWriteException)
+	if !ok || bwe.WriteConcernError != nil {
+		return errors.Trace(err)
+	}
+	for _, writeErr := range bwe.WriteErrors {
+		if writeErr.Code != errCodeDuplicateKey {
+			return errors.Trace(err)
+		}
+	}
+	for _, writeErr := range bwe.WriteErrors {
+		if !w.replaying(round[writeErr.Index]) {
+			return errors.Trace(err)
+		}
+	}
+	// 唯一索引冲突逐条处理，一轮内的文档互不相同，处理顺序不影响结果
+	for _, writeErr := range bwe.WriteErrors {
+		if err = w.resolveDuplicate(coll, group, round[writeErr.Index], writeErr.WriteError); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// replaying 变更是否在重放窗口内，没有 ClusterTime 的变更无法判断，按不在窗口内处理
+func (w *Writer) replaying(op operation) bool {
+	return op.ts != 0 && op.ts <= w.cfg.ReplayUntil
+}
+
+// resolveDuplicate 重放时文档的唯一键可能还被之后才会删除或修改的其他文档占用，删除这些文档后重试。
+// 只在重放窗口内调用，被删除的文档已经同步过，会由后续的变更重新写入
+func (w *Writer) resolveDuplicate(coll *mongo.Collection, group *collectionGroup, op operation, writeErr mongo.WriteError) error {
+	filter := conflictFilter(op, writeErr, w.uniqueIndexes(group.database, group.collection))
+	if filter == nil {
+		return fmt.Errorf("duplicate key of %v can not be resolved: %v", op.key, writeErr)
+	}
+	res, err := coll.DeleteMany(w.ctx, filter)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	log.Warnf("mongodb writer %s.%s %v duplicate key, removed %d conflict documents %v", group.database, group.collection, op.key, res.DeletedCount, filter)
+	if _, err = coll.BulkWrite(w.ctx, []mongo.WriteModel{op.model()}); err != nil {
+		return errors.Annotatef(err, "retry %v", op.key)
+	}
+	return nil
+}
+
+func (w *Writer) uniqueIndexes(database, collection string) map[string][]string {
+	if w.schemaStore == nil {
+		return nil
+	}
+	schema, err := w.schemaStore.GetSchema(&mongodb_schema.Index{Database: database, Table: collection})
+	if err != nil {
+		log.Warnf("mongodb writer get schema %s.%s err: %v", database, collection, err)
+		return nil
+	}
+	table, ok := schema.(*mongodb_schema.Table)
+	if !ok {
+		return nil
+	}
+	return table.UniqueIndex
+}
+
+func (w *Writer) execDDL(event oplog.Event) error {
+	database, _ := event.Ns[oplog.EventNsDBKey].(string)
+	collection, _ := event.Ns[oplog.EventCollectionKey].(string)
+	var (
+		db  = w.client.Database(database)
+		cmd bson.D
+	)
+	switch event.OperationType {
+	case "drop":
+		cmd = bson.D{{Key: "drop", Value: collection}}
+	case "dropDatabase":
+		cmd = bson.D{{Key: "dropDatabase", Value: 1}}
+	case "rename":
+		db = w.client.Database("admin")
+		cmd = bson.D{
+			{Key: "renameCollection", Value: fmt.Sprintf("%s.%s", database, collection)},
+			{Key: "to", Value: fmt.Sprintf("%v.%v", event.To[oplog.EventNsDBKey], event.To[oplog.EventCollectionKey])},
+		}
+	default:
+		var ok bool
+		if cmd, ok = event.DDLCommand(); !ok {
+			return fmt.Errorf("mongodb writer unknown ddl event %s", event.OperationType)
+		}
+	}
+	err := db.RunCommand(w.ctx, cmd).Err()
+	if w.schemaStore != nil {
+		w.schemaStore.InvalidateSchemaCache(&mongodb_schema.Index{Database: database, Table: collection})
+		if event.OperationType == "rename" {
+			w.schemaStore.InvalidateSchemaCache(&mongodb_schema.Index{
+				Database: fmt.Sprint(event.To[oplog.EventNsDBKey]),
+				Table:    fmt.Sprint(event.To[oplog.EventCollectionKey]),
+			})
+		}
+	}
+	if err != nil && !ignorableDDLError(err) {
+		return errors.Annotatef(err, "exec %v on %s", cmd, database)
+	}
+	if err != nil {
+		log.Warnf("mongodb writer ignore ddl %v err: %v", cmd, err)
+	}
+	return nil
+}
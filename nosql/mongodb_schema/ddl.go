@@ -24,11 +24,33 @@ func (l *oplogDDLLoader) Parse(ddl ddl_parser.DDL) ([]ddl_parser.Statement, erro
 }
 func (l *oplogDDLLoader) makeStatement(event oplog.Event) ([]ddl_parser.Statement, error) {
 	switch event.OperationType {
+	case "create", "modify":
+		database, table, err := oplog.SplitNamespace(event.Ns)
+		if err != nil {
+			return nil, err
+		}
+		md := ddl_parser.Metadata{
+			Database: database,
+			Table:    table,
+		}
+		ddlType := schema_store.Create_Table
+		if event.OperationType == "modify" {
+			ddlType = schema_store.Modify
+		}
+		cmd, _ := event.DDLCommand()
+		return []ddl_parser.Statement{
+			ddl_parser.NewTableStatement(newOplogDDLStatement(ddlType, cmd, md), md.Database, false, md.Table),
+		}, nil
 	case schema_store.Create_Indexes.String():
 		database, table, err := oplog.SplitNamespace(event.Ns)
 		if err != nil {
 			return nil, err
 		}
+		// showExpandedEvents 下索引定义在 operationDescription 中，按命令解析为每个索引一条语句
+		if len(event.OperationDescription) > 0 {
+			cmd, _ := event.DDLCommand()
+			return (&DDLLoader{}).makeStatement(database, cmd)
+		}
 		md := ddl_parser.Metadata{
 			Database: fmt.Sprintf("%v", database),
 			Table:    fmt.Sprintf("%v", table),
@@ -64,6 +86,19 @@ func (l *oplogDDLLoader) makeStatement(event oplog.Event) ([]ddl_parser.Statemen
 		if err != nil {
 			return nil, err
 		}
+		if len(event.OperationDescription) > 0 {
+			cmd, _ := event.DDLCommand()
+			names, _ := cmd[1].Value.(bson.A)
+			stmts := make([]ddl_parser.Statement, 0, len(names))
+			for _, name := range names {
+				list, err := (&DDLLoader{}).makeStatement(database, bson.D{{Key: "dropIndexes", Value: table}, {Key: "index", Value: name}})
+				if err != nil {
+					return nil, err
+				}
+				stmts = append(stmts, list...)
+			}
+			return stmts, nil
+		}
 		md := ddl_parser.Metadata{
 			Database: fmt.Sprintf("%v", database),
 			Table:    fmt.Sprintf("%v", table),
@@ -71,7 +106,7 @@ func (l *oplogDDLLoader) makeStatement(event oplog.Event) ([]ddl_parser.Statemen
 		return []ddl_parser.Statement{
 			ddl_parser.NewTableStatement(newOplogDDLStatement(schema_store.Drop_Indexes, event.FullDocument, md), md.Database, false, md.Table),
 		}, nil
-	case schema_store.Rename.String():
+	case schema_store.Rename.String(), "rename":
 		database, table, err := oplog.SplitNamespace(event.Ns)
 		if err != nil {
 			return nil, err
@@ -237,6 +272,18 @@ func (l *DDLLoader) makeStatement(schema string, stmt bson.D) ([]ddl_parser.Stat
 		return []ddl_parser.Statement{
 			ddl_parser.NewTableStatement(newOplogDDLStatement(schema_store.Drop, stmt, md), md.Database, false, md.Table),
 		}, nil
+	case "create", schema_store.Modify.String():
+		md := ddl_parser.Metadata{
+			Database: schema,
+			Table:    fmt.Sprintf("%v", stmt[0].Value),
+		}
+		ddlType := schema_store.Create_Table
+		if opType == schema_store.Modify.String() {
+			ddlType = schema_store.Modify
+		}
+		return []ddl_parser.Statement{
+			ddl_parser.NewTableStatement(newOplogDDLStatement(ddlType, stmt, md), md.Database, false, md.Table),
+		}, nil
 	case schema_store.Drop_Database.String():
 		md := ddl_parser.Metadata{
 			Database: schema,
@@ -443,9 +490,21 @@ func (s *OplogDDLStatement) Metadata() ddl_parser.Metadata {
 	return s.metadata
 }
 
+// CommandDatabase 执行 GenerateSQL 结果的库：renameCollection 只能在 admin 库执行，其他命令为 Metadata().Database
+func (s *OplogDDLStatement) CommandDatabase() string {
+	if s.ddlType == schema_store.Rename {
+		return "admin"
+	}
+	return s.metadata.Database
+}
+
 func (s *OplogDDLStatement) GenerateSQL() (any, error) {
 	switch s.ddlType {
 	case schema_store.Create_Indexes:
+		if len(s.stmt) == 2 && s.stmt[1].Key == "indexes" {
+			// 已经是完整的 createIndexes 命令，如 MySQL 建表转换出的多个索引
+			return bson.D{{Key: "createIndexes", Value: s.metadata.Table}, s.stmt[1]}, nil
+		}
 		var innerBsonD, indexes bson.D
 		for i, ele := range s.stmt {
 			if i == 0 {
@@ -510,6 +569,12 @@ func (s *OplogDDLStatement) GenerateSQL() (any, error) {
 			},
 		}
 		return stmt, nil
+	case schema_store.Create_Table, schema_store.Modify:
+		if len(s.stmt) == 0 {
+			return nil, fmt.Errorf("%s statement is empty", s.ddlType)
+		}
+		stmt := append(bson.D{{Key: s.stmt[0].Key, Value: s.metadata.Table}}, s.stmt[1:]...)
+		return stmt, nil
 	case schema_store.Rename:
 		stmt := bson.D{
 			primitive.E{
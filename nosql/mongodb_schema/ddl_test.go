@@ -0,0 +1,66 @@
+package mongodb_schema
+
+import (
+	"testing"
+
+	"github.com/xuenqlve/common/ddl_parser"
+	"github.com/xuenqlve/common/nosql/oplog"
+	"github.com/xuenqlve/common/schema_store"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestOplogDDLLoaderExpandedEvents(t *testing.T) {
+	raw, err := bson.Marshal(bson.D{
+		{Key: "operationType", Value: "createIndexes"},
+		{Key: "ns", Value: bson.D{{Key: "db", Value: "db"}, {Key: "coll", Value: "users"}}},
+		{Key: "operationDescription", Value: bson.D{{Key: "indexes", Value: bson.A{
+			bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "name", Value: 1}}}, {Key: "name", Value: "name_1"}, {Key: "unique", Value: true}},
+			bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "age", Value: -1}}}, {Key: "name", Value: "age_-1"}},
+		}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := oplog.Event{}
+	if err = bson.Unmarshal(raw, &event); err != nil {
+		t.Fatal(err)
+	}
+	loader := NewOplogDDLLoader()
+	stmts, err := loader.Parse(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stmts) != 2 {
+		t.Fatalf("statements: %d", len(stmts))
+	}
+	index, ok := stmts[0].Statement.(*ddl_parser.TableConstraintsStatement)
+	if !ok || index.IndexType() != ddl_parser.IndexTypeUnique {
+		t.Fatalf("statement: %T", stmts[0].Statement)
+	}
+	if name, columns := index.IndexColumns(); name != "name_1" || len(columns) != 1 || columns[0] != "name" {
+		t.Fatalf("index: %s %v", name, columns)
+	}
+
+	event = oplog.Event{
+		OperationType:        "dropIndexes",
+		Ns:                   bson.M{"db": "db", "coll": "users"},
+		OperationDescription: bson.D{{Key: "indexes", Value: bson.A{bson.D{{Key: "name", Value: "name_1"}}}}},
+	}
+	if stmts, err = loader.Parse(event); err != nil || len(stmts) != 1 || stmts[0].DDLType() != schema_store.Drop_Indexes {
+		t.Fatalf("drop indexes: %v %v", stmts, err)
+	}
+
+	event = oplog.Event{
+		OperationType:        "modify",
+		Ns:                   bson.M{"db": "db", "coll": "users"},
+		OperationDescription: bson.D{{Key: "index", Value: bson.D{{Key: "name", Value: "name_1"}, {Key: "hidden", Value: true}}}},
+	}
+	if stmts, err = loader.Parse(event); err != nil || len(stmts) != 1 {
+		t.Fatalf("modify: %v %v", stmts, err)
+	}
+	ddl_parser.Modify(stmts[0].Statement, ddl_parser.WithTableRename("db", "users", "members"))
+	cmd, err := stmts[0].GenerateSQL()
+	if err != nil || cmd[0].Key != "collMod" || cmd[0].Value != "members" || cmd[1].Key != "index" {
+		t.Fatalf("modify command: %v %v", cmd, err)
+	}
+}
@@ -0,0 +1,508 @@
+package mongodb_schema
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xuenqlve/common/errors"
+	"github.com/xuenqlve/common/relational_database/mysql"
+	sql_tool "github.com/xuenqlve/common/sql"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultSampleSize     = 1000
+	DefaultMaxDepth       = 3
+	DefaultMaxCardinality = 1000
+	DefaultColumnSep      = "_"
+
+	// ArrayElementPath 数组元素为文档时，元素的字段记录在 <数组路径>.[] 下
+	ArrayElementPath = "[]"
+
+	mysqlPrimaryIndexName = "PRIMARY"
+)
+
+// InferConfig 集合结构推断的采样配置
+type InferConfig struct {
+	// SampleSize 采样的文档数
+	SampleSize int `mapstructure:"sample-size" json:"sample-size" toml:"sample-size" yaml:"sample-size"`
+	// RandomSample 使用 $sample 随机采样，否则按自然顺序读取前 SampleSize 个文档
+	RandomSample bool `mapstructure:"random-sample" json:"random-sample" toml:"random-sample" yaml:"random-sample"`
+	// MaxDepth 嵌套文档展开为列的最大层数，更深的文档作为 json 列
+	MaxDepth int `mapstructure:"max-depth" json:"max-depth" toml:"max-depth" yaml:"max-depth"`
+	// MaxCardinality 统计不同值个数的上限
+	MaxCardinality int `mapstructure:"max-cardinality" json:"max-cardinality" toml:"max-cardinality" yaml:"max-cardinality"`
+	// Separator 展开嵌套文档时列名的分隔符
+	Separator string `mapstructure:"separator" json:"separator" toml:"separator" yaml:"separator"`
+}
+
+func (c *InferConfig) init() {
+	if c.SampleSize <= 0 {
+		c.SampleSize = DefaultSampleSize
+	}
+	if c.MaxDepth <= 0 {
+		c.MaxDepth = DefaultMaxDepth
+	}
+	if c.MaxCardinality <= 0 {
+		c.MaxCardinality = DefaultMaxCardinality
+	}
+	if c.Separator == "" {
+		c.Separator = DefaultColumnSep
+	}
+}
+
+// FieldSchema 一个字段路径的采样统计，Types 为 BSON 类型名（与 $type 的别名一致）及出现次数
+type FieldSchema struct {
+	Path  string
+	Types map[string]int
+	// Count 包含该字段的文档数，NullCount 其中值为 null 的个数
+	Count     int
+	NullCount int
+	// ElementTypes 数组元素的类型，MaxArrayLength 数组的最大长度
+	ElementTypes   map[string]int
+	MaxArrayLength int
+	// MaxLength 字符串的最大长度（字符数）
+	MaxLength int
+	// Cardinality 不同值的个数，达到 MaxCardinality 后不再统计，CardinalityCapped 为 true
+	Cardinality       int
+	CardinalityCapped bool
+
+	values map[string]struct{}
+}
+
+// Nullable 采样中存在缺失或 null
+func (f *FieldSchema) Nullable(sampled int) bool {
+	return f.Count < sampled || f.NullCount > 0
+}
+
+// IsDocument 非 null 的值都是嵌套文档
+func (f *FieldSchema) IsDocument() bool {
+	return f.onlyType("object")
+}
+
+// IsArray 非 null 的值都是数组
+func (f *FieldSchema) IsArray() bool {
+	return f.onlyType("array")
+}
+
+func (f *FieldSchema) onlyType(tp string) bool {
+	if f.Types[tp] == 0 {
+		return false
+	}
+	for name := range f.Types {
+		if name != tp && name != "null" {
+			return false
+		}
+	}
+	return true
+}
+
+// InferredSchema 集合采样推断出的字段路径结构，Fields 按首次出现的顺序排列
+type InferredSchema struct {
+	Database   string
+	Collection string
+	Sampled    int
+	Fields     []*FieldSchema
+
+	cfg    InferConfig
+	fields map[string]*FieldSchema
+}
+
+// SampleDocuments 按 cfg 采样集合的文档
+func (s *Schema) SampleDocuments(database, table string, cfg InferConfig) ([]bson.D, error) {
+	cfg.init()
+	ctx := context.Background()
+	coll := s.conn.Database(database).Collection(table)
+	var (
+		cursor *mongo.Cursor
+		err    error
+	)
+	if cfg.RandomSample {
+		cursor, err = coll.Aggregate(ctx, mongo.Pipeline{{{Key: "$sample", Value: bson.D{{Key: "size", Value: cfg.SampleSize}}}}})
+	} else {
+		cursor, err = coll.Find(ctx, bson.D{}, options.Find().SetLimit(int64(cfg.SampleSize)))
+	}
+	if err != nil {
+		return nil, errors.Annotatef(err, "sample %s.%s", database, table)
+	}
+	docs := make([]bson.D, 0, cfg.SampleSize)
+	if err = cursor.All(ctx, &docs); err != nil {
+		return nil, errors.Annotatef(err, "sample %s.%s", database, table)
+	}
+	return docs, nil
+}
+
+// InferSchema 采样集合并推断结构
+func (s *Schema) InferSchema(database, table string, cfg InferConfig) (*InferredSchema, error) {
+	docs, err := s.SampleDocuments(database, table, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return InferSchema(database, table, docs, cfg), nil
+}
+
+// InferSchema 由文档推断结构
+func InferSchema(database, collection string, docs []bson.D, cfg InferConfig) *InferredSchema {
+	cfg.init()
+	schema := &InferredSchema{
+		Database:   database,
+		Collection: collection,
+		cfg:        cfg,
+		fields:     make(map[string]*FieldSchema),
+	}
+	for _, doc := range docs {
+		schema.Sampled++
+		schema.observeDocument("", doc)
+	}
+	for _, field := range schema.Fields {
+		field.values = nil
+	}
+	return schema
+}
+
+// Field 按路径获取字段，数组内文档的字段路径为 <数组路径>.[].<字段>
+func (s *InferredSchema) Field(path string) (*FieldSchema, bool) {
+	field, ok := s.fields[path]
+	return field, ok
+}
+
+func (s *InferredSchema) field(path string) *FieldSchema {
+	field, ok := s.fields[path]
+	if !ok {
+		field = &FieldSchema{
+			Path:         path,
+			Types:        make(map[string]int),
+			ElementTypes: make(map[string]int),
+			values:       make(map[string]struct{}),
+		}
+		s.fields[path] = field
+		s.Fields = append(s.Fields, field)
+	}
+	return field
+}
+
+func (s *InferredSchema) observeDocument(prefix string, doc bson.D) {
+	for _, e := range doc {
+		s.observe(prefix+e.Key, e.Value)
+	}
+}
+
+func (s *InferredSchema) observe(path string, value any) {
+	field := s.field(path)
+	field.Count++
+	tp := bsonTypeName(value)
+	field.Types[tp]++
+	switch v := value.(type) {
+	case nil:
+		field.NullCount++
+	case bson.D:
+		s.observeDocument(path+".", v)
+	case bson.A:
+		if len(v) > field.MaxArrayLength {
+			field.MaxArrayLength = len(v)
+		}
+		for _, item := range v {
+			field.ElementTypes[bsonTypeName(item)]++
+			if doc, ok := item.(bson.D); ok {
+				s.observeDocument(path+"."+ArrayElementPath+".", doc)
+			}
+		}
+	default:
+		if str, ok := v.(string); ok && len([]rune(str)) > field.MaxLength {
+			field.MaxLength = len([]rune(str))
+		}
+		if field.CardinalityCapped {
+			return
+		}
+		field.values[tp+":"+fmt.Sprint(v)] = struct{}{}
+		field.Cardinality = len(field.values)
+		if field.Cardinality >= s.cfg.MaxCardinality {
+			field.CardinalityCapped = true
+			field.values = nil
+		}
+	}
+}
+
+func bsonTypeName(value any) string {
+	switch value.(type) {
+	case nil, primitive.Null:
+		return "null"
+	case string:
+		return "string"
+	case int32:
+		return "int"
+	case int64:
+		return "long"
+	case float64:
+		return "double"
+	case bool:
+		return "bool"
+	case primitive.DateTime:
+		return "date"
+	case primitive.ObjectID:
+		return "objectId"
+	case primitive.Decimal128:
+		return "decimal"
+	case primitive.Binary:
+		return "binData"
+	case primitive.Timestamp:
+		return "timestamp"
+	case primitive.Regex:
+		return "regex"
+	case bson.D, bson.M:
+		return "object"
+	case bson.A:
+		return "array"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// RelationalColumn 关系型目标的一列，Path 为对应的字段路径
+type RelationalColumn struct {
+	Name       string
+	Path       string
+	Type       string
+	Nullable   bool
+	PrimaryKey bool
+}
+
+// RelationalTable 关系型目标的表结构，列类型按 MySQL 选取
+type RelationalTable struct {
+	Database   string
+	Table      string
+	Columns    []RelationalColumn
+	PrimaryKey []string
+	UniqueKeys map[string][]string
+}
+
+func (t *RelationalTable) Column(name string) (RelationalColumn, bool) {
+	for _, column := range t.Columns {
+		if column.Name == name {
+			return column, true
+		}
+	}
+	return RelationalColumn{}, false
+}
+
+// RelationalTable 推荐的扁平化表结构：深度不超过 MaxDepth 的嵌套文档展开为 a<sep>b 列，
+// 数组、更深的文档及类型不一致的文档作为 json 列；_id 为主键。
+// uniqueIndexes 为集合的唯一索引（Table.UniqueIndex），字段都有对应列时转为唯一键。
+// 不同字段展开后列名相同（如 a_b 与 a.b）时返回错误，需要更换 Separator
+func (s *InferredSchema) RelationalTable(uniqueIndexes map[string][]string) (*RelationalTable, error) {
+	table := &RelationalTable{
+		Database:   s.Database,
+		Table:      s.Collection,
+		UniqueKeys: make(map[string][]string),
+	}
+	// 字段路径对应的列名，展开的文档没有对应的列
+	columnNames := make(map[string]string)
+	columnPaths := make(map[string]string)
+	for _, field := range s.Fields {
+		if !s.isColumn(field) {
+			continue
+		}
+		name := strings.ReplaceAll(field.Path, ".", s.cfg.Separator)
+		if path, ok := columnPaths[name]; ok {
+			return nil, fmt.Errorf("%s.%s field %s and %s both map to column %s", s.Database, s.Collection, path, field.Path, name)
+		}
+		primary := field.Path == PrimaryId || strings.HasPrefix(field.Path, PrimaryId+".")
+		column := RelationalColumn{
+			Name:       name,
+			Path:       field.Path,
+			Type:       columnType(field, primary),
+			Nullable:   !primary && field.Nullable(s.Sampled),
+			PrimaryKey: primary,
+		}
+		if primary {
+			table.PrimaryKey = append(table.PrimaryKey, name)
+		}
+		columnNames[field.Path] = name
+		columnPaths[name] = field.Path
+		table.Columns = append(table.Columns, column)
+	}
+
+	for name, paths := range uniqueIndexes {
+		if name == primaryIndexName {
+			continue
+		}
+		columns := make([]string, 0, len(paths))
+		for _, path := range paths {
+			column, ok := columnNames[path]
+			if !ok {
+				columns = nil
+				break
+			}
+			columns = append(columns, column)
+		}
+		if len(columns) > 0 {
+			table.UniqueKeys[name] = columns
+		}
+	}
+	return table, nil
+}
+
+// MySQLTable 推荐的扁平化表结构转换为 mysql.Table，规则同 RelationalTable
+func (s *InferredSchema) MySQLTable(uniqueIndexes map[string][]string) (*mysql.Table, error) {
+	table, err := s.RelationalTable(uniqueIndexes)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return table.MySQLTable(), nil
+}
+
+// MySQLTable 转换为 mysql.Table，与从 MySQL 加载的表结构一致，UniqueIndex 包含 PRIMARY
+func (t *RelationalTable) MySQLTable() *mysql.Table {
+	table := &mysql.Table{
+		Database:     t.Database,
+		Table:        t.Table,
+		Columns:      make([]mysql.Column, 0, len(t.Columns)),
+		ColumnMap:    make(map[string]mysql.Column, len(t.Columns)),
+		PrimaryIndex: append([]string{}, t.PrimaryKey...),
+		UniqueIndex:  make(map[string][]string, len(t.UniqueKeys)+1),
+	}
+	if len(t.PrimaryKey) > 0 {
+		table.UniqueIndex[mysqlPrimaryIndexName] = append([]string{}, t.PrimaryKey...)
+	}
+	uniqueColumns := make(map[string]bool)
+	for name, columns := range t.UniqueKeys {
+		table.UniqueIndex[name] = append([]string{}, columns...)
+		uniqueColumns[columns[0]] = true
+	}
+	for i, c := range t.Columns {
+		column := mysql.Column{
+			Name:            c.Name,
+			Type:            mysql.ExtractColumnType(c.Type),
+			RawType:         c.Type,
+			DefaultVal:      mysql.ColumnValueString{IsNull: true},
+			IsNullable:      c.Nullable,
+			IsUnsigned:      strings.Contains(c.Type, "unsigned"),
+			IsPrimaryKey:    c.PrimaryKey,
+			DataType:        strings.Fields(strings.SplitN(c.Type, "(", 2)[0])[0],
+			OrdinalPosition: i + 1,
+		}
+		// 与 information_schema.columns.column_key 一致，唯一键只标记第一列
+		if c.PrimaryKey {
+			column.ColumnKey = "PRI"
+		} else if uniqueColumns[c.Name] {
+			column.ColumnKey = "UNI"
+		}
+		table.Columns = append(table.Columns, column)
+		table.ColumnMap[column.Name] = column
+	}
+	table.SetCreateTableSql(t.CreateTableSQL())
+	return table
+}
+
+// isColumn 字段是否对应一列：数组内文档的字段不是列，展开的文档由其子字段作为列
+func (s *InferredSchema) isColumn(field *FieldSchema) bool {
+	parts := strings.Split(field.Path, ".")
+	for i := range parts {
+		if parts[i] == ArrayElementPath {
+			return false
+		}
+		// 祖先字段作为 json 列时子字段不再单独成列
+		if i < len(parts)-1 && !s.expand(strings.Join(parts[:i+1], "."), i+1) {
+			return false
+		}
+	}
+	return !s.expand(field.Path, len(parts))
+}
+
+// expand 深度为 depth 的字段是否展开为子字段列
+func (s *InferredSchema) expand(path string, depth int) bool {
+	field, ok := s.fields[path]
+	return ok && field.IsDocument() && depth < s.cfg.MaxDepth
+}
+
+// columnType 按采样中的类型选择 MySQL 类型，类型不一致时尽量取兼容的类型，否则使用 json
+func columnType(field *FieldSchema, key bool) string {
+	types := make([]string, 0, len(field.Types))
+	for tp := range field.Types {
+		if tp != "null" {
+			types = append(types, tp)
+		}
+	}
+	sort.Strings(types)
+	switch strings.Join(types, ",") {
+	case "":
+		return "json"
+	case "int":
+		return "int"
+	case "int,long", "long":
+		return "bigint"
+	case "double", "double,int", "double,int,long", "double,long":
+		return "double"
+	case "decimal", "decimal,int", "decimal,int,long", "decimal,long":
+		return "decimal(38,10)"
+	case "bool":
+		return "tinyint(1)"
+	case "date":
+		return "datetime(3)"
+	case "timestamp":
+		return "bigint unsigned"
+	case "objectId":
+		return "varchar(24)"
+	case "binData":
+		if key {
+			return "varbinary(255)"
+		}
+		return "longblob"
+	case "string", "objectId,string":
+		return stringType(field.MaxLength, key)
+	}
+	if key {
+		return "varchar(255)"
+	}
+	return "json"
+}
+
+// stringType 采样不一定包含最长的值，长度按采样最大值的两倍预留
+func stringType(length int, key bool) string {
+	switch {
+	case length*2 <= 255:
+		return "varchar(255)"
+	case key:
+		return "varchar(768)"
+	case length*2 <= 16383:
+		return "text"
+	}
+	return "longtext"
+}
+
+// CreateTableSQL 生成 MySQL 建表语句
+func (t *RelationalTable) CreateTableSQL() string {
+	defs := make([]string, 0, len(t.Columns)+len(t.UniqueKeys)+1)
+	for _, column := range t.Columns {
+		def := fmt.Sprintf("  %s %s", sql_tool.ColumnName(column.Name), column.Type)
+		if !column.Nullable {
+			def += " NOT NULL"
+		}
+		defs = append(defs, def)
+	}
+	if len(t.PrimaryKey) > 0 {
+		defs = append(defs, fmt.Sprintf("  PRIMARY KEY (%s)", columnList(t.PrimaryKey)))
+	}
+	names := make([]string, 0, len(t.UniqueKeys))
+	for name := range t.UniqueKeys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		defs = append(defs, fmt.Sprintf("  UNIQUE KEY %s (%s)", sql_tool.ColumnName(name), columnList(t.UniqueKeys[name])))
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n%s\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+		sql_tool.GenerateTableName(t.Database, t.Table), strings.Join(defs, ",\n"))
+}
+
+func columnList(columns []string) string {
+	quoted := make([]string, 0, len(columns))
+	for _, column := range columns {
+		quoted = append(quoted, sql_tool.ColumnName(column))
+	}
+	return strings.Join(quoted, ",")
+}
@@ -0,0 +1,122 @@
+package mongodb_schema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xuenqlve/common/relational_database/mysql"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestInferSchema(t *testing.T) {
+	docs := []bson.D{
+		{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "name", Value: "alice"},
+			{Key: "age", Value: int32(20)},
+			{Key: "profile", Value: bson.D{{Key: "email", Value: "a@b.c"}, {Key: "geo", Value: bson.D{{Key: "lat", Value: 1.5}, {Key: "pos", Value: bson.D{{Key: "x", Value: 1}}}}}}},
+			{Key: "tags", Value: bson.A{"a", "b"}},
+		},
+		{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "name", Value: "bob"},
+			{Key: "age", Value: int64(30)},
+			{Key: "profile", Value: bson.D{{Key: "email", Value: nil}}},
+			{Key: "items", Value: bson.A{bson.D{{Key: "sku", Value: "x"}}}},
+		},
+	}
+	schema := InferSchema("db", "users", docs, InferConfig{})
+	if schema.Sampled != 2 {
+		t.Fatalf("sampled: %d", schema.Sampled)
+	}
+	age, _ := schema.Field("age")
+	if age.Types["int"] != 1 || age.Types["long"] != 1 || age.Cardinality != 2 {
+		t.Fatalf("age: %+v", age)
+	}
+	if sku, ok := schema.Field("items.[].sku"); !ok || sku.Count != 1 {
+		t.Fatalf("array element field: %+v", sku)
+	}
+	if email, _ := schema.Field("profile.email"); !email.Nullable(schema.Sampled) {
+		t.Fatal("profile.email should be nullable")
+	}
+
+	table, err := schema.RelationalTable(map[string][]string{"_id_": {"_id"}, "email_1": {"profile.email"}, "sku_1": {"items.sku"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"_id":             "varchar(24)",
+		"name":            "varchar(255)",
+		"age":             "bigint",
+		"profile_email":   "varchar(255)",
+		"profile_geo_lat": "double",
+		"profile_geo_pos": "json",
+		"tags":            "json",
+		"items":           "json",
+	}
+	if len(table.Columns) != len(expected) {
+		t.Fatalf("columns: %+v", table.Columns)
+	}
+	for name, rawType := range expected {
+		column, ok := table.Column(name)
+		if !ok || column.Type != rawType {
+			t.Fatalf("column %s: %+v", name, column)
+		}
+	}
+	if len(table.PrimaryKey) != 1 || len(table.UniqueKeys) != 1 || table.UniqueKeys["email_1"][0] != "profile_email" {
+		t.Fatalf("indexes: %v %v", table.PrimaryKey, table.UniqueKeys)
+	}
+	sql := table.CreateTableSQL()
+	if !strings.HasPrefix(sql, "CREATE TABLE IF NOT EXISTS `db`.`users` (") ||
+		!strings.Contains(sql, "`_id` varchar(24) NOT NULL") ||
+		!strings.Contains(sql, "PRIMARY KEY (`_id`)") ||
+		!strings.Contains(sql, "UNIQUE KEY `email_1` (`profile_email`)") {
+		t.Fatalf("create table sql: %s", sql)
+	}
+
+	mysqlTable := table.MySQLTable()
+	if mysqlTable.GenerateTableName() != "`db`.`users`" || mysqlTable.CreateTableSql() != sql {
+		t.Fatalf("mysql table: %+v", mysqlTable)
+	}
+	if len(mysqlTable.Columns) != len(table.Columns) || len(mysqlTable.ColumnMap) != len(table.Columns) {
+		t.Fatalf("mysql columns: %+v", mysqlTable.Columns)
+	}
+	for i, column := range table.Columns {
+		mysqlColumn, ok := mysqlTable.Column(column.Name)
+		if !ok || mysqlTable.Columns[i].Name != column.Name || mysqlColumn.RawType != column.Type ||
+			mysqlColumn.IsNullable != column.Nullable || mysqlColumn.IsPrimaryKey != column.PrimaryKey {
+			t.Fatalf("mysql column %s: %+v", column.Name, mysqlColumn)
+		}
+	}
+	if c, _ := mysqlTable.Column("_id"); c.ColumnKey != "PRI" || c.DataType != "varchar" || c.Type != mysql.TypeString {
+		t.Fatalf("mysql _id column: %+v", c)
+	}
+	if c, _ := mysqlTable.Column("age"); c.DataType != "bigint" || c.Type != mysql.TypeNumber {
+		t.Fatalf("mysql age column: %+v", c)
+	}
+	if c, _ := mysqlTable.Column("profile_email"); c.ColumnKey != "UNI" {
+		t.Fatalf("mysql profile_email column: %+v", c)
+	}
+	if len(mysqlTable.PrimaryIndex) != 1 || mysqlTable.PrimaryIndex[0] != "_id" ||
+		mysqlTable.UniqueIndex["PRIMARY"][0] != "_id" || mysqlTable.UniqueIndex["email_1"][0] != "profile_email" {
+		t.Fatalf("mysql indexes: %v %v", mysqlTable.PrimaryIndex, mysqlTable.UniqueIndex)
+	}
+	if err = mysqlTable.InitScanColumns(); err != nil || mysqlTable.ScanColumns()[0] != "_id" {
+		t.Fatalf("mysql scan columns: %v %v", mysqlTable.ScanColumns(), err)
+	}
+}
+
+func TestInferSchemaColumnConflict(t *testing.T) {
+	docs := []bson.D{{
+		{Key: "_id", Value: 1},
+		{Key: "a_b", Value: "x"},
+		{Key: "a", Value: bson.D{{Key: "b", Value: "y"}}},
+	}}
+	if _, err := InferSchema("db", "c", docs, InferConfig{}).RelationalTable(nil); err == nil {
+		t.Fatal("expected column conflict error")
+	}
+	if _, err := InferSchema("db", "c", docs, InferConfig{Separator: "__"}).RelationalTable(nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/xuenqlve/common/errors"
 	"github.com/xuenqlve/common/log"
 	"github.com/xuenqlve/common/match"
+	"github.com/xuenqlve/common/nosql/oplog"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -40,6 +41,19 @@ func (c TableConfigs) FilterConfig() []map[string]any {
 	return result
 }
 
+// NamespaceFilters 转为 oplog.ReaderConfig.Filters，在服务端过滤 change stream
+func (c TableConfigs) NamespaceFilters() []oplog.NamespaceFilter {
+	result := make([]oplog.NamespaceFilter, 0, len(c))
+	for _, docCfg := range c {
+		result = append(result, oplog.NamespaceFilter{
+			Database:         docCfg.Database,
+			AcceptCollection: docCfg.AcceptTableRegex,
+			IgnoreCollection: docCfg.IgnoreTableRegex,
+		})
+	}
+	return result
+}
+
 type TableFilterConfig struct {
 	Database         string              `mapstructure:"database" json:"database"`
 	AcceptTableRegex []string            `mapstructure:"accept-table-regex" json:"accept-table-regex"`
@@ -0,0 +1,160 @@
+package mongodb_schema
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/xuenqlve/common/ddl_parser"
+	"github.com/xuenqlve/common/schema_store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func init() {
+	ddl_parser.GlobalTransformer.RegisterTransformer(ddl_parser.DatabaseMySQL, ddl_parser.DatabaseMongoDB, &MySQLTransformer{})
+}
+
+// MySQLTransformer MySQL DDL 转换为 MongoDB 命令，只处理索引及集合级别的操作：
+// 建表的主键、唯一键及普通索引、CREATE/DROP INDEX 转为 createIndexes/dropIndexes，
+// RENAME TABLE 转为 renameCollection（需在 CommandDatabase 即 admin 库执行），DROP TABLE/DATABASE 转为 drop/dropDatabase。
+// 只涉及列的 DDL 返回 false，目标库无需执行
+type MySQLTransformer struct{}
+
+func (t *MySQLTransformer) Transformer(src ddl_parser.Statement) (bool, ddl_parser.Statement, error) {
+	switch s := src.(type) {
+	case *ddl_parser.CreateTableColumnStatement:
+		return t.createTable(s)
+	case *ddl_parser.TableConstraintsStatement:
+		return t.tableConstraints(s)
+	case *ddl_parser.AlterTableStatement:
+		return t.alterTable(s)
+	case *ddl_parser.RenameTableStatement:
+		oldDatabase, oldTable := s.OldTable()
+		newDatabase, newTable := s.NewTable()
+		return true, renameCollection(ddl_parser.Table{Database: oldDatabase, Table: oldTable}, ddl_parser.Table{Database: newDatabase, Table: newTable}), nil
+	case *ddl_parser.TableStatement:
+		switch s.DDLType() {
+		case schema_store.DROP_TABLE:
+			md := ddl_parser.Metadata{Database: s.Database(), Table: s.Table()}
+			return true, NewDDLStatement(schema_store.Drop, bson.D{{Key: "drop", Value: md.Table}}, md), nil
+		}
+	case *ddl_parser.DatabaseStatement:
+		switch s.DDLType() {
+		case schema_store.CREATE_DATABASE:
+			// 集合写入时自动创建数据库
+			return false, nil, nil
+		case schema_store.DROP_DATABASE:
+			md := ddl_parser.Metadata{Database: s.Database()}
+			return true, NewDDLStatement(schema_store.Drop_Database, bson.D{{Key: "dropDatabase", Value: 1}}, md), nil
+		}
+	}
+	return false, nil, ddl_parser.NewSkippedError(src.DDLType(), "%T is not supported by mongodb", src)
+}
+
+func (t *MySQLTransformer) createTable(s *ddl_parser.CreateTableColumnStatement) (bool, ddl_parser.Statement, error) {
+	if s.DDLType() == schema_store.CREATE_TABLE_SELECT {
+		return false, nil, ddl_parser.NewSkippedError(s.DDLType(), "create table select is not supported by mongodb")
+	}
+	indexTypes := s.Indexes()
+	constraints := s.Constraints()
+	names := make([]string, 0, len(constraints))
+	for name := range constraints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	indexes := make([]bson.D, 0, len(names))
+	for _, name := range names {
+		columns := constraints[name]
+		// 单列 _id 与集合默认索引重复
+		if len(columns) == 0 || (len(columns) == 1 && columns[0] == "_id") {
+			continue
+		}
+		indexType := indexTypes[name]
+		indexes = append(indexes, indexDocument(name, columns, indexType == ddl_parser.IndexTypePrimary || indexType == ddl_parser.IndexTypeUnique))
+	}
+	if len(indexes) == 0 {
+		// 没有索引时集合在写入时自动创建
+		return false, nil, nil
+	}
+	md := ddl_parser.Metadata{Database: s.Database(), Table: s.Table()}
+	stmt := bson.D{
+		{Key: "createIndexes", Value: md.Table},
+		{Key: "indexes", Value: indexes},
+	}
+	return true, NewDDLStatement(schema_store.Create_Indexes, stmt, md), nil
+}
+
+func (t *MySQLTransformer) tableConstraints(s *ddl_parser.TableConstraintsStatement) (bool, ddl_parser.Statement, error) {
+	md := ddl_parser.Metadata{Database: s.Database(), Table: s.Table()}
+	name, columns := s.IndexColumns()
+	switch s.DDLType() {
+	case schema_store.CREATE_INDEX:
+		if len(columns) == 0 {
+			return false, nil, ddl_parser.NewSkippedError(s.DDLType(), "index %s has no column", name)
+		}
+		return true, createIndex(md, indexDocument(name, columns, s.IndexType() == ddl_parser.IndexTypeUnique)), nil
+	case schema_store.DROP_INDEX:
+		return true, dropIndex(md, name), nil
+	}
+	return false, nil, ddl_parser.NewSkippedError(s.DDLType(), "%T is not supported by mongodb", s)
+}
+
+func (t *MySQLTransformer) alterTable(s *ddl_parser.AlterTableStatement) (bool, ddl_parser.Statement, error) {
+	md := ddl_parser.Metadata{Database: s.Database(), Table: s.Table()}
+	spec := s.AlterSpec()
+	switch spec.Type {
+	case ddl_parser.AddConstraint:
+		if len(spec.ConstraintColumn) == 0 {
+			return false, nil, ddl_parser.NewSkippedError(s.DDLType(), "constraint %s has no column", spec.IndexName)
+		}
+		unique := spec.IndexType == ddl_parser.IndexTypePrimary || spec.IndexType == ddl_parser.IndexTypeUnique
+		return true, createIndex(md, indexDocument(spec.IndexName, spec.ConstraintColumn, unique)), nil
+	case ddl_parser.DropIndex:
+		return true, dropIndex(md, spec.IndexName), nil
+	case ddl_parser.RenameTable:
+		database, table := s.RenameNewTable()
+		return true, renameCollection(ddl_parser.Table{Database: md.Database, Table: md.Table}, ddl_parser.Table{Database: database, Table: table}), nil
+	case ddl_parser.AddColumn, ddl_parser.DropColumn, ddl_parser.ModifyColumn, ddl_parser.ChangeColumn,
+		ddl_parser.RenameColumn, ddl_parser.AlterColumn, ddl_parser.TableOption,
+		ddl_parser.AddPartition, ddl_parser.DropPartition, ddl_parser.TruncatePartition:
+		// 文档没有固定的列定义
+		return false, nil, nil
+	}
+	return false, nil, ddl_parser.NewSkippedError(s.DDLType(), "alter %s is not supported by mongodb", spec.Type)
+}
+
+func indexDocument(name string, columns []string, unique bool) bson.D {
+	key := make(bson.D, 0, len(columns))
+	for _, column := range columns {
+		key = append(key, primitive.E{Key: column, Value: 1})
+	}
+	index := bson.D{{Key: "key", Value: key}, {Key: "name", Value: name}}
+	if unique {
+		index = append(index, primitive.E{Key: "unique", Value: true})
+	}
+	return index
+}
+
+func createIndex(md ddl_parser.Metadata, index bson.D) *OplogDDLStatement {
+	stmt := bson.D{{Key: "createIndexes", Value: md.Table}}
+	stmt = append(stmt, index...)
+	return NewDDLStatement(schema_store.Create_Indexes, stmt, md)
+}
+
+func dropIndex(md ddl_parser.Metadata, name string) *OplogDDLStatement {
+	return NewDDLStatement(schema_store.Drop_Indexes, bson.D{{Key: "dropIndexes", Value: md.Table}, {Key: "index", Value: name}}, md)
+}
+
+func renameCollection(oldTable, newTable ddl_parser.Table) *OplogDDLStatement {
+	md := ddl_parser.Metadata{
+		Database:       oldTable.Database,
+		Table:          oldTable.Table,
+		RenameDatabase: newTable.Database,
+		RenameTable:    newTable.Table,
+	}
+	stmt := bson.D{
+		{Key: "renameCollection", Value: fmt.Sprintf("%s.%s", oldTable.Database, oldTable.Table)},
+		{Key: "to", Value: fmt.Sprintf("%s.%s", newTable.Database, newTable.Table)},
+	}
+	return NewDDLStatement(schema_store.Rename, stmt, md)
+}
@@ -0,0 +1,64 @@
+package mongodb_schema
+
+import (
+	"testing"
+
+	"github.com/xuenqlve/common/ddl_parser"
+	mysql_ddl "github.com/xuenqlve/common/relational_database/ddl_parser"
+	"github.com/xuenqlve/common/schema_store"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMySQLTransformer(t *testing.T) {
+	loader := mysql_ddl.NewPingCapLoader()
+	stmts, err := loader.Parse(ddl_parser.DDL{Schema: "db", SQL: `CREATE TABLE users (id int PRIMARY KEY, email varchar(64), UNIQUE KEY uk_email (email));
+ALTER TABLE users ADD COLUMN age int, ADD INDEX idx_age (age);
+DROP INDEX uk_email ON users;
+RENAME TABLE users TO members;
+DROP TABLE members;
+DROP DATABASE db`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []schema_store.DDL{
+		schema_store.Create_Indexes,
+		"",
+		schema_store.Create_Indexes,
+		schema_store.Drop_Indexes,
+		schema_store.Rename,
+		schema_store.Drop,
+		schema_store.Drop_Database,
+	}
+	if len(stmts) != len(expected) {
+		t.Fatalf("statement count: %d", len(stmts))
+	}
+	for i, stmt := range stmts {
+		ok, dst, err := ddl_parser.GlobalTransformer.Transform(stmt, ddl_parser.DatabaseMySQL, ddl_parser.DatabaseMongoDB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected[i] == "" {
+			if ok {
+				t.Fatalf("statement %d should be ignored", i)
+			}
+			continue
+		}
+		if !ok || dst.DDLType() != expected[i] {
+			t.Fatalf("statement %d: %v %v", i, ok, dst)
+		}
+		value, err := dst.GenerateSQL()
+		if err != nil {
+			t.Fatal(err)
+		}
+		command := value.(bson.D)
+		if i == 0 {
+			indexes := command[1].Value.([]bson.D)
+			if len(indexes) != 2 || indexes[0][1].Value != "PRIMARY" || indexes[1][1].Value != "uk_email" {
+				t.Fatalf("create table indexes: %v", command)
+			}
+		}
+		if i == 4 && (command[0].Value != "db.users" || command[1].Value != "db.members" || dst.(*OplogDDLStatement).CommandDatabase() != "admin") {
+			t.Fatalf("rename collection: %v", command)
+		}
+	}
+}
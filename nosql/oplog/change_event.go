@@ -0,0 +1,277 @@
+package oplog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UpdateDescription update 事件的变更描述
+type UpdateDescription struct {
+	UpdatedFields bson.D   `bson:"updatedFields" json:"updatedFields"`
+	RemovedFields []string `bson:"removedFields" json:"removedFields"`
+	// TruncatedArrays 通过截断缩短的数组，6.0 起出现
+	TruncatedArrays []TruncatedArray `bson:"truncatedArrays,omitempty" json:"truncatedArrays,omitempty"`
+	// DisambiguatedPaths 字段名包含数字或点时的完整路径，值的每一项为字段名（string）或数组下标（int），需要 showExpandedEvents
+	DisambiguatedPaths bson.M `bson:"disambiguatedPaths,omitempty" json:"disambiguatedPaths,omitempty"`
+}
+
+type TruncatedArray struct {
+	Field   string `bson:"field" json:"field"`
+	NewSize int32  `bson:"newSize" json:"newSize"`
+}
+
+// UpdateDocuments 转换为 update 语句：截断数组使用 $push + $slice，更新字段使用 $set、$unset。
+// 截断的数组与更新字段路径冲突时拆分为两条，按顺序执行
+func (d *UpdateDescription) UpdateDocuments() []bson.D {
+	if d == nil {
+		return nil
+	}
+	set := bson.D{}
+	if len(d.UpdatedFields) > 0 {
+		set = append(set, primitive.E{Key: "$set", Value: d.UpdatedFields})
+	}
+	if len(d.RemovedFields) > 0 {
+		unset := make(bson.D, 0, len(d.RemovedFields))
+		for _, field := range d.RemovedFields {
+			unset = append(unset, primitive.E{Key: field, Value: 1})
+		}
+		set = append(set, primitive.E{Key: "$unset", Value: unset})
+	}
+	if len(d.TruncatedArrays) == 0 {
+		if len(set) == 0 {
+			return nil
+		}
+		return []bson.D{set}
+	}
+
+	push := make(bson.D, 0, len(d.TruncatedArrays))
+	conflict := false
+	for _, array := range d.TruncatedArrays {
+		push = append(push, primitive.E{Key: array.Field, Value: bson.D{
+			{Key: "$each", Value: bson.A{}},
+			{Key: "$slice", Value: array.NewSize},
+		}})
+		conflict = conflict || d.touches(array.Field)
+	}
+	truncate := bson.D{{Key: "$push", Value: push}}
+	switch {
+	case len(set) == 0:
+		return []bson.D{truncate}
+	case conflict:
+		return []bson.D{truncate, set}
+	}
+	return []bson.D{append(truncate, set...)}
+}
+
+// touches 更新或删除的字段是否在 field 下
+func (d *UpdateDescription) touches(field string) bool {
+	prefix := field + "."
+	for _, e := range d.UpdatedFields {
+		if e.Key == field || strings.HasPrefix(e.Key, prefix) {
+			return true
+		}
+	}
+	for _, removed := range d.RemovedFields {
+		if removed == field || strings.HasPrefix(removed, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldPath 字段路径的每一级，string 为字段名，int 为数组下标；
+// 没有 disambiguatedPaths 时数字按数组下标处理
+func (d *UpdateDescription) fieldPath(path string) []any {
+	if d != nil {
+		if components, ok := d.DisambiguatedPaths[path].(bson.A); ok {
+			result := make([]any, 0, len(components))
+			for _, component := range components {
+				switch v := component.(type) {
+				case int32:
+					result = append(result, int(v))
+				case int64:
+					result = append(result, int(v))
+				default:
+					result = append(result, fmt.Sprint(v))
+				}
+			}
+			return result
+		}
+	}
+	parts := strings.Split(path, ".")
+	result := make([]any, 0, len(parts))
+	for _, part := range parts {
+		if index, err := strconv.Atoi(part); err == nil {
+			result = append(result, index)
+		} else {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+// ChangeEvent insert、update、replace、delete 事件的结构化表示
+type ChangeEvent struct {
+	OperationType string
+	Database      string
+	Collection    string
+	DocumentKey   bson.D
+	// FullDocument insert、replace 为完整文档，update 需要 full-document 配置，delete 为 nil
+	FullDocument             bson.D
+	FullDocumentBeforeChange bson.D
+	UpdatedFields            bson.D
+	RemovedFields            []string
+	TruncatedArrays          []TruncatedArray
+	DisambiguatedPaths       bson.M
+	ClusterTime              primitive.Timestamp
+	// WallTime 6.0 起出现
+	WallTime  time.Time
+	TxnNumber *int64
+	LSID      bson.Raw
+}
+
+// NewChangeEvent 只转换 insert、update、replace、delete 事件
+func NewChangeEvent(event Event) (*ChangeEvent, error) {
+	switch event.OperationType {
+	case insertOperation, updateOperation, replaceOperation, deleteOperation:
+	default:
+		return nil, fmt.Errorf("%s event is not a change event", event.OperationType)
+	}
+	database, collection, err := SplitNamespace(event.Ns)
+	if err != nil {
+		return nil, err
+	}
+	e := &ChangeEvent{
+		OperationType:            event.OperationType,
+		Database:                 database,
+		Collection:               collection,
+		DocumentKey:              event.DocumentKey,
+		FullDocument:             event.FullDocument,
+		FullDocumentBeforeChange: event.FullDocumentBeforeChange,
+		ClusterTime:              event.ClusterTime,
+		WallTime:                 event.WallTime,
+		TxnNumber:                event.TxnNumber,
+		LSID:                     event.LSID,
+	}
+	if desc := event.UpdateDescription; desc != nil {
+		e.UpdatedFields = desc.UpdatedFields
+		e.RemovedFields = desc.RemovedFields
+		e.TruncatedArrays = desc.TruncatedArrays
+		e.DisambiguatedPaths = desc.DisambiguatedPaths
+	}
+	return e, nil
+}
+
+// InTransaction 是否为多文档事务内的事件
+func (e *ChangeEvent) InTransaction() bool {
+	return len(e.LSID) > 0 && e.TxnNumber != nil
+}
+
+func (e *ChangeEvent) updateDescription() *UpdateDescription {
+	return &UpdateDescription{
+		UpdatedFields:      e.UpdatedFields,
+		RemovedFields:      e.RemovedFields,
+		TruncatedArrays:    e.TruncatedArrays,
+		DisambiguatedPaths: e.DisambiguatedPaths,
+	}
+}
+
+// UpdateDocuments update 事件按 DocumentKey 依次执行的 update 语句，replace 事件为替换文档，其他事件为 nil
+func (e *ChangeEvent) UpdateDocuments() []bson.D {
+	switch e.OperationType {
+	case updateOperation:
+		return e.updateDescription().UpdateDocuments()
+	case replaceOperation:
+		return []bson.D{e.FullDocument}
+	}
+	return nil
+}
+
+// Columns 转换为关系型目标的列，嵌套文档按 sep 展开为 a<sep>b，数组作为整体的值。
+// insert、replace 为完整的行，replace 中不存在的列应置为 NULL；delete 为 DocumentKey。
+// update 有 FullDocument 时为完整的行，否则为变更的列及删除的列；
+// 修改了数组元素或截断了数组时无法对应到列，需要配置 full-document
+func (e *ChangeEvent) Columns(sep string) (columns map[string]any, removed []string, err error) {
+	switch e.OperationType {
+	case insertOperation, replaceOperation:
+		return FlattenDocument(e.FullDocument, sep), nil, nil
+	case deleteOperation:
+		return FlattenDocument(e.DocumentKey, sep), nil, nil
+	case updateOperation:
+	default:
+		return nil, nil, fmt.Errorf("%s event has no columns", e.OperationType)
+	}
+	if e.FullDocument != nil {
+		return FlattenDocument(e.FullDocument, sep), nil, nil
+	}
+	if len(e.TruncatedArrays) > 0 {
+		return nil, nil, fmt.Errorf("%s.%s truncated array %s need full document", e.Database, e.Collection, e.TruncatedArrays[0].Field)
+	}
+	desc := e.updateDescription()
+	columns = make(map[string]any, len(e.UpdatedFields))
+	for _, field := range e.UpdatedFields {
+		column, err := e.column(desc, field.Key, sep)
+		if err != nil {
+			return nil, nil, err
+		}
+		if doc, ok := field.Value.(bson.D); ok {
+			for k, v := range FlattenDocument(doc, sep) {
+				columns[column+sep+k] = v
+			}
+			continue
+		}
+		columns[column] = field.Value
+	}
+	removed = make([]string, 0, len(e.RemovedFields))
+	for _, field := range e.RemovedFields {
+		column, err := e.column(desc, field, sep)
+		if err != nil {
+			return nil, nil, err
+		}
+		removed = append(removed, column)
+	}
+	return columns, removed, nil
+}
+
+func (e *ChangeEvent) column(desc *UpdateDescription, path, sep string) (string, error) {
+	components := desc.fieldPath(path)
+	names := make([]string, 0, len(components))
+	for _, component := range components {
+		name, ok := component.(string)
+		if !ok {
+			return "", fmt.Errorf("%s.%s array element %s need full document", e.Database, e.Collection, path)
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, sep), nil
+}
+
+// FlattenDocument 嵌套文档按 sep 展开为一层，数组作为整体的值
+func FlattenDocument(doc bson.D, sep string) map[string]any {
+	columns := make(map[string]any, len(doc))
+	flatten("", doc, sep, columns)
+	return columns
+}
+
+func flatten(prefix string, doc bson.D, sep string, columns map[string]any) {
+	for _, e := range doc {
+		key := prefix + e.Key
+		switch v := e.Value.(type) {
+		case bson.D:
+			flatten(key+sep, v, sep, columns)
+		case bson.M:
+			nested := make(bson.D, 0, len(v))
+			for k, value := range v {
+				nested = append(nested, primitive.E{Key: k, Value: value})
+			}
+			flatten(key+sep, nested, sep, columns)
+		default:
+			columns[key] = v
+		}
+	}
+}
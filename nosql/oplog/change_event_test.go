@@ -0,0 +1,63 @@
+package oplog
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestChangeEvent(t *testing.T) {
+	raw, _ := bson.Marshal(bson.D{
+		{Key: "_id", Value: bson.D{{Key: "_data", Value: "82"}}},
+		{Key: "operationType", Value: "update"},
+		{Key: "ns", Value: bson.D{{Key: "db", Value: "db"}, {Key: "coll", Value: "c"}}},
+		{Key: "documentKey", Value: bson.D{{Key: "_id", Value: 1}}},
+		{Key: "updateDescription", Value: bson.D{
+			{Key: "updatedFields", Value: bson.D{{Key: "a.b", Value: 1}, {Key: "c", Value: bson.D{{Key: "y", Value: 2}, {Key: "x", Value: 3}}}, {Key: "d.0", Value: 4}}},
+			{Key: "removedFields", Value: bson.A{"e"}},
+			{Key: "disambiguatedPaths", Value: bson.D{{Key: "d.0", Value: bson.A{"d", "0"}}}},
+		}},
+	})
+	event := Event{}
+	if err := bson.Unmarshal(raw, &event); err != nil {
+		t.Fatal(err)
+	}
+	changeEvent, err := NewChangeEvent(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changeEvent.Database != "db" || changeEvent.Collection != "c" || len(changeEvent.UpdatedFields) != 3 {
+		t.Fatalf("change event: %+v", changeEvent)
+	}
+	// 嵌套文档保持字段顺序
+	if c := changeEvent.UpdatedFields[1].Value.(bson.D); c[0].Key != "y" {
+		t.Fatalf("nested order: %v", c)
+	}
+
+	columns, removed, err := changeEvent.Columns("_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{"a_b": int32(1), "c_y": int32(2), "c_x": int32(3), "d_0": int32(4)}
+	if !reflect.DeepEqual(columns, expected) || !reflect.DeepEqual(removed, []string{"e"}) {
+		t.Fatalf("columns: %v removed: %v", columns, removed)
+	}
+
+	changeEvent.DisambiguatedPaths = nil
+	if _, _, err = changeEvent.Columns("_"); err == nil {
+		t.Fatal("array element need full document")
+	}
+
+	desc := &UpdateDescription{
+		UpdatedFields:   bson.D{{Key: "arr.1", Value: 1}},
+		TruncatedArrays: []TruncatedArray{{Field: "arr", NewSize: 2}},
+	}
+	if docs := desc.UpdateDocuments(); len(docs) != 2 || docs[0][0].Key != "$push" || docs[1][0].Key != "$set" {
+		t.Fatalf("conflict update documents: %v", docs)
+	}
+	desc.UpdatedFields = bson.D{{Key: "other", Value: 1}}
+	if docs := desc.UpdateDocuments(); len(docs) != 1 || len(docs[0]) != 2 {
+		t.Fatalf("update documents: %v", docs)
+	}
+}
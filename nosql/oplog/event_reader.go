@@ -13,6 +13,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
@@ -27,11 +28,16 @@ type EventReader struct {
 
 	cfg                  ReaderConfig
 	startAtOperationTime interface{}
+	pipeline             mongo.Pipeline
 
 	fetcherExist bool
 	fetcherLock  sync.Mutex
 	oplogChan    chan []byte
 	errChan      chan error
+	// restartChan 位点过期后等待新的起始位置
+	restartChan chan any
+	// idlePending 上次空批次之后发送过事件，下次空批次需要通知
+	idlePending bool
 
 	closed atomic.Bool
 }
@@ -45,6 +51,7 @@ func NewEventReader(ctx context.Context, cfg ReaderConfig) *EventReader {
 		startAtOperationTime: nil,
 		oplogChan:            make(chan []byte),
 		errChan:              make(chan error),
+		restartChan:          make(chan any),
 	}
 	r.closed.Store(false)
 	return r
@@ -57,14 +64,39 @@ const (
 
 func (r *EventReader) SetQueryTimestampOnEmpty(ts Position) {
 	if r.startAtOperationTime == nil {
-		if ts.Timestamp != InitCheckpoint {
-			r.startAtOperationTime = ts.Timestamp
-		} else {
-			r.startAtOperationTime = ts.Token
-		}
+		r.startAtOperationTime = positionStart(ts)
+	}
+}
+
+func positionStart(ts Position) any {
+	if ts.Timestamp != InitCheckpoint {
+		return ts.Timestamp
+	}
+	return ts.Token
+}
+
+// Restart 位点过期返回 ResumeExpiredError 后，从新的位置重新读取
+func (r *EventReader) Restart(ts Position) {
+	select {
+	case r.restartChan <- positionStart(ts):
+	case <-r.ctx.Done():
+	}
+}
+
+// waitRestart 位点过期后不再重试，等待 Restart
+func (r *EventReader) waitRestart(err error) {
+	r.errChan <- newResumeExpiredError(r.cfg, r.startAtOperationTime, err)
+	select {
+	case r.startAtOperationTime = <-r.restartChan:
+	case <-r.ctx.Done():
 	}
 }
 
+// SetPipeline 设置 change stream 的聚合管道，需在 Start 之前调用
+func (r *EventReader) SetPipeline(pipeline mongo.Pipeline) {
+	r.pipeline = pipeline
+}
+
 func (r *EventReader) UpdateQueryTimestamp(ts int64) {
 	r.startAtOperationTime = ts
 }
@@ -91,7 +123,15 @@ func (r *EventReader) ensureNetwork() (err error) {
 	if err != nil {
 		return err
 	}
-	r.client, err = MongoDBStreamConn(r.ctx, connect, DefaultReaderFetchBatchSize, r.startAtOperationTime)
+	r.client, err = WatchStreamConn(r.ctx, connect, DefaultReaderFetchBatchSize, r.startAtOperationTime, WatchConfig{
+		Database:   r.cfg.WatchDatabase,
+		Collection: r.cfg.WatchCollection,
+		Pipeline:   r.pipeline,
+
+		FullDocument:             options.FullDocument(r.cfg.FullDocument),
+		FullDocumentBeforeChange: options.FullDocument(r.cfg.FullDocumentBeforeChange),
+		MaxAwaitTime:             r.cfg.txnWaitTime(),
+	})
 	if err != nil {
 		return err
 	}
@@ -127,36 +167,67 @@ func (r *EventReader) run() {
 
 		if err := r.ensureNetwork(); err != nil {
 			// 发送错误信息，如果通道已关闭会触发panic并被defer捕获
+			if isResumeExpired(err) {
+				r.waitRestart(err)
+				continue
+			}
 			r.errChan <- err
 			continue
 		}
 
 		data, ok := r.getNext()
 		if !ok {
-			if err := r.client.Err(); err != nil {
+			err := r.client.Err()
+			if err != nil {
 				log.Errorf("stream reader hit the end:%v", err)
 			}
 			if err := r.client.Close(r.ctx); err != nil {
 				log.Errorf("stream reader close err:%v", err)
 			}
 			r.client = nil
+			if isResumeExpired(err) {
+				r.waitRestart(err)
+				continue
+			}
 
 			time.Sleep(1 * time.Second)
 			continue
 		}
 
+		if data == nil {
+			// 空批次通知
+			r.oplogChan <- nil
+			continue
+		}
+
+		// 重连时从已发送的最后一个事件之后继续，而不是最初的起始位置
+		token := cloneRaw(r.client.ResumeToken())
 		// 发送数据，如果通道已关闭会触发panic并被defer捕获
 		r.oplogChan <- data
+		if len(token) > 0 {
+			r.startAtOperationTime = token
+		}
 	}
 }
 
+// getNext 读取下一个事件，发送过事件后遇到空批次返回 nil, true
 func (r *EventReader) getNext() ([]byte, bool) {
-	if ok := r.client.Next(r.ctx); !ok {
-		return nil, false
+	for {
+		if r.client.TryNext(r.ctx) {
+			r.idlePending = true
+			return r.client.Current, true
+		}
+		if r.client.Err() != nil || r.client.ID() == 0 {
+			return nil, false
+		}
+		if r.idlePending {
+			r.idlePending = false
+			return nil, true
+		}
 	}
-	return r.client.Current, true
 }
 
+// Next 返回 nil, nil 表示 change stream 返回了空批次，之前的事件所在的事务已经结束
 func (r *EventReader) Next() ([]byte, error) {
 	// 检查是否已关闭
 	if r.closed.Load() {
@@ -9,6 +9,7 @@ type EventHandler interface {
 
 	OnDeleteEvent(database, collection string, key bson.D) error
 
+	// OnUpdateEvent object 为 update 语句，replace 事件在未实现 ReplaceEventHandler 时为 {$set: fullDocument}
 	OnUpdateEvent(database, collection string, key bson.D, object bson.D) error
 
 	// begin Commit 操作也会变为ddl
@@ -19,3 +20,28 @@ type EventHandler interface {
 
 	SyncedTimestamp(timestamp uint32)
 }
+
+// TransactionHandler EventHandler 可选实现，多文档事务的全部事件通过 OnTransaction 一次交付，
+// 未实现时事务结束后按顺序回调单条事件的方法；两种方式都只在事务结束后提交位点
+type TransactionHandler interface {
+	OnTransaction(txn *Transaction) error
+}
+
+// ChangeEventHandler EventHandler 可选实现，实现后 insert、update、replace、delete 事件改为回调 OnChangeEvent，
+// 不再改写为 $set/$unset，其他 DML 回调方法不会被调用
+type ChangeEventHandler interface {
+	OnChangeEvent(event *ChangeEvent) error
+}
+
+// ReplaceEventHandler EventHandler 可选实现，replace 事件回调替换后的完整文档
+type ReplaceEventHandler interface {
+	OnReplaceEvent(database, collection string, key, document bson.D) error
+}
+
+// ImageEventHandler EventHandler 可选实现，实现后更新、删除事件改为回调带前后镜像的方法。
+// before 需要配置 full-document-before-change，after 为 fullDocument，镜像不可用时为 nil
+type ImageEventHandler interface {
+	OnUpdateImageEvent(database, collection string, key, object, before, after bson.D) error
+
+	OnDeleteImageEvent(database, collection string, key, before bson.D) error
+}
@@ -0,0 +1,63 @@
+package oplog
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/xuenqlve/common/errors"
+	"github.com/xuenqlve/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// checkFullDocument 校验 full-document、full-document-before-change 配置
+func checkFullDocument(fullDocument, beforeChange string) error {
+	switch options.FullDocument(fullDocument) {
+	case "", options.Default, options.UpdateLookup, options.WhenAvailable, options.Required:
+	default:
+		return fmt.Errorf("oplog reader full-document %s must be default, updateLookup, whenAvailable or required", fullDocument)
+	}
+	switch options.FullDocument(beforeChange) {
+	case "", options.Off, options.WhenAvailable, options.Required:
+	default:
+		return fmt.Errorf("oplog reader full-document-before-change %s must be off, whenAvailable or required", beforeChange)
+	}
+	return nil
+}
+
+// EnablePreAndPostImages 为集合开启 changeStreamPreAndPostImages（MongoDB 6.0+），
+// collections 为空时处理库下全部非 system 集合
+func EnablePreAndPostImages(ctx context.Context, client *mongo.Client, database string, collections ...string) error {
+	ok, err := GetAndCompareVersion(client, "6.0.0", "")
+	if err != nil {
+		return errors.Annotatef(err, "changeStreamPreAndPostImages need mongodb 6.0+")
+	}
+	if !ok {
+		return fmt.Errorf("changeStreamPreAndPostImages need mongodb 6.0+")
+	}
+	db := client.Database(database)
+	if len(collections) == 0 {
+		names, err := db.ListCollectionNames(ctx, bson.D{{Key: "type", Value: "collection"}})
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for _, name := range names {
+			if !strings.HasPrefix(name, "system.") {
+				collections = append(collections, name)
+			}
+		}
+	}
+	for _, collection := range collections {
+		cmd := bson.D{
+			{Key: "collMod", Value: collection},
+			{Key: "changeStreamPreAndPostImages", Value: bson.D{{Key: "enabled", Value: true}}},
+		}
+		if err := db.RunCommand(ctx, cmd).Err(); err != nil {
+			return errors.Annotatef(err, "enable changeStreamPreAndPostImages on %s.%s", database, collection)
+		}
+		log.Infof("enable changeStreamPreAndPostImages on %s.%s", database, collection)
+	}
+	return nil
+}
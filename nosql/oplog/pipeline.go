@@ -0,0 +1,88 @@
+package oplog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/xuenqlve/common/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// NamespaceFilter change stream 服务端过滤的库及集合，均为 glob，与 mongodb_schema.TableFilterConfig 的匹配规则一致
+type NamespaceFilter struct {
+	Database         string   `mapstructure:"database" json:"database" toml:"database" yaml:"database"`
+	AcceptCollection []string `mapstructure:"accept-collection" json:"accept-collection" toml:"accept-collection" yaml:"accept-collection"`
+	IgnoreCollection []string `mapstructure:"ignore-collection" json:"ignore-collection" toml:"ignore-collection" yaml:"ignore-collection"`
+}
+
+func (f NamespaceFilter) match() bson.D {
+	cond := bson.D{{Key: "ns.db", Value: bson.D{{Key: "$regex", Value: globRegex(f.Database)}}}}
+	// dropDatabase 等库级别事件没有 ns.coll
+	accept := bson.A{bson.D{{Key: "ns.coll", Value: bson.D{{Key: "$exists", Value: false}}}}}
+	if len(f.AcceptCollection) > 0 {
+		accept = append(accept, bson.D{{Key: "ns.coll", Value: bson.D{{Key: "$regex", Value: globRegex(f.AcceptCollection...)}}}})
+	} else {
+		accept = append(accept, bson.D{{Key: "ns.coll", Value: bson.D{{Key: "$exists", Value: true}}}})
+	}
+	ignore := append([]string{"system.*"}, f.IgnoreCollection...)
+	return append(cond,
+		bson.E{Key: "$or", Value: accept},
+		bson.E{Key: "ns.coll", Value: bson.D{{Key: "$not", Value: bson.D{{Key: "$regex", Value: globRegex(ignore...)}}}}},
+	)
+}
+
+// globRegex glob 转为完整匹配的正则，多个 glob 之间为或
+func globRegex(globs ...string) string {
+	exprs := make([]string, 0, len(globs))
+	for _, glob := range globs {
+		parts := strings.Split(glob, "*")
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		exprs = append(exprs, strings.Join(parts, ".*"))
+	}
+	return "^(?:" + strings.Join(exprs, "|") + ")$"
+}
+
+// ParsePipeline 解析 extended JSON 格式的聚合管道，如 [{"$match": {"operationType": "insert"}}]
+func ParsePipeline(pipeline string) (mongo.Pipeline, error) {
+	if strings.TrimSpace(pipeline) == "" {
+		return mongo.Pipeline{}, nil
+	}
+	var wrapper struct {
+		Pipeline mongo.Pipeline `bson:"pipeline"`
+	}
+	if err := bson.UnmarshalExtJSON([]byte(fmt.Sprintf(`{"pipeline": %s}`, pipeline)), false, &wrapper); err != nil {
+		return nil, errors.Annotatef(err, "parse pipeline %s", pipeline)
+	}
+	return wrapper.Pipeline, nil
+}
+
+// BuildPipeline 由库表过滤及操作类型生成 $match，之后追加用户的管道
+func BuildPipeline(filters []NamespaceFilter, operationTypes []string, pipeline string) (mongo.Pipeline, error) {
+	user, err := ParsePipeline(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	conds := bson.A{}
+	if len(filters) > 0 {
+		namespaces := make(bson.A, 0, len(filters))
+		for _, filter := range filters {
+			if filter.Database == "" {
+				return nil, fmt.Errorf("namespace filter need database")
+			}
+			namespaces = append(namespaces, filter.match())
+		}
+		conds = append(conds, bson.D{{Key: "$or", Value: namespaces}})
+	}
+	if len(operationTypes) > 0 {
+		conds = append(conds, bson.D{{Key: "operationType", Value: bson.D{{Key: "$in", Value: operationTypes}}}})
+	}
+	result := make(mongo.Pipeline, 0, len(user)+1)
+	if len(conds) > 0 {
+		result = append(result, bson.D{{Key: "$match", Value: bson.D{{Key: "$and", Value: conds}}}})
+	}
+	return append(result, user...), nil
+}
@@ -0,0 +1,33 @@
+package oplog
+
+import (
+	"regexp"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestBuildPipeline(t *testing.T) {
+	pipeline, err := BuildPipeline([]NamespaceFilter{{Database: "shard_*", AcceptCollection: []string{"orders_*"}, IgnoreCollection: []string{"orders_tmp"}}},
+		[]string{insertOperation, updateOperation}, `[{"$project": {"fullDocument.secret": 0}}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pipeline) != 2 || pipeline[0][0].Key != "$match" || pipeline[1][0].Key != "$project" {
+		t.Fatalf("pipeline: %v", pipeline)
+	}
+	if _, err = bson.Marshal(bson.D{{Key: "pipeline", Value: pipeline}}); err != nil {
+		t.Fatal(err)
+	}
+
+	re := regexp.MustCompile(globRegex("orders_*", "users"))
+	for name, expected := range map[string]bool{"orders_1": true, "users": true, "users_1": false, "xorders_1": false} {
+		if re.MatchString(name) != expected {
+			t.Fatalf("%s match %v", name, !expected)
+		}
+	}
+
+	if _, err = ParsePipeline(`{"$match": {}}`); err == nil {
+		t.Fatal("expected error for non-array pipeline")
+	}
+}
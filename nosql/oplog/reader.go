@@ -3,6 +3,7 @@ package oplog
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/xuenqlve/common/data_source/mongodb"
@@ -27,6 +28,34 @@ type ReaderConfig struct {
 	CommitCount      int64    `mapstructure:"commit-count" json:"commit-count" yaml:"commit-count" toml:"commit-count"`
 	BufferCapacity   int      `mapstructure:"buffer-capacity" yaml:"buffer-capacity" json:"buffer-capacity"`
 	ReaderBufferTime int      `mapstructure:"reader-buffer-time" yaml:"reader-buffer-time" toml:"reader-buffer-time"`
+
+	// Filters 服务端过滤的库及集合，可由 mongodb_schema.TableConfigs.NamespaceFilters 生成
+	Filters []NamespaceFilter `mapstructure:"filters" json:"filters" toml:"filters" yaml:"filters"`
+	// OperationTypes 只接收的操作类型，如 insert、update、delete
+	OperationTypes []string `mapstructure:"operation-types" json:"operation-types" toml:"operation-types" yaml:"operation-types"`
+	// WatchDatabase、WatchCollection 只监听单个库或集合，为空时监听整个集群
+	WatchDatabase   string `mapstructure:"watch-database" json:"watch-database" toml:"watch-database" yaml:"watch-database"`
+	WatchCollection string `mapstructure:"watch-collection" json:"watch-collection" toml:"watch-collection" yaml:"watch-collection"`
+
+	// FullDocument 更新事件的后镜像 updateLookup（默认）、whenAvailable、required
+	FullDocument string `mapstructure:"full-document" json:"full-document" toml:"full-document" yaml:"full-document"`
+	// FullDocumentBeforeChange 更新、删除事件的前镜像 off、whenAvailable、required，需要集合开启 changeStreamPreAndPostImages
+	FullDocumentBeforeChange string `mapstructure:"full-document-before-change" json:"full-document-before-change" toml:"full-document-before-change" yaml:"full-document-before-change"`
+
+	// TxnBufferSize 事务在内存中缓存的事件数，超出部分写入 TxnSpillDir 下的临时文件
+	TxnBufferSize int    `mapstructure:"txn-buffer-size" json:"txn-buffer-size" toml:"txn-buffer-size" yaml:"txn-buffer-size"`
+	TxnSpillDir   string `mapstructure:"txn-spill-dir" json:"txn-spill-dir" toml:"txn-spill-dir" yaml:"txn-spill-dir"`
+	// TxnWaitTime 没有新事件时 getMore 的等待时间（毫秒）。change stream 中事务的事件没有结束标记，
+	// 返回空批次时已读取的事务事件已经全部返回，此时才认为事务结束，而不是按等待超时判断
+	TxnWaitTime int `mapstructure:"txn-wait-time" json:"txn-wait-time" toml:"txn-wait-time" yaml:"txn-wait-time"`
+
+	// ShardMode 分片集群的读取方式 mongos（默认）、direct，见 ShardModeDirect
+	ShardMode string `mapstructure:"shard-mode" json:"shard-mode" toml:"shard-mode" yaml:"shard-mode"`
+	// ShardLagInterval 统计各分片延迟的间隔（秒）
+	ShardLagInterval int `mapstructure:"shard-lag-interval" json:"shard-lag-interval" toml:"shard-lag-interval" yaml:"shard-lag-interval"`
+
+	// ResumeExpiredPolicy 位点已不在 oplog 中时的处理方式 fail（默认）、oldest、resnapshot
+	ResumeExpiredPolicy string `mapstructure:"resume-expired-policy" json:"resume-expired-policy" toml:"resume-expired-policy" yaml:"resume-expired-policy"`
 }
 
 func (c *ReaderConfig) connect() (*mongo.Client, error) {
@@ -50,17 +79,41 @@ type Reader struct {
 
 	eventReader  *EventReader
 	eventHandler EventHandler
+	// source 副本集及经 mongos 读取时为 eventReader，直连分片时为 shardMerger
+	source     eventSource
+	lagMonitor *shardLagMonitor
+	// readTs 最后处理事件的 clusterTime
+	readTs atomic.Int64
 
 	currentPosition Position
 	// 用于按时间间隔提交位点
 	lastCommitTime time.Time
 	// 用于按消息数量提交位点
 	messageCount int64
-	// 用于按事务维度提交位点
-	currentTxnID primitive.ObjectID
+	// 未结束的多文档事务
+	txn *Transaction
+	// timestampOnly 位点只记录时间戳，tail oplog.rs 转换的事件没有 resume token
+	timestampOnly bool
 }
 
+// NewOplogReader pipeline 为 extended JSON 格式的聚合管道，追加在 cfg.Filters 生成的 $match 之后
 func NewOplogReader(ctx context.Context, pipeline string, cfg ReaderConfig) (reader *Reader, err error) {
+	if cfg.WatchCollection != "" && cfg.WatchDatabase == "" {
+		return nil, fmt.Errorf("oplog reader watch-collection %s need watch-database", cfg.WatchCollection)
+	}
+	if err = checkFullDocument(cfg.FullDocument, cfg.FullDocumentBeforeChange); err != nil {
+		return nil, err
+	}
+	if err = checkShardMode(cfg.ShardMode); err != nil {
+		return nil, err
+	}
+	if err = checkResumeExpiredPolicy(cfg.ResumeExpiredPolicy); err != nil {
+		return nil, err
+	}
+	stages, err := BuildPipeline(cfg.Filters, cfg.OperationTypes, pipeline)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
 	reader = &Reader{
 		ctx:             ctx,
 		pipeline:        pipeline,
@@ -69,8 +122,8 @@ func NewOplogReader(ctx context.Context, pipeline string, cfg ReaderConfig) (rea
 		currentPosition: cfg.StartPosition,
 		lastCommitTime:  time.Now(),
 		messageCount:    0,
-		currentTxnID:    primitive.NilObjectID,
 	}
+	reader.eventReader.SetPipeline(stages)
 	return reader, nil
 }
 
@@ -89,146 +142,361 @@ const (
 	renameOperation     = "rename"
 	modifyOperation     = "modify"
 	invalidateOperation = "invalidate"
+
+	// showExpandedEvents 时经过 mongos 的 change stream 才会产生，不影响数据
+	shardCollectionOperation          = "shardCollection"
+	reshardCollectionOperation        = "reshardCollection"
+	refineCollectionShardKeyOperation = "refineCollectionShardKey"
 )
 
+// isShardingOperation 分片相关的事件，跳过并提交位点
+func isShardingOperation(operationType string) bool {
+	switch operationType {
+	case shardCollectionOperation, reshardCollectionOperation, refineCollectionShardKeyOperation:
+		return true
+	}
+	return false
+}
+
 func (r *Reader) SetEventHandler(h EventHandler) {
 	r.eventHandler = h
 }
 func (r *Reader) Run() error {
-	if r.eventHandler == nil {
-		return fmt.Errorf("event hander is nil")
+	if err := r.checkHandler(); err != nil {
+		return err
 	}
 	if err := r.eventHandler.OnPosSynced(r.currentPosition, false); err != nil {
 		return errors.Trace(err)
 	}
+	if err := r.initShards(); err != nil {
+		return errors.Trace(err)
+	}
 	r.eventReader.SetQueryTimestampOnEmpty(r.currentPosition)
-	r.eventReader.Start()
+	r.source.Start()
+	defer r.closeTransaction()
 	for {
-		rowlogs, err := r.eventReader.Next()
+		rowlogs, err := r.source.Next()
 		if err != nil {
-			return errors.Trace(err)
+			if err = r.recoverExpired(err); err != nil {
+				return errors.Trace(err)
+			}
+			continue
+		}
+		if rowlogs == nil {
+			// 空批次，事务的事件已经全部读取
+			if err = r.flushTransaction(); err != nil {
+				return errors.Trace(err)
+			}
+			continue
 		}
 		event := Event{}
 		if err = bson.Unmarshal(rowlogs, &event); err != nil {
 			return errors.Trace(err)
 		}
+		if err = r.processEvent(event, rowlogs); err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
 
-		// 检查是否需要按事务维度提交位点
-		if event.LSID != nil && event.TxnNumber != nil {
-			// 提取事务ID
-			var lsid struct {
-				ID primitive.ObjectID `bson:"id"`
-			}
-			if err = bson.Unmarshal(event.LSID, &lsid); err == nil && !lsid.ID.IsZero() {
-				// 如果事务ID发生变化，则提交位点
-				if r.currentTxnID != primitive.NilObjectID && r.currentTxnID != lsid.ID {
-					if err = r.commitPosition(event); err != nil {
-						return errors.Trace(err)
-					}
-				}
-				r.currentTxnID = lsid.ID
-			}
+func (r *Reader) checkHandler() error {
+	if r.eventHandler == nil {
+		return fmt.Errorf("event hander is nil")
+	}
+	if _, ok := r.eventHandler.(ResnapshotHandler); !ok && r.cfg.ResumeExpiredPolicy == ResumeExpiredResnapshot {
+		return fmt.Errorf("resume-expired-policy resnapshot need event handler implements ResnapshotHandler")
+	}
+	return nil
+}
+
+// processEvent 事务内的事件先缓存，其余事件直接回调并按规则提交位点，raw 为事件的 bson 用于事务溢出
+func (r *Reader) processEvent(event Event, raw []byte) (err error) {
+	r.eventHandler.SyncedTimestamp(event.ClusterTime.T)
+	r.readTs.Store(TimeStampToInt64(event.ClusterTime))
+
+	// 事务内的事件连续出现，(lsid, txnNumber) 变化或出现非事务事件即为事务结束
+	key, inTxn := eventTxnKey(event)
+	if r.txn != nil && (!inTxn || r.txn.key != key) {
+		if err = r.flushTransaction(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if inTxn {
+		if r.txn == nil {
+			r.txn = newTransaction(key, event, r.cfg.TxnBufferSize, r.cfg.TxnSpillDir)
 		}
+		return r.txn.add(event, raw)
+	}
 
-		r.eventHandler.SyncedTimestamp(event.ClusterTime.T)
-		// 处理各种操作类型的事件
-		switch event.OperationType {
-		case insertOperation:
-			var database, collection string
-			if database, collection, err = SplitNamespace(event.Ns); err != nil {
-				return errors.Trace(err)
-			}
-			if err = r.eventHandler.OnInsertEvent(database, collection, event.FullDocument); err != nil {
-				return errors.Trace(err)
-			}
-		case deleteOperation:
-			var database, collection string
-			if database, collection, err = SplitNamespace(event.Ns); err != nil {
-				return errors.Trace(err)
-			}
-			if err = r.eventHandler.OnDeleteEvent(database, collection, event.DocumentKey); err != nil {
-				return errors.Trace(err)
-			}
-		case replaceOperation:
-			var database, collection string
-			if database, collection, err = SplitNamespace(event.Ns); err != nil {
-				return errors.Trace(err)
-			}
-			log.Infof("event:%v", event)
-			object := bson.D{{"$set", event.FullDocument}}
-			if err = r.eventHandler.OnUpdateEvent(database, collection, event.DocumentKey, object); err != nil {
-				return errors.Trace(err)
-			}
-		case updateOperation:
-			object := bson.D{}
-			var database, collection string
-			if database, collection, err = SplitNamespace(event.Ns); err != nil {
-				return errors.Trace(err)
-			}
-			if event.FullDocument != nil {
-				object = bson.D{{"$set", event.FullDocument}}
-			} else {
-				object = make(bson.D, 0, 2)
-				if updatedFields, ok := event.UpdateDescription["updatedFields"]; ok && len(updatedFields.(bson.M)) > 0 {
-					object = append(object, primitive.E{
-						Key:   "$set",
-						Value: updatedFields,
-					})
-				}
-				if removedFields, ok := event.UpdateDescription["removedFields"]; ok && len(removedFields.(primitive.A)) > 0 {
-					removedFieldsMap := make(bson.M)
-					for _, ele := range removedFields.(primitive.A) {
-						removedFieldsMap[ele.(string)] = 1
-					}
-					object = append(object, primitive.E{
-						Key:   "$unset",
-						Value: removedFieldsMap,
-					})
-				}
-			}
-			if err = r.eventHandler.OnUpdateEvent(database, collection, event.DocumentKey, object); err != nil {
-				return errors.Trace(err)
-			}
-		case dropOperation, dropDatabaseOperation, renameOperation:
-			if err = r.eventHandler.OnDDLEvent(event); err != nil {
-				return errors.Trace(err)
-			}
-			// DDL操作立即提交位点
-			if err = r.commitPosition(event); err != nil {
-				return errors.Trace(err)
-			}
-		case createOperation, createIndexesOperation, dropIndexesOperation:
-			return fmt.Errorf("unknown event type[%v] org_event[%v]", event.OperationType, event)
-		case invalidateOperation:
-			return fmt.Errorf("invalidate event happen, should be handle manually: %s", event)
-		default:
-			return fmt.Errorf("unknown event type[%v] org_event[%v]", event.OperationType, event)
+	var commit bool
+	if commit, err = r.handleEvent(event); err != nil {
+		return errors.Trace(err)
+	}
+	// DDL操作立即提交位点
+	if commit {
+		return r.commitPosition(event)
+	}
+	return r.checkCommit(event, 1)
+}
+
+// eventSource Next 返回 nil, nil 表示 change stream 返回了空批次，之前的事件所在的事务已经结束
+type eventSource interface {
+	Start()
+	Next() ([]byte, error)
+}
+
+// initShards 识别分片集群，启动分片延迟统计，direct 模式改为直连各分片读取
+func (r *Reader) initShards() error {
+	r.source = r.eventReader
+	client, err := r.cfg.connect()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer func() {
+		if err := client.Disconnect(context.Background()); err != nil {
+			log.Errorf("oplog reader disconnect err:%v", err)
+		}
+	}()
+	sharded, err := IsSharded(r.ctx, client)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if !sharded {
+		if r.cfg.ShardMode == ShardModeDirect {
+			return fmt.Errorf("oplog reader shard-mode direct need connect to mongos")
 		}
+		return nil
+	}
+	shards, err := ListShards(r.ctx, client)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	log.Infof("oplog reader found sharded cluster with %d shards, shard-mode %s", len(shards), r.cfg.ShardMode)
 
-		// 递增消息计数器
-		r.messageCount++
+	if r.cfg.ShardMode == ShardModeDirect {
+		if r.source, err = newShardMerger(r.ctx, r.cfg, r.eventReader.pipeline, shards, r.currentPosition); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	interval := r.cfg.ShardLagInterval
+	if interval <= 0 {
+		interval = DefaultShardLagInterval
+	}
+	r.lagMonitor = newShardLagMonitor(r.cfg, shards, func() primitive.Timestamp {
+		return Int64ToTimestamp(r.readTs.Load())
+	})
+	go r.lagMonitor.run(r.ctx, time.Duration(interval)*time.Second)
+	return nil
+}
 
-		// 按消息数量提交位点
-		if r.cfg.CommitCount > 0 && r.messageCount >= r.cfg.CommitCount {
-			if err = r.commitPosition(event); err != nil {
-				return errors.Trace(err)
-			}
+// recoverExpired 按 ResumeExpiredPolicy 处理位点过期，其他错误原样返回
+func (r *Reader) recoverExpired(err error) error {
+	pos, err := r.expiredPosition(err)
+	if err != nil {
+		return err
+	}
+	if merger, ok := r.source.(*shardMerger); ok {
+		merger.Close()
+		if merger, err = newShardMerger(r.ctx, r.cfg, r.eventReader.pipeline, merger.shards, pos); err != nil {
+			return errors.Trace(err)
 		}
+		r.source = merger
+		merger.Start()
+		return nil
+	}
+	r.eventReader.Restart(pos)
+	return nil
+}
 
-		// 按时间间隔提交位点
-		if r.cfg.CommitInterval > 0 && time.Since(r.lastCommitTime).Milliseconds() >= r.cfg.CommitInterval {
-			if err = r.commitPosition(event); err != nil {
-				return errors.Trace(err)
+// expiredPosition 按 ResumeExpiredPolicy 得到继续读取的位点并提交，无法恢复时返回原错误
+func (r *Reader) expiredPosition(err error) (Position, error) {
+	expired, ok := AsResumeExpiredError(err)
+	if !ok {
+		return Position{}, err
+	}
+	var pos Position
+	switch r.cfg.ResumeExpiredPolicy {
+	case ResumeExpiredOldest:
+		if expired.Oldest == 0 {
+			return Position{}, err
+		}
+		log.Warnf("%v, restart from the oldest oplog", expired)
+		pos = Position{Timestamp: expired.Oldest}
+	case ResumeExpiredResnapshot:
+		log.Warnf("%v, resnapshot", expired)
+		if pos, err = r.eventHandler.(ResnapshotHandler).OnResumeExpired(expired); err != nil {
+			return Position{}, errors.Annotatef(err, "resnapshot")
+		}
+	default:
+		return Position{}, err
+	}
+
+	// 未结束的事务已经不完整
+	r.closeTransaction()
+	r.currentPosition = pos
+	if err = r.eventHandler.OnPosSynced(pos, true); err != nil {
+		return Position{}, errors.Trace(err)
+	}
+	r.messageCount = 0
+	r.lastCommitTime = time.Now()
+	return pos, nil
+}
+
+// ShardLags 各分片的延迟，非分片集群返回 nil
+func (r *Reader) ShardLags() []ShardLag {
+	if r.lagMonitor == nil {
+		return nil
+	}
+	return r.lagMonitor.snapshot()
+}
+
+// flushTransaction 交付缓存的事务并在其最后一个事件处提交位点
+func (r *Reader) flushTransaction() error {
+	txn := r.txn
+	if txn == nil {
+		return nil
+	}
+	defer r.closeTransaction()
+	if handler, ok := r.eventHandler.(TransactionHandler); ok {
+		if err := handler.OnTransaction(txn); err != nil {
+			return errors.Trace(err)
+		}
+	} else {
+		err := txn.Range(func(event Event) error {
+			_, err := r.handleEvent(event)
+			return err
+		})
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return r.commitPosition(txn.last)
+}
+
+func (r *Reader) closeTransaction() {
+	if r.txn != nil {
+		r.txn.close()
+		r.txn = nil
+	}
+}
+
+// checkCommit 按消息数量及时间间隔提交位点
+func (r *Reader) checkCommit(event Event, count int64) error {
+	r.messageCount += count
+
+	if r.cfg.CommitCount > 0 && r.messageCount >= r.cfg.CommitCount {
+		return r.commitPosition(event)
+	}
+	if r.cfg.CommitInterval > 0 && time.Since(r.lastCommitTime).Milliseconds() >= r.cfg.CommitInterval {
+		return r.commitPosition(event)
+	}
+	return nil
+}
+
+func (r *Reader) onUpdate(database, collection string, event Event, object bson.D) error {
+	if handler, ok := r.eventHandler.(ImageEventHandler); ok {
+		return handler.OnUpdateImageEvent(database, collection, event.DocumentKey, object, event.FullDocumentBeforeChange, event.FullDocument)
+	}
+	return r.eventHandler.OnUpdateEvent(database, collection, event.DocumentKey, object)
+}
+
+// handleEvent 回调单条事件，DDL 返回 commit 为 true
+func (r *Reader) handleEvent(event Event) (commit bool, err error) {
+	if handler, ok := r.eventHandler.(ChangeEventHandler); ok {
+		switch event.OperationType {
+		case insertOperation, deleteOperation, replaceOperation, updateOperation:
+			var changeEvent *ChangeEvent
+			if changeEvent, err = NewChangeEvent(event); err != nil {
+				return false, errors.Trace(err)
 			}
+			return false, errors.Trace(handler.OnChangeEvent(changeEvent))
 		}
 	}
+	switch event.OperationType {
+	case insertOperation:
+		var database, collection string
+		if database, collection, err = SplitNamespace(event.Ns); err != nil {
+			return false, errors.Trace(err)
+		}
+		if err = r.eventHandler.OnInsertEvent(database, collection, event.FullDocument); err != nil {
+			return false, errors.Trace(err)
+		}
+	case deleteOperation:
+		var database, collection string
+		if database, collection, err = SplitNamespace(event.Ns); err != nil {
+			return false, errors.Trace(err)
+		}
+		if handler, ok := r.eventHandler.(ImageEventHandler); ok {
+			err = handler.OnDeleteImageEvent(database, collection, event.DocumentKey, event.FullDocumentBeforeChange)
+		} else {
+			err = r.eventHandler.OnDeleteEvent(database, collection, event.DocumentKey)
+		}
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+	case replaceOperation:
+		var database, collection string
+		if database, collection, err = SplitNamespace(event.Ns); err != nil {
+			return false, errors.Trace(err)
+		}
+		// $set 无法删除替换后不存在的字段，需要完整替换时实现 ReplaceEventHandler 或 ChangeEventHandler
+		if handler, ok := r.eventHandler.(ReplaceEventHandler); ok {
+			err = handler.OnReplaceEvent(database, collection, event.DocumentKey, event.FullDocument)
+		} else {
+			err = r.onUpdate(database, collection, event, bson.D{{Key: "$set", Value: event.FullDocument}})
+		}
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+	case updateOperation:
+		var database, collection string
+		if database, collection, err = SplitNamespace(event.Ns); err != nil {
+			return false, errors.Trace(err)
+		}
+		if event.FullDocument != nil {
+			object := bson.D{{Key: "$set", Value: event.FullDocument}}
+			if err = r.onUpdate(database, collection, event, object); err != nil {
+				return false, errors.Trace(err)
+			}
+			break
+		}
+		// 截断的数组与更新字段冲突时按顺序回调多次
+		for _, object := range event.UpdateDescription.UpdateDocuments() {
+			if err = r.onUpdate(database, collection, event, object); err != nil {
+				return false, errors.Trace(err)
+			}
+		}
+	case dropOperation, dropDatabaseOperation, renameOperation,
+		createOperation, createIndexesOperation, dropIndexesOperation, modifyOperation:
+		// create、createIndexes、dropIndexes、modify 需要 showExpandedEvents，由 mongodb_schema.OplogDDLLoader 解析
+		if err = r.eventHandler.OnDDLEvent(event); err != nil {
+			return false, errors.Trace(err)
+		}
+		return true, nil
+	case invalidateOperation:
+		return false, fmt.Errorf("invalidate event happen, should be handle manually: %s", event.String())
+	default:
+		if isShardingOperation(event.OperationType) {
+			log.Infof("skip %s event on %v", event.OperationType, event.Ns)
+			return true, nil
+		}
+		return false, fmt.Errorf("unknown event type[%v] org_event[%v]", event.OperationType, event)
+	}
+	return false, nil
 }
 
 // commitPosition 提交当前位点并重置计数器
 func (r *Reader) commitPosition(event Event) error {
-	token, err := r.eventReader.ResumeToken()
-	if err != nil {
-		return errors.Trace(err)
+	// 读取协程会先于处理拉取下一条事件，使用事件自身的 _id 作为 resume token
+	var (
+		token bson.Raw
+		err   error
+	)
+	// 直连分片时 resume token 只对单个分片有效
+	if _, ok := r.source.(*shardMerger); !ok && !r.timestampOnly {
+		if token, err = eventResumeToken(event); err != nil {
+			return errors.Trace(err)
+		}
 	}
 
 	currentPos := Position{
@@ -266,3 +534,14 @@ func SplitNamespace(ns bson.M) (string, string, error) {
 	}
 	return fmt.Sprintf("%v", database), fmt.Sprintf("%s", table), nil
 }
+
+func eventResumeToken(event Event) (bson.Raw, error) {
+	if len(event.Id) == 0 {
+		return nil, errors.New("empty resume token")
+	}
+	token, err := bson.Marshal(event.Id)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return token, nil
+}
@@ -0,0 +1,66 @@
+package oplog
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type recordHandler struct {
+	updates []bson.D
+	ddl     int
+}
+
+func (h *recordHandler) OnInsertEvent(database, collection string, object bson.D) error { return nil }
+
+func (h *recordHandler) OnDeleteEvent(database, collection string, key bson.D) error { return nil }
+
+func (h *recordHandler) OnUpdateEvent(database, collection string, key bson.D, object bson.D) error {
+	h.updates = append(h.updates, object)
+	return nil
+}
+
+func (h *recordHandler) OnDDLEvent(event Event) error {
+	h.ddl++
+	return nil
+}
+
+func (h *recordHandler) OnPosSynced(pos Position, force bool) error { return nil }
+
+func (h *recordHandler) SyncedTimestamp(timestamp uint32) {}
+
+func TestHandleShardingEvent(t *testing.T) {
+	handler := &recordHandler{}
+	r := &Reader{eventHandler: handler}
+	for _, operationType := range []string{shardCollectionOperation, reshardCollectionOperation, refineCollectionShardKeyOperation} {
+		event := Event{OperationType: operationType, Ns: bson.M{"db": "db", "coll": "c"}}
+		commit, err := r.handleEvent(event)
+		if err != nil || !commit {
+			t.Fatalf("%s: commit %v err %v", operationType, commit, err)
+		}
+		raw, _ := bson.Marshal(event)
+		oplog, err := ConverteventOplog(raw, false)
+		if err != nil || oplog.Operation != "n" {
+			t.Fatalf("%s convert: %+v %v", operationType, oplog, err)
+		}
+	}
+	if handler.ddl != 0 || len(handler.updates) != 0 {
+		t.Fatalf("sharding events should not reach handler: %+v", handler)
+	}
+	if _, err := r.handleEvent(Event{OperationType: "unknownOperation"}); err == nil {
+		t.Fatal("unknown event should fail")
+	}
+}
+
+func TestHandleReplaceEvent(t *testing.T) {
+	handler := &recordHandler{}
+	r := &Reader{eventHandler: handler}
+	document := bson.D{{Key: "_id", Value: 1}, {Key: "a", Value: 2}}
+	event := Event{OperationType: replaceOperation, Ns: bson.M{"db": "db", "coll": "c"}, DocumentKey: bson.D{{Key: "_id", Value: 1}}, FullDocument: document}
+	if _, err := r.handleEvent(event); err != nil {
+		t.Fatal(err)
+	}
+	if len(handler.updates) != 1 || len(handler.updates[0]) != 1 || handler.updates[0][0].Key != "$set" {
+		t.Fatalf("replace should reach OnUpdateEvent as $set: %+v", handler.updates)
+	}
+}
@@ -0,0 +1,137 @@
+package oplog
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/xuenqlve/common/errors"
+	"github.com/xuenqlve/common/log"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// ResumeExpiredFail 位点过期时返回 ResumeExpiredError（默认）
+	ResumeExpiredFail = "fail"
+	// ResumeExpiredOldest 从最早可用的 oplog 继续读取，中间的变更会丢失
+	ResumeExpiredOldest = "oldest"
+	// ResumeExpiredResnapshot 回调 ResnapshotHandler 重新全量后从其返回的位点继续读取
+	ResumeExpiredResnapshot = "resnapshot"
+)
+
+const (
+	errCodeInvalidResumeToken      = 260
+	errCodeChangeStreamFatalError  = 280
+	errCodeChangeStreamHistoryLost = 286
+)
+
+// ResumeExpiredError 位点已经不在 oplog 中，无法继续读取；Oldest 为当前最早可用的时间戳，获取失败时为 0
+type ResumeExpiredError struct {
+	Position Position
+	Oldest   int64
+	Err      error
+}
+
+func (e *ResumeExpiredError) Error() string {
+	return fmt.Sprintf("resume position %v expired, oldest oplog timestamp %v: %v", e.Position, Int64ToTimestamp(e.Oldest), e.Err)
+}
+
+func (e *ResumeExpiredError) Unwrap() error {
+	return e.Err
+}
+
+// AsResumeExpiredError 判断 Reader 返回的错误是否为位点过期
+func AsResumeExpiredError(err error) (*ResumeExpiredError, bool) {
+	expired, ok := errors.Cause(err).(*ResumeExpiredError)
+	return expired, ok
+}
+
+// ResnapshotHandler EventHandler 可选实现，resume-expired-policy 为 resnapshot 时必须实现。
+// 位点过期时回调，由调用方重新全量同步并返回全量开始前记录的位点，Reader 从该位点继续读取
+type ResnapshotHandler interface {
+	OnResumeExpired(err *ResumeExpiredError) (Position, error)
+}
+
+func checkResumeExpiredPolicy(policy string) error {
+	switch policy {
+	case "", ResumeExpiredFail, ResumeExpiredOldest, ResumeExpiredResnapshot:
+		return nil
+	}
+	return fmt.Errorf("oplog reader resume-expired-policy %s must be fail, oldest or resnapshot", policy)
+}
+
+// isResumeExpired ChangeStreamHistoryLost、InvalidResumeToken，以及 4.0 及以下 resume token 找不到时的 ChangeStreamFatalError
+func isResumeExpired(err error) bool {
+	se, ok := errors.Cause(err).(mongo.ServerError)
+	if !ok {
+		return false
+	}
+	if se.HasErrorCode(errCodeChangeStreamHistoryLost) || se.HasErrorCode(errCodeInvalidResumeToken) {
+		return true
+	}
+	return se.HasErrorCode(errCodeChangeStreamFatalError) &&
+		strings.Contains(strings.ToLower(se.Error()), "resume of change stream was not possible")
+}
+
+// newResumeExpiredError start 为 change stream 的起始位置，int64 时间戳或 resume token
+func newResumeExpiredError(cfg ReaderConfig, start any, err error) *ResumeExpiredError {
+	expired := &ResumeExpiredError{Err: err}
+	if ts, ok := start.(int64); ok {
+		expired.Position.Timestamp = ts
+	} else {
+		expired.Position.Token = start
+	}
+	oldest, oldestErr := OldestTimestamp(context.Background(), cfg)
+	if oldestErr != nil {
+		log.Errorf("get oldest oplog timestamp err:%v", oldestErr)
+	}
+	expired.Oldest = oldest
+	return expired
+}
+
+// OldestTimestamp 最早可用的 oplog 时间戳，分片集群取各分片最早时间戳中的最大值
+func OldestTimestamp(ctx context.Context, cfg ReaderConfig) (int64, error) {
+	client, err := cfg.connect()
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer func() {
+		if err := client.Disconnect(context.Background()); err != nil {
+			log.Errorf("oplog reader disconnect err:%v", err)
+		}
+	}()
+	sharded, err := IsSharded(ctx, client)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if !sharded {
+		return GetOldestTimestampByConn(client)
+	}
+	shards, err := ListShards(ctx, client)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	var oldest int64
+	for _, shard := range shards {
+		shardCfg := cfg.shardConfig(shard)
+		ts, err := func() (int64, error) {
+			shardClient, err := shardCfg.connect()
+			if err != nil {
+				return 0, err
+			}
+			defer func() {
+				if err := shardClient.Disconnect(context.Background()); err != nil {
+					log.Errorf("shard %s disconnect err:%v", shard.ID, err)
+				}
+			}()
+			return GetOldestTimestampByConn(shardClient)
+		}()
+		if err != nil {
+			return 0, errors.Annotatef(err, "shard %s", shard.ID)
+		}
+		if ts > oldest {
+			oldest = ts
+		}
+	}
+	return oldest, nil
+}
@@ -0,0 +1,36 @@
+package oplog
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/xuenqlve/common/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestResumeExpired(t *testing.T) {
+	for _, c := range []struct {
+		err      error
+		expected bool
+	}{
+		{mongo.CommandError{Code: errCodeChangeStreamHistoryLost, Message: "history lost"}, true},
+		{mongo.CommandError{Code: errCodeInvalidResumeToken, Message: "invalid resume token"}, true},
+		{mongo.CommandError{Code: errCodeChangeStreamFatalError, Message: "Resume of change stream was not possible, as the resume point may no longer be in the oplog."}, true},
+		{mongo.CommandError{Code: errCodeChangeStreamFatalError, Message: "cannot resume stream; drop collection"}, false},
+		{mongo.CommandError{Code: 11600, Message: "interrupted at shutdown"}, false},
+		{fmt.Errorf("resume token was not found"), false},
+	} {
+		if isResumeExpired(errors.Trace(c.err)) != c.expected {
+			t.Fatalf("%v expired %v", c.err, !c.expected)
+		}
+	}
+
+	err := errors.Annotatef(&ResumeExpiredError{Position: Position{Timestamp: 1 << 32}, Oldest: 2 << 32}, "shard %s", "shard01")
+	expired, ok := AsResumeExpiredError(err)
+	if !ok || expired.Oldest != 2<<32 {
+		t.Fatalf("resume expired error: %v", err)
+	}
+	if _, ok = AsResumeExpiredError(errors.New("other")); ok {
+		t.Fatal("other error is not resume expired")
+	}
+}
@@ -0,0 +1,439 @@
+package oplog
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xuenqlve/common/errors"
+	"github.com/xuenqlve/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// ShardModeAuto 自动识别分片集群，经 mongos 读取并统计各分片延迟
+	ShardModeAuto = ""
+	// ShardModeMongos 同 ShardModeAuto
+	ShardModeMongos = "mongos"
+	// ShardModeDirect 直连各分片副本集读取，按 clusterTime 归并后输出，位点只有 Timestamp
+	ShardModeDirect = "direct"
+
+	DefaultShardLagInterval = 10 // s
+)
+
+// Shard listShards 返回的分片
+type Shard struct {
+	ID         string
+	ReplicaSet string
+	Hosts      []string
+}
+
+// IsSharded 连接的是否为 mongos
+func IsSharded(ctx context.Context, client *mongo.Client) (bool, error) {
+	res := bson.M{}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&res); err != nil {
+		return false, errors.Trace(err)
+	}
+	return res["msg"] == "isdbgrid", nil
+}
+
+// ListShards 列出集群的分片，需要连接 mongos
+func ListShards(ctx context.Context, client *mongo.Client) ([]Shard, error) {
+	var res struct {
+		Shards []struct {
+			ID   string `bson:"_id"`
+			Host string `bson:"host"`
+		} `bson:"shards"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "listShards", Value: 1}}).Decode(&res); err != nil {
+		return nil, errors.Annotatef(err, "list shards")
+	}
+	shards := make([]Shard, 0, len(res.Shards))
+	for _, item := range res.Shards {
+		shards = append(shards, parseShard(item.ID, item.Host))
+	}
+	return shards, nil
+}
+
+// parseShard host 格式为 rs/host1,host2
+func parseShard(id, host string) Shard {
+	replicaSet, hosts, found := strings.Cut(host, "/")
+	if !found {
+		replicaSet, hosts = "", host
+	}
+	return Shard{ID: id, ReplicaSet: replicaSet, Hosts: strings.Split(hosts, ",")}
+}
+
+// shardConfig 使用相同的账号连接分片副本集
+func (c ReaderConfig) shardConfig(shard Shard) ReaderConfig {
+	c.Host = shard.Hosts
+	c.ReplicaSet = shard.ReplicaSet
+	return c
+}
+
+func checkShardMode(mode string) error {
+	switch mode {
+	case ShardModeAuto, ShardModeMongos, ShardModeDirect:
+		return nil
+	}
+	return fmt.Errorf("oplog reader shard-mode %s must be mongos or direct", mode)
+}
+
+// resumeTokenTimestamp 解析 4.2+ resume token（_data 为 hex 编码的 KeyString）中的 clusterTime
+func resumeTokenTimestamp(token bson.Raw) (primitive.Timestamp, bool) {
+	if len(token) == 0 {
+		return primitive.Timestamp{}, false
+	}
+	data, ok := token.Lookup("_data").StringValueOK()
+	if !ok || len(data) < 18 || !strings.EqualFold(data[:2], "82") {
+		return primitive.Timestamp{}, false
+	}
+	raw, err := hex.DecodeString(data[2:18])
+	if err != nil {
+		return primitive.Timestamp{}, false
+	}
+	return primitive.Timestamp{T: binary.BigEndian.Uint32(raw[:4]), I: binary.BigEndian.Uint32(raw[4:])}, true
+}
+
+// ShardLag 分片最新 oplog 与已处理事件的差距。Lag 为读取落后该分片的时间，
+// 经 mongos 读取时最慢的分片会阻塞整个 change stream，其 Newest 会明显落后于其他分片
+type ShardLag struct {
+	Shard  string
+	Newest primitive.Timestamp
+	Read   primitive.Timestamp
+	Lag    time.Duration
+}
+
+type shardLagMonitor struct {
+	cfg     ReaderConfig
+	shards  []Shard
+	read    func() primitive.Timestamp
+	clients map[string]*mongo.Client
+
+	lock sync.RWMutex
+	lags map[string]ShardLag
+}
+
+func newShardLagMonitor(cfg ReaderConfig, shards []Shard, read func() primitive.Timestamp) *shardLagMonitor {
+	return &shardLagMonitor{
+		cfg:     cfg,
+		shards:  shards,
+		read:    read,
+		clients: make(map[string]*mongo.Client),
+		lags:    make(map[string]ShardLag),
+	}
+}
+
+func (m *shardLagMonitor) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer m.close()
+	for {
+		m.refresh()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *shardLagMonitor) refresh() {
+	read := m.read()
+	for _, shard := range m.shards {
+		newest, err := m.newest(shard)
+		if err != nil {
+			log.Warnf("get shard %s newest oplog err:%v", shard.ID, err)
+			continue
+		}
+		lag := ShardLag{Shard: shard.ID, Newest: newest, Read: read}
+		if newest.T > read.T {
+			lag.Lag = time.Duration(newest.T-read.T) * time.Second
+		}
+		m.lock.Lock()
+		m.lags[shard.ID] = lag
+		m.lock.Unlock()
+	}
+}
+
+func (m *shardLagMonitor) newest(shard Shard) (primitive.Timestamp, error) {
+	client, ok := m.clients[shard.ID]
+	if !ok {
+		cfg := m.cfg.shardConfig(shard)
+		var err error
+		if client, err = cfg.connect(); err != nil {
+			return primitive.Timestamp{}, err
+		}
+		m.clients[shard.ID] = client
+	}
+	newest, err := GetNewestTimestampByConn(client)
+	if err != nil {
+		return primitive.Timestamp{}, err
+	}
+	return Int64ToTimestamp(newest), nil
+}
+
+func (m *shardLagMonitor) snapshot() []ShardLag {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	lags := make([]ShardLag, 0, len(m.lags))
+	for _, lag := range m.lags {
+		lags = append(lags, lag)
+	}
+	sort.Slice(lags, func(i, j int) bool { return lags[i].Shard < lags[j].Shard })
+	return lags
+}
+
+func (m *shardLagMonitor) close() {
+	for id, client := range m.clients {
+		if err := client.Disconnect(context.Background()); err != nil {
+			log.Errorf("shard %s disconnect err:%v", id, err)
+		}
+	}
+	m.clients = make(map[string]*mongo.Client)
+}
+
+// shardItem raw 为空时只推进分片的水位
+type shardItem struct {
+	shard int
+	raw   []byte
+	ts    primitive.Timestamp
+}
+
+// shardMerger 直连各分片读取 change stream，所有分片的水位都不小于事件的 clusterTime 后才输出，
+// 保证输出按 clusterTime 有序。空闲分片依靠服务端定期写入的 noop 推进 postBatchResumeToken。
+// chunk 迁移产生的事件默认由服务端过滤
+type shardMerger struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	cfg      ReaderConfig
+	pipeline mongo.Pipeline
+	shards   []Shard
+	start    int64
+
+	items   chan shardItem
+	out     chan []byte
+	errChan chan error
+}
+
+func newShardMerger(ctx context.Context, cfg ReaderConfig, pipeline mongo.Pipeline, shards []Shard, start Position) (*shardMerger, error) {
+	if start.Token != nil && start.Timestamp <= InitCheckpoint {
+		return nil, fmt.Errorf("shard-mode direct can not start from resume token, need start-position.timestamp")
+	}
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("shard-mode direct found no shard")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &shardMerger{
+		ctx:      ctx,
+		cancel:   cancel,
+		cfg:      cfg,
+		pipeline: pipeline,
+		shards:   shards,
+		start:    start.Timestamp,
+		items:    make(chan shardItem, DefaultReaderFetchBatchSize),
+		out:      make(chan []byte),
+		errChan:  make(chan error),
+	}, nil
+}
+
+func (m *shardMerger) Start() {
+	for i := range m.shards {
+		go m.watch(i)
+	}
+	go m.merge()
+}
+
+func (m *shardMerger) watch(idx int) {
+	shard := m.shards[idx]
+	var start any
+	if m.start > InitCheckpoint {
+		start = m.start
+	}
+	for m.ctx.Err() == nil {
+		opened, err := m.stream(idx, &start)
+		if err != nil && m.ctx.Err() == nil {
+			expired := isResumeExpired(err)
+			if expired {
+				err = newResumeExpiredError(m.cfg, start, err)
+			}
+			if !opened || expired {
+				select {
+				case m.errChan <- errors.Annotatef(err, "shard %s", shard.ID):
+				case <-m.ctx.Done():
+				}
+				return
+			}
+			log.Errorf("shard %s change stream err:%v", shard.ID, err)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// stream 读取单个分片直到出错，start 记录最新的 resume token 用于重连
+func (m *shardMerger) stream(idx int, start *any) (opened bool, err error) {
+	cfg := m.cfg.shardConfig(m.shards[idx])
+	client, err := cfg.connect()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err := client.Disconnect(context.Background()); err != nil {
+			log.Errorf("shard %s disconnect err:%v", m.shards[idx].ID, err)
+		}
+	}()
+	stream, err := WatchStreamConn(m.ctx, client, DefaultReaderFetchBatchSize, *start, WatchConfig{
+		Database:   cfg.WatchDatabase,
+		Collection: cfg.WatchCollection,
+		Pipeline:   m.pipeline,
+
+		FullDocument:             options.FullDocument(cfg.FullDocument),
+		FullDocumentBeforeChange: options.FullDocument(cfg.FullDocumentBeforeChange),
+		MaxAwaitTime:             cfg.txnWaitTime(),
+	})
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err := stream.Close(context.Background()); err != nil {
+			log.Errorf("shard %s change stream close err:%v", m.shards[idx].ID, err)
+		}
+	}()
+
+	for {
+		if stream.TryNext(m.ctx) {
+			t, i, ok := stream.Current.Lookup("clusterTime").TimestampOK()
+			if !ok {
+				return true, fmt.Errorf("event without clusterTime: %s", stream.Current)
+			}
+			raw := make([]byte, len(stream.Current))
+			copy(raw, stream.Current)
+			if !m.send(shardItem{shard: idx, raw: raw, ts: primitive.Timestamp{T: t, I: i}}) {
+				return true, nil
+			}
+			*start = cloneRaw(stream.ResumeToken())
+			continue
+		}
+		if err = stream.Err(); err != nil {
+			return true, err
+		}
+		token := stream.ResumeToken()
+		if ts, ok := resumeTokenTimestamp(token); ok {
+			*start = cloneRaw(token)
+			if !m.send(shardItem{shard: idx, ts: ts}) {
+				return true, nil
+			}
+		}
+	}
+}
+
+func cloneRaw(raw bson.Raw) bson.Raw {
+	if raw == nil {
+		return nil
+	}
+	return append(bson.Raw{}, raw...)
+}
+
+func (m *shardMerger) send(item shardItem) bool {
+	select {
+	case m.items <- item:
+		return true
+	case <-m.ctx.Done():
+		return false
+	}
+}
+
+// merge 按水位合并各分片的事件；所有分片最后一次读取都是空批次且事件都已发送时发送 nil，通知事务结束
+func (m *shardMerger) merge() {
+	pending := make([][]shardItem, len(m.shards))
+	watermarks := make([]primitive.Timestamp, len(m.shards))
+	idle := make([]bool, len(m.shards))
+	idlePending := false
+	for {
+		select {
+		case item := <-m.items:
+			if item.ts.After(watermarks[item.shard]) {
+				watermarks[item.shard] = item.ts
+			}
+			idle[item.shard] = item.raw == nil
+			if item.raw != nil {
+				pending[item.shard] = append(pending[item.shard], item)
+			}
+		case <-m.ctx.Done():
+			return
+		}
+		for {
+			next := nextShardItem(pending, watermarks)
+			if next < 0 {
+				break
+			}
+			select {
+			case m.out <- pending[next][0].raw:
+			case <-m.ctx.Done():
+				return
+			}
+			pending[next] = pending[next][1:]
+			idlePending = true
+		}
+		if idlePending && allIdle(pending, idle) {
+			select {
+			case m.out <- nil:
+			case <-m.ctx.Done():
+				return
+			}
+			idlePending = false
+		}
+	}
+}
+
+func allIdle(pending [][]shardItem, idle []bool) bool {
+	for i := range pending {
+		if len(pending[i]) > 0 || !idle[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// nextShardItem clusterTime 最小且所有分片水位都已达到的分片，相同 clusterTime 取序号小的分片，没有时返回 -1
+func nextShardItem(pending [][]shardItem, watermarks []primitive.Timestamp) int {
+	next := -1
+	for i := range pending {
+		if len(pending[i]) > 0 && (next < 0 || pending[i][0].ts.Before(pending[next][0].ts)) {
+			next = i
+		}
+	}
+	if next < 0 {
+		return -1
+	}
+	for _, watermark := range watermarks {
+		if watermark.Before(pending[next][0].ts) {
+			return -1
+		}
+	}
+	return next
+}
+
+// Close 停止全部分片的读取
+func (m *shardMerger) Close() {
+	m.cancel()
+}
+
+func (m *shardMerger) Next() ([]byte, error) {
+	select {
+	case ret := <-m.out:
+		return ret, nil
+	case err := <-m.errChan:
+		return nil, err
+	case <-m.ctx.Done():
+		return nil, errors.New("shard merger context canceled")
+	}
+}
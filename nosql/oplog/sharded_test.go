@@ -0,0 +1,58 @@
+package oplog
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestShardMerge(t *testing.T) {
+	shard := parseShard("shard01", "rs01/h1:27018,h2:27018")
+	if shard.ReplicaSet != "rs01" || len(shard.Hosts) != 2 || shard.Hosts[1] != "h2:27018" {
+		t.Fatalf("shard: %+v", shard)
+	}
+
+	token, _ := bson.Marshal(bson.D{{Key: "_data", Value: "8265F1A2B3000000052B022C0100296E5A1004"}})
+	ts, ok := resumeTokenTimestamp(token)
+	if !ok || ts != (primitive.Timestamp{T: 0x65F1A2B3, I: 5}) {
+		t.Fatalf("resume token timestamp: %v %v", ts, ok)
+	}
+
+	pending := [][]shardItem{
+		{{shard: 0, raw: []byte{0}, ts: primitive.Timestamp{T: 10}}},
+		{{shard: 1, raw: []byte{1}, ts: primitive.Timestamp{T: 9}}},
+		nil,
+	}
+	watermarks := []primitive.Timestamp{{T: 10}, {T: 9}, {T: 8}}
+	if next := nextShardItem(pending, watermarks); next != -1 {
+		t.Fatalf("shard 2 watermark behind, got %d", next)
+	}
+	watermarks[2] = primitive.Timestamp{T: 9}
+	if next := nextShardItem(pending, watermarks); next != 1 {
+		t.Fatalf("expect shard 1, got %d", next)
+	}
+	pending[1] = nil
+	if next := nextShardItem(pending, watermarks); next != -1 {
+		t.Fatalf("shard 1 watermark behind, got %d", next)
+	}
+}
+
+func TestShardMergeIdle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := &shardMerger{ctx: ctx, shards: make([]Shard, 2), items: make(chan shardItem), out: make(chan []byte)}
+	go m.merge()
+
+	m.items <- shardItem{shard: 0, raw: []byte("a"), ts: primitive.Timestamp{T: 5}}
+	m.items <- shardItem{shard: 1, ts: primitive.Timestamp{T: 6}}
+	if raw := <-m.out; string(raw) != "a" {
+		t.Fatalf("event: %s", raw)
+	}
+	// shard 0 的事务可能还有下一批事件，不能通知
+	m.items <- shardItem{shard: 0, ts: primitive.Timestamp{T: 6}}
+	if raw := <-m.out; raw != nil {
+		t.Fatalf("idle: %s", raw)
+	}
+}
@@ -52,12 +52,36 @@ const (
 	DefaultReaderFetchBatchSize = 1024
 )
 
+// WatchConfig change stream 的监听范围及聚合管道，Database、Collection 为空时监听整个集群
+type WatchConfig struct {
+	Database   string
+	Collection string
+	Pipeline   mongo.Pipeline
+	// FullDocument 为空时使用 updateLookup，whenAvailable、required 需要集合开启 changeStreamPreAndPostImages
+	FullDocument options.FullDocument
+	// FullDocumentBeforeChange 变更前镜像 off、whenAvailable、required，为空时不返回
+	FullDocumentBeforeChange options.FullDocument
+	// MaxAwaitTime getMore 的等待时间，为空时 24 小时
+	MaxAwaitTime time.Duration
+}
+
 func MongoDBStreamConn(ctx context.Context, client *mongo.Client, batchSize int32, watchStartTime any) (conn *mongo.ChangeStream, err error) {
+	return WatchStreamConn(ctx, client, batchSize, watchStartTime, WatchConfig{})
+}
+
+func WatchStreamConn(ctx context.Context, client *mongo.Client, batchSize int32, watchStartTime any, watch WatchConfig) (conn *mongo.ChangeStream, err error) {
 	waitTime := changeStreamTimeout * time.Hour // hours
+	if watch.MaxAwaitTime > 0 {
+		waitTime = watch.MaxAwaitTime
+	}
 	ops := &options.ChangeStreamOptions{
 		MaxAwaitTime: &waitTime,
 		BatchSize:    &batchSize,
 	}
+	var sourceDbVersion string
+	if sourceDbVersion, err = GetDBVersion(ctx, client); err != nil {
+		return
+	}
 	if watchStartTime != nil {
 		if val, ok := watchStartTime.(int64); ok {
 			if (val >> 32) > 1 {
@@ -68,10 +92,6 @@ func MongoDBStreamConn(ctx context.Context, client *mongo.Client, batchSize int3
 				ops.SetStartAtOperationTime(startTime)
 			}
 		} else {
-			var sourceDbVersion string
-			if sourceDbVersion, err = GetDBVersion(ctx, client); err != nil {
-				return
-			}
 			var normalized bson.Raw
 			if normalized, err = normalizeResumeToken(watchStartTime); err != nil {
 				return nil, err
@@ -83,8 +103,31 @@ func MongoDBStreamConn(ctx context.Context, client *mongo.Client, batchSize int3
 			}
 		}
 	}
-	ops.SetFullDocument(options.UpdateLookup)
-	csHandler, err := client.Watch(ctx, mongo.Pipeline{}, ops)
+	// 6.0 起 create、createIndexes、dropIndexes、modify 等事件需要 showExpandedEvents，同时产生的 shardCollection 等分片事件会被跳过
+	if expanded, _ := GetAndCompareVersion(client, "6.0.0", sourceDbVersion); expanded {
+		ops.SetShowExpandedEvents(true)
+	}
+	if watch.FullDocument != "" {
+		ops.SetFullDocument(watch.FullDocument)
+	} else {
+		ops.SetFullDocument(options.UpdateLookup)
+	}
+	if watch.FullDocumentBeforeChange != "" {
+		ops.SetFullDocumentBeforeChange(watch.FullDocumentBeforeChange)
+	}
+	pipeline := watch.Pipeline
+	if pipeline == nil {
+		pipeline = mongo.Pipeline{}
+	}
+	var csHandler *mongo.ChangeStream
+	switch {
+	case watch.Collection != "":
+		csHandler, err = client.Database(watch.Database).Collection(watch.Collection).Watch(ctx, pipeline, ops)
+	case watch.Database != "":
+		csHandler, err = client.Database(watch.Database).Watch(ctx, pipeline, ops)
+	default:
+		csHandler, err = client.Watch(ctx, pipeline, ops)
+	}
 	if err != nil {
 		return
 	}
@@ -131,16 +174,21 @@ func (c *StreamConn) Close() {
 }
 
 type Event struct {
-	Id                bson.M              `bson:"_id" json:"_id"`
-	OperationType     string              `bson:"operationType" json:"operationType"`
-	FullDocument      bson.D              `bson:"fullDocument,omitempty" json:"fullDocument,omitempty"` // exists on "insert", "replace", "delete", "update"
-	Ns                bson.M              `bson:"ns" json:"ns"`
-	To                bson.M              `bson:"to,omitempty" json:"to,omitempty"`
-	DocumentKey       bson.D              `bson:"documentKey,omitempty" json:"documentKey,omitempty"` // exists on "insert", "replace", "delete", "update"
-	UpdateDescription bson.M              `bson:"updateDescription,omitempty" json:"updateDescription,omitempty"`
-	ClusterTime       primitive.Timestamp `bson:"clusterTime,omitempty" json:"clusterTime,omitempty"`
-	TxnNumber         *int64              `bson:"txnNumber,omitempty" json:"txnNumber,omitempty"`
-	LSID              bson.Raw            `bson:"lsid,omitempty" json:"lsid,omitempty"`
+	Id            bson.M `bson:"_id" json:"_id"`
+	OperationType string `bson:"operationType" json:"operationType"`
+	FullDocument  bson.D `bson:"fullDocument,omitempty" json:"fullDocument,omitempty"` // exists on "insert", "replace", "delete", "update"
+	// FullDocumentBeforeChange 变更前镜像，需要 fullDocumentBeforeChange 及集合开启 changeStreamPreAndPostImages
+	FullDocumentBeforeChange bson.D             `bson:"fullDocumentBeforeChange,omitempty" json:"fullDocumentBeforeChange,omitempty"`
+	Ns                       bson.M             `bson:"ns" json:"ns"`
+	To                       bson.M             `bson:"to,omitempty" json:"to,omitempty"`
+	DocumentKey              bson.D             `bson:"documentKey,omitempty" json:"documentKey,omitempty"` // exists on "insert", "replace", "delete", "update"
+	UpdateDescription        *UpdateDescription `bson:"updateDescription,omitempty" json:"updateDescription,omitempty"`
+	// OperationDescription showExpandedEvents 下 create、createIndexes、dropIndexes、modify 等事件的详情
+	OperationDescription bson.D              `bson:"operationDescription,omitempty" json:"operationDescription,omitempty"`
+	ClusterTime          primitive.Timestamp `bson:"clusterTime,omitempty" json:"clusterTime,omitempty"`
+	TxnNumber            *int64              `bson:"txnNumber,omitempty" json:"txnNumber,omitempty"`
+	WallTime             time.Time           `bson:"wallTime,omitempty" json:"wallTime,omitempty"`
+	LSID                 bson.Raw            `bson:"lsid,omitempty" json:"lsid,omitempty"`
 }
 
 func (e *Event) String() string {
@@ -151,6 +199,45 @@ func (e *Event) String() string {
 	}
 }
 
+// DDLCommand 将 create、createIndexes、dropIndexes、modify 事件还原为对应的数据库命令，
+// dropIndexes 的 index 为索引名数组；其他事件返回 false
+func (e *Event) DDLCommand() (bson.D, bool) {
+	coll := e.Ns[EventCollectionKey]
+	switch e.OperationType {
+	case "create":
+		return append(bson.D{{Key: "create", Value: coll}}, e.OperationDescription...), true
+	case "createIndexes":
+		cmd := bson.D{{Key: "createIndexes", Value: coll}}
+		for _, ele := range e.OperationDescription {
+			if ele.Key == "indexes" {
+				cmd = append(cmd, ele)
+			}
+		}
+		return cmd, true
+	case "dropIndexes":
+		names := bson.A{}
+		for _, ele := range e.OperationDescription {
+			if ele.Key != "indexes" {
+				continue
+			}
+			indexes, _ := ele.Value.(bson.A)
+			for _, index := range indexes {
+				if doc, ok := index.(bson.D); ok {
+					for _, item := range doc {
+						if item.Key == "name" {
+							names = append(names, item.Value)
+						}
+					}
+				}
+			}
+		}
+		return bson.D{{Key: "dropIndexes", Value: coll}, {Key: "index", Value: names}}, true
+	case "modify":
+		return append(bson.D{{Key: "collMod", Value: coll}}, e.OperationDescription...), true
+	}
+	return nil, false
+}
+
 func ConverteventOplog(input []byte, fullDoc bool) (*PartialLog, error) {
 	event := new(Event)
 	if err := bson.Unmarshal(input, event); err != nil {
@@ -187,31 +274,22 @@ func ConverteventOplog(input []byte, fullDoc bool) (*PartialLog, error) {
 		oplog.Namespace = fmt.Sprintf("%s.%s", ns["db"], ns["coll"])
 		oplog.Operation = "u"
 		oplog.Query = event.DocumentKey
-		oplog.Object = bson.D{{"$set", event.FullDocument}}
+		// 与 oplog 一致，整文档替换的 o 为替换后的文档
+		oplog.Object = event.FullDocument
 	case "update":
 		oplog.Namespace = fmt.Sprintf("%s.%s", ns["db"], ns["coll"])
 		oplog.Operation = "u"
 		oplog.Query = event.DocumentKey
 
 		if fullDoc && event.FullDocument != nil && len(event.FullDocument) > 0 {
-			oplog.Object = bson.D{{"$set", event.FullDocument}}
+			oplog.Object = bson.D{{Key: "$set", Value: event.FullDocument}}
 		} else {
-			oplog.Object = make(bson.D, 0, 2)
-			if updatedFields, ok := event.UpdateDescription["updatedFields"]; ok && len(updatedFields.(bson.M)) > 0 {
-				oplog.Object = append(oplog.Object, primitive.E{
-					Key:   "$set",
-					Value: updatedFields,
-				})
+			docs := event.UpdateDescription.UpdateDocuments()
+			if len(docs) > 1 {
+				return nil, fmt.Errorf("truncated array conflicts with updated fields, need full document: %s", event)
 			}
-			if removedFields, ok := event.UpdateDescription["removedFields"]; ok && len(removedFields.(primitive.A)) > 0 {
-				removedFieldsMap := make(bson.M)
-				for _, ele := range removedFields.(primitive.A) {
-					removedFieldsMap[ele.(string)] = 1
-				}
-				oplog.Object = append(oplog.Object, primitive.E{
-					Key:   "$unset",
-					Value: removedFieldsMap,
-				})
+			if len(docs) == 1 {
+				oplog.Object = docs[0]
 			}
 		}
 
@@ -247,10 +325,20 @@ func ConverteventOplog(input []byte, fullDoc bool) (*PartialLog, error) {
 				Value: 1,
 			},
 		}
+	case "create", "createIndexes", "dropIndexes", "modify":
+		oplog.Namespace = fmt.Sprintf("%s.$cmd", ns["db"])
+		oplog.Operation = "c"
+		oplog.Object, _ = event.DDLCommand()
 	case "invalidate":
 		return nil, fmt.Errorf("invalidate event happen, should be handle manually: %s", event)
 	default:
-		return nil, fmt.Errorf("unknown event type[%v] org_event[%v]", event.OperationType, event)
+		if !isShardingOperation(event.OperationType) {
+			return nil, fmt.Errorf("unknown event type[%v] org_event[%v]", event.OperationType, event)
+		}
+		// 分片相关的事件转换为 noop
+		oplog.Namespace = fmt.Sprintf("%s.%s", ns["db"], ns["coll"])
+		oplog.Operation = "n"
+		oplog.Object = bson.D{{Key: "msg", Value: event.OperationType}}
 	}
 
 	if oplog.Object == nil {
@@ -275,7 +363,7 @@ func GetAndCompareVersion(conn *mongo.Client, threshold string, compare string)
 
 func GetDBVersion(ctx context.Context, conn *mongo.Client) (string, error) {
 	res, err := conn.Database("admin").
-		RunCommand(ctx, bson.D{{"buildInfo", 1}}).Raw()
+		RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Raw()
 	if err != nil {
 		return "", err
 	}
@@ -324,7 +412,7 @@ func GetOldestTimestampByConn(conn *mongo.Client) (int64, error) {
 
 func getOplogTimestamp(conn *mongo.Client, sortType int) (int64, error) {
 	var result bson.M
-	opts := options.FindOne().SetSort(bson.D{{"$natural", sortType}})
+	opts := options.FindOne().SetSort(bson.D{{Key: "$natural", Value: sortType}})
 	err := conn.Database(localDB).Collection(OplogNS).FindOne(nil, bson.M{}, opts).Decode(&result)
 	if err != nil {
 		return 0, err
@@ -0,0 +1,495 @@
+package oplog
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xuenqlve/common/errors"
+	"github.com/xuenqlve/common/log"
+	"github.com/xuenqlve/common/match"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TailReader 直接 tail local.oplog.rs，用于 3.x 等不支持 change stream 的数据源。
+// oplog 转换为与 change stream 相同的 Event，复用 Reader 的回调、事务分组、位点提交及 ResumeExpiredPolicy，位点只有 Timestamp
+type TailReader struct {
+	*Reader
+	client *mongo.Client
+	lastTs primitive.Timestamp
+	// lastTsPending lastTs 处的 oplog 还未处理，位点过期恢复后从该时间戳开始读取
+	lastTsPending bool
+}
+
+func NewOplogTailReader(ctx context.Context, cfg ReaderConfig) (*TailReader, error) {
+	if cfg.StartPosition.Token != nil && cfg.StartPosition.Timestamp <= InitCheckpoint {
+		return nil, fmt.Errorf("oplog tail reader can not start from resume token, need start-position.timestamp")
+	}
+	if err := checkResumeExpiredPolicy(cfg.ResumeExpiredPolicy); err != nil {
+		return nil, err
+	}
+	return &TailReader{
+		Reader: &Reader{
+			ctx:             ctx,
+			cfg:             cfg,
+			timestampOnly:   true,
+			currentPosition: cfg.StartPosition,
+			lastCommitTime:  time.Now(),
+		},
+	}, nil
+}
+
+func (r *TailReader) Run() error {
+	if err := r.checkHandler(); err != nil {
+		return err
+	}
+	if err := r.eventHandler.OnPosSynced(r.currentPosition, false); err != nil {
+		return errors.Trace(err)
+	}
+	defer r.closeTransaction()
+
+	var err error
+	if r.client, err = r.cfg.connect(); err != nil {
+		return errors.Trace(err)
+	}
+	defer func() {
+		if err := r.client.Disconnect(context.Background()); err != nil {
+			log.Errorf("oplog tail reader disconnect err:%v", err)
+		}
+	}()
+	if err = r.initTimestamp(); err != nil {
+		if err = r.recoverExpired(err); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return nil
+		default:
+		}
+		if err = r.tail(); err != nil {
+			if err = r.recoverExpired(err); err != nil {
+				return errors.Trace(err)
+			}
+			continue
+		}
+		// 游标失效后从最后处理的位置重新查询
+		time.Sleep(time.Second)
+	}
+}
+
+func (r *TailReader) initTimestamp() error {
+	oldest, err := GetOldestTimestampByConn(r.client)
+	if err != nil {
+		return errors.Annotatef(err, "get oldest oplog timestamp")
+	}
+	if r.currentPosition.Timestamp <= InitCheckpoint {
+		newest, err := GetNewestTimestampByConn(r.client)
+		if err != nil {
+			return errors.Annotatef(err, "get newest oplog timestamp")
+		}
+		r.lastTs = Int64ToTimestamp(newest)
+		return nil
+	}
+	if r.currentPosition.Timestamp < oldest {
+		return &ResumeExpiredError{Position: r.currentPosition, Oldest: oldest, Err: fmt.Errorf("start position is older than the oldest oplog")}
+	}
+	r.lastTs = Int64ToTimestamp(r.currentPosition.Timestamp)
+	return nil
+}
+
+// recoverExpired 按 ResumeExpiredPolicy 处理位点过期，从新位点的时间戳继续 tail
+func (r *TailReader) recoverExpired(err error) error {
+	pos, err := r.expiredPosition(err)
+	if err != nil {
+		return err
+	}
+	if pos.Timestamp <= InitCheckpoint {
+		return fmt.Errorf("oplog tail reader can not resume from position %v without timestamp", pos)
+	}
+	r.lastTs = Int64ToTimestamp(pos.Timestamp)
+	r.lastTsPending = true
+	return nil
+}
+
+// tail 从 lastTs 开始查询，第一条应为已处理的 lastTs 本身，否则检查 lastTs 是否已被 oplog 回卷覆盖
+func (r *TailReader) tail() error {
+	opts := options.Find().
+		SetCursorType(options.TailableAwait).
+		SetNoCursorTimeout(true).
+		SetMaxAwaitTime(r.cfg.txnWaitTime()).
+		SetBatchSize(DefaultReaderFetchBatchSize)
+	cursor, err := r.client.Database(localDB).Collection(OplogNS).Find(r.ctx, bson.D{{Key: QueryTs, Value: bson.D{{Key: QueryOpGTE, Value: r.lastTs}}}}, opts)
+	if err != nil {
+		if r.ctx.Err() != nil {
+			return nil
+		}
+		if !retryableTailError(err) {
+			return errors.Annotatef(err, "oplog tail reader query")
+		}
+		log.Warnf("oplog tail reader query err:%v", err)
+		return nil
+	}
+	defer func() {
+		if err := cursor.Close(context.Background()); err != nil {
+			log.Errorf("oplog tail reader close cursor err:%v", err)
+		}
+	}()
+
+	first := true
+	for {
+		if !cursor.TryNext(r.ctx) {
+			if err = cursor.Err(); err != nil || cursor.ID() == 0 {
+				if r.ctx.Err() != nil {
+					return nil
+				}
+				if err != nil && !retryableTailError(err) {
+					return errors.Annotatef(err, "oplog tail reader cursor")
+				}
+				log.Warnf("oplog tail reader cursor closed err:%v", err)
+				return nil
+			}
+			// 空批次，事务的 oplog 已经全部读取
+			if err = r.flushTransaction(); err != nil {
+				return errors.Trace(err)
+			}
+			continue
+		}
+		parsed := ParsedLog{}
+		if err = bson.Unmarshal(cursor.Current, &parsed); err != nil {
+			return errors.Trace(err)
+		}
+		if first {
+			first = false
+			if parsed.Timestamp == r.lastTs && !r.lastTsPending {
+				continue
+			}
+			if parsed.Timestamp != r.lastTs {
+				if err = r.checkExpired(); err != nil {
+					return err
+				}
+			}
+			r.lastTsPending = false
+		}
+		partial := &PartialLog{ParsedLog: parsed, RawSize: len(cursor.Current)}
+		events, err := r.events(partial)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for _, event := range events {
+			raw, err := bson.Marshal(event)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if err = r.processEvent(event, raw); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		r.lastTs = parsed.Timestamp
+	}
+}
+
+// checkExpired lastTs 早于最早的 oplog 时返回 ResumeExpiredError；起始位点可能不是某条 oplog 的时间戳，因此不要求第一条与 lastTs 相等
+func (r *TailReader) checkExpired() error {
+	oldest, err := GetOldestTimestampByConn(r.client)
+	if err != nil {
+		return errors.Annotatef(err, "get oldest oplog timestamp")
+	}
+	if last := TimeStampToInt64(r.lastTs); last < oldest {
+		return &ResumeExpiredError{Position: Position{Timestamp: last}, Oldest: oldest, Err: fmt.Errorf("oplog %v has been overwritten", r.lastTs)}
+	}
+	return nil
+}
+
+const (
+	errCodeCursorNotFound     = 43
+	errCodeCappedPositionLost = 136
+)
+
+// retryableTailError 网络错误、超时及游标失效时重新查询，CappedPositionLost 由重新查询后的 checkExpired 判断位点是否过期
+func retryableTailError(err error) bool {
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) {
+		return true
+	}
+	se, ok := errors.Cause(err).(mongo.ServerError)
+	return ok && (se.HasErrorCode(errCodeCursorNotFound) || se.HasErrorCode(errCodeCappedPositionLost))
+}
+
+// events oplog 转换为 change stream 事件，applyOps 展开为多条，带有父 oplog 的 lsid、txnNumber
+func (r *TailReader) events(oplog *PartialLog) ([]Event, error) {
+	if oplog.FromMigrate || oplog.Operation == "n" {
+		return nil, nil
+	}
+	if oplog.Operation == "c" {
+		if ops, ok := applyOps(oplog.Object); ok {
+			events := make([]Event, 0, len(ops))
+			for _, op := range ops {
+				sub := &PartialLog{ParsedLog: op}
+				sub.Timestamp = oplog.Timestamp
+				sub.LSID = oplog.LSID
+				sub.TxnNumber = oplog.TxnNumber
+				list, err := r.events(sub)
+				if err != nil {
+					return nil, err
+				}
+				events = append(events, list...)
+			}
+			return events, nil
+		}
+	}
+
+	database, collection, _ := strings.Cut(oplog.Namespace, ".")
+	if !r.acceptNamespace(database, collection) {
+		return nil, nil
+	}
+	event := Event{
+		Ns:          bson.M{EventNsDBKey: database, EventCollectionKey: collection},
+		ClusterTime: oplog.Timestamp,
+		TxnNumber:   oplog.TxnNumber,
+		LSID:        oplog.LSID,
+	}
+	switch oplog.Operation {
+	case "i":
+		// 3.x 创建索引写入 system.indexes
+		if collection == "system.indexes" {
+			indexNs, _ := lookup(oplog.Object, "ns").(string)
+			_, indexCollection, _ := strings.Cut(indexNs, ".")
+			index := make(bson.D, 0, len(oplog.Object))
+			for _, e := range oplog.Object {
+				if e.Key != "ns" {
+					index = append(index, e)
+				}
+			}
+			event.OperationType = createIndexesOperation
+			event.Ns[EventCollectionKey] = indexCollection
+			event.OperationDescription = bson.D{{Key: "indexes", Value: bson.A{index}}}
+			return []Event{event}, nil
+		}
+		event.OperationType = insertOperation
+		event.FullDocument = oplog.Object
+		event.DocumentKey = bson.D{{Key: ObjectIdColumn, Value: lookup(oplog.Object, ObjectIdColumn)}}
+	case "d":
+		event.OperationType = deleteOperation
+		event.DocumentKey = oplog.Object
+	case "u":
+		event.DocumentKey = oplog.Query
+		if err := r.updateEvent(&event, oplog.Object); err != nil {
+			return nil, err
+		}
+	case "c":
+		return commandEvent(event, oplog.Object)
+	default:
+		log.Warnf("oplog tail reader skip unknown op %s ns %s", oplog.Operation, oplog.Namespace)
+		return nil, nil
+	}
+	return []Event{event}, nil
+}
+
+func (r *TailReader) acceptNamespace(database, collection string) bool {
+	switch database {
+	case "admin", "local", "config":
+		return false
+	}
+	if strings.HasPrefix(collection, "system.") && collection != "system.indexes" {
+		return false
+	}
+	if len(r.cfg.Filters) == 0 {
+		return true
+	}
+	for _, filter := range r.cfg.Filters {
+		if !match.Glob(filter.Database, database) {
+			continue
+		}
+		// 库级别命令或 system.indexes 交由 DDL 解析
+		if collection == "$cmd" || collection == "system.indexes" {
+			return true
+		}
+		if match.MatchRegex(collection, filter.IgnoreCollection) {
+			continue
+		}
+		if len(filter.AcceptCollection) == 0 || match.MatchRegex(collection, filter.AcceptCollection) {
+			return true
+		}
+	}
+	return false
+}
+
+// updateEvent 解析 $set/$unset（oplog v1）及 diff（oplog v2），整文档替换转为 replace；
+// 无法展开的数组 diff 回查当前文档
+func (r *TailReader) updateEvent(event *Event, object bson.D) error {
+	desc := &UpdateDescription{UpdatedFields: bson.D{}, RemovedFields: []string{}}
+	if diff, ok := lookup(object, "diff").(bson.D); ok {
+		if applyDiff("", diff, desc) {
+			event.OperationType = updateOperation
+			event.UpdateDescription = desc
+			return nil
+		}
+		return r.lookupDocument(event)
+	}
+	if len(object) == 0 || !strings.HasPrefix(object[0].Key, "$") {
+		event.OperationType = replaceOperation
+		event.FullDocument = object
+		return nil
+	}
+	for _, e := range object {
+		doc, _ := e.Value.(bson.D)
+		switch e.Key {
+		case "$set":
+			desc.UpdatedFields = append(desc.UpdatedFields, doc...)
+		case "$unset":
+			for _, field := range doc {
+				desc.RemovedFields = append(desc.RemovedFields, field.Key)
+			}
+		}
+	}
+	event.OperationType = updateOperation
+	event.UpdateDescription = desc
+	return nil
+}
+
+func (r *TailReader) lookupDocument(event *Event) error {
+	database, collection, err := SplitNamespace(event.Ns)
+	if err != nil {
+		return err
+	}
+	doc := bson.D{}
+	err = r.client.Database(database).Collection(collection).FindOne(r.ctx, event.DocumentKey).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		// 文档已被后续操作删除，由之后的 delete 处理
+		log.Warnf("oplog tail reader lookup %s.%s %v not found", database, collection, event.DocumentKey)
+		event.OperationType = updateOperation
+		event.UpdateDescription = &UpdateDescription{UpdatedFields: bson.D{}, RemovedFields: []string{}}
+		return nil
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	event.OperationType = updateOperation
+	event.FullDocument = doc
+	return nil
+}
+
+// applyDiff 展开 oplog v2 的 diff：u、i 为更新字段，d 为删除字段，s 前缀为嵌套文档；包含数组 diff 时返回 false
+func applyDiff(prefix string, diff bson.D, desc *UpdateDescription) bool {
+	for _, e := range diff {
+		switch {
+		case e.Key == "u" || e.Key == "i":
+			doc, _ := e.Value.(bson.D)
+			for _, field := range doc {
+				desc.UpdatedFields = append(desc.UpdatedFields, primitive.E{Key: prefix + field.Key, Value: field.Value})
+			}
+		case e.Key == "d":
+			doc, _ := e.Value.(bson.D)
+			for _, field := range doc {
+				desc.RemovedFields = append(desc.RemovedFields, prefix+field.Key)
+			}
+		case e.Key == "a":
+			return false
+		case strings.HasPrefix(e.Key, "s"):
+			sub, ok := e.Value.(bson.D)
+			if !ok || !applyDiff(prefix+e.Key[1:]+".", sub, desc) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// commandEvent 将 oplog 命令转换为 change stream 的 DDL 事件
+func commandEvent(event Event, object bson.D) ([]Event, error) {
+	if len(object) == 0 {
+		return nil, nil
+	}
+	name, collection := object[0].Key, fmt.Sprint(object[0].Value)
+	switch name {
+	case "drop":
+		event.OperationType = dropOperation
+		event.Ns[EventCollectionKey] = collection
+	case "dropDatabase":
+		event.OperationType = dropDatabaseOperation
+		delete(event.Ns, EventCollectionKey)
+	case "renameCollection":
+		from, _ := lookup(object, "renameCollection").(string)
+		to, _ := lookup(object, "to").(string)
+		fromDb, fromColl, _ := strings.Cut(from, ".")
+		toDb, toColl, _ := strings.Cut(to, ".")
+		event.OperationType = renameOperation
+		event.Ns = bson.M{EventNsDBKey: fromDb, EventCollectionKey: fromColl}
+		event.To = bson.M{EventNsDBKey: toDb, EventCollectionKey: toColl}
+	case "create":
+		event.OperationType = createOperation
+		event.Ns[EventCollectionKey] = collection
+		event.OperationDescription = object[1:]
+	case "createIndexes":
+		event.OperationType = createIndexesOperation
+		event.Ns[EventCollectionKey] = collection
+		event.OperationDescription = bson.D{{Key: "indexes", Value: bson.A{object[1:]}}}
+	case "commitIndexBuild":
+		// 4.4 起两阶段建索引，commitIndexBuild 中带有全部索引
+		event.OperationType = createIndexesOperation
+		event.Ns[EventCollectionKey] = collection
+		event.OperationDescription = bson.D{{Key: "indexes", Value: lookup(object, "indexes")}}
+	case "dropIndexes", "deleteIndexes":
+		indexes := bson.A{}
+		switch index := lookup(object, "index").(type) {
+		case string:
+			indexes = append(indexes, bson.D{{Key: "name", Value: index}})
+		case bson.A:
+			for _, name := range index {
+				indexes = append(indexes, bson.D{{Key: "name", Value: name}})
+			}
+		}
+		event.OperationType = dropIndexesOperation
+		event.Ns[EventCollectionKey] = collection
+		event.OperationDescription = bson.D{{Key: "indexes", Value: indexes}}
+	case "collMod":
+		event.OperationType = modifyOperation
+		event.Ns[EventCollectionKey] = collection
+		event.OperationDescription = object[1:]
+	default:
+		// startIndexBuild、abortIndexBuild、commitTransaction 等不需要同步
+		log.Debugf("oplog tail reader skip command %s", name)
+		return nil, nil
+	}
+	return []Event{event}, nil
+}
+
+func applyOps(object bson.D) ([]ParsedLog, bool) {
+	value, ok := lookup(object, "applyOps").(bson.A)
+	if !ok {
+		return nil, false
+	}
+	ops := make([]ParsedLog, 0, len(value))
+	for _, item := range value {
+		doc, ok := item.(bson.D)
+		if !ok {
+			continue
+		}
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			continue
+		}
+		op := ParsedLog{}
+		if err = bson.Unmarshal(raw, &op); err != nil {
+			log.Warnf("oplog tail reader unmarshal applyOps %v err:%v", doc, err)
+			continue
+		}
+		ops = append(ops, op)
+	}
+	return ops, true
+}
+
+func lookup(doc bson.D, key string) any {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value
+		}
+	}
+	return nil
+}
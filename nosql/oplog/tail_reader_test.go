@@ -0,0 +1,65 @@
+package oplog
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestTailReaderEvents(t *testing.T) {
+	r := &TailReader{Reader: &Reader{cfg: ReaderConfig{Filters: []NamespaceFilter{{Database: "db"}}}}}
+	txnNumber := int64(3)
+	oplog := &PartialLog{ParsedLog: ParsedLog{
+		Timestamp: primitive.Timestamp{T: 10, I: 1},
+		Operation: "c",
+		Namespace: "admin.$cmd",
+		TxnNumber: &txnNumber,
+		LSID:      bson.Raw{},
+		Object: bson.D{{Key: "applyOps", Value: bson.A{
+			bson.D{{Key: "op", Value: "i"}, {Key: "ns", Value: "db.c"}, {Key: "o", Value: bson.D{{Key: "_id", Value: 1}, {Key: "a", Value: 1}}}},
+			bson.D{{Key: "op", Value: "u"}, {Key: "ns", Value: "db.c"}, {Key: "o2", Value: bson.D{{Key: "_id", Value: 1}}},
+				{Key: "o", Value: bson.D{{Key: "$v", Value: 2}, {Key: "diff", Value: bson.D{
+					{Key: "u", Value: bson.D{{Key: "a", Value: 2}}},
+					{Key: "sb", Value: bson.D{{Key: "d", Value: bson.D{{Key: "c", Value: false}}}}},
+				}}}}},
+			bson.D{{Key: "op", Value: "i"}, {Key: "ns", Value: "other.c"}, {Key: "o", Value: bson.D{{Key: "_id", Value: 2}}}},
+			bson.D{{Key: "op", Value: "c"}, {Key: "ns", Value: "db.$cmd"}, {Key: "o", Value: bson.D{{Key: "dropIndexes", Value: "c"}, {Key: "index", Value: "a_1"}}}},
+		}}},
+	}}
+	events, err := r.events(oplog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("events: %v", events)
+	}
+	for _, event := range events {
+		if event.ClusterTime != oplog.Timestamp || event.TxnNumber == nil || *event.TxnNumber != txnNumber {
+			t.Fatalf("event txn: %v", event)
+		}
+	}
+	if events[0].OperationType != insertOperation || events[1].OperationType != updateOperation || events[2].OperationType != dropIndexesOperation {
+		t.Fatalf("operation types: %s %s %s", events[0].OperationType, events[1].OperationType, events[2].OperationType)
+	}
+	desc := events[1].UpdateDescription
+	if len(desc.UpdatedFields) != 1 || desc.UpdatedFields[0].Value != int32(2) || len(desc.RemovedFields) != 1 || desc.RemovedFields[0] != "b.c" {
+		t.Fatalf("update description: %v", events[1].UpdateDescription)
+	}
+	if command, ok := events[2].DDLCommand(); !ok || command[0].Key != "dropIndexes" {
+		t.Fatalf("drop indexes command: %v", command)
+	}
+}
+
+func TestRetryableTailError(t *testing.T) {
+	if !retryableTailError(mongo.CommandError{Code: errCodeCappedPositionLost, Message: "capped position lost"}) {
+		t.Fatal("CappedPositionLost should be retried")
+	}
+	if !retryableTailError(mongo.CommandError{Labels: []string{"NetworkError"}}) {
+		t.Fatal("network error should be retried")
+	}
+	if retryableTailError(mongo.CommandError{Code: 13, Message: "not authorized on local"}) {
+		t.Fatal("unauthorized should not be retried")
+	}
+}
@@ -0,0 +1,157 @@
+package oplog
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/xuenqlve/common/errors"
+	"github.com/xuenqlve/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DefaultTxnBufferSize = 1024
+	DefaultTxnWaitTime   = 1000 // ms
+)
+
+// txnWaitTime change stream 没有新事件时 getMore 的等待时间
+func (c *ReaderConfig) txnWaitTime() time.Duration {
+	if c.TxnWaitTime > 0 {
+		return time.Duration(c.TxnWaitTime) * time.Millisecond
+	}
+	return DefaultTxnWaitTime * time.Millisecond
+}
+
+type txnKey struct {
+	lsid      string
+	txnNumber int64
+}
+
+// eventTxnKey 事务内的事件都带有 lsid 和 txnNumber
+func eventTxnKey(event Event) (txnKey, bool) {
+	if len(event.LSID) == 0 || event.TxnNumber == nil {
+		return txnKey{}, false
+	}
+	return txnKey{lsid: string(event.LSID), txnNumber: *event.TxnNumber}, true
+}
+
+// Transaction 一个多文档事务的全部事件，超过 bufferSize 的事件写入临时文件
+type Transaction struct {
+	LSID        bson.Raw
+	TxnNumber   int64
+	ClusterTime primitive.Timestamp
+
+	key        txnKey
+	bufferSize int
+	spillDir   string
+	events     []Event
+	spill      *os.File
+	count      int
+	last       Event
+}
+
+func newTransaction(key txnKey, event Event, bufferSize int, spillDir string) *Transaction {
+	if bufferSize <= 0 {
+		bufferSize = DefaultTxnBufferSize
+	}
+	return &Transaction{
+		LSID:        event.LSID,
+		TxnNumber:   key.txnNumber,
+		ClusterTime: event.ClusterTime,
+		key:         key,
+		bufferSize:  bufferSize,
+		spillDir:    spillDir,
+		events:      make([]Event, 0),
+	}
+}
+
+func (t *Transaction) add(event Event, raw []byte) error {
+	t.count++
+	t.last = event
+	if len(t.events) < t.bufferSize {
+		t.events = append(t.events, event)
+		return nil
+	}
+	if t.spill == nil {
+		file, err := os.CreateTemp(t.spillDir, "oplog-txn-*")
+		if err != nil {
+			return errors.Trace(err)
+		}
+		t.spill = file
+		log.Infof("transaction lsid:%s txnNumber:%d exceeds %d events, spill to %s", bson.Raw(t.LSID).String(), t.TxnNumber, t.bufferSize, file.Name())
+	}
+	if _, err := t.spill.Write(raw); err != nil {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// Len 事务的事件数
+func (t *Transaction) Len() int {
+	return t.count
+}
+
+// Spilled 是否有事件写入了临时文件
+func (t *Transaction) Spilled() bool {
+	return t.spill != nil
+}
+
+// Range 按顺序遍历事务的事件，包括写入临时文件的部分
+func (t *Transaction) Range(fn func(event Event) error) error {
+	for _, event := range t.events {
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	if t.spill == nil {
+		return nil
+	}
+	if _, err := t.spill.Seek(0, io.SeekStart); err != nil {
+		return errors.Trace(err)
+	}
+	for {
+		raw, err := bson.NewFromIOReader(t.spill)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+		event := Event{}
+		if err = bson.Unmarshal(raw, &event); err != nil {
+			return errors.Trace(err)
+		}
+		if err = fn(event); err != nil {
+			return err
+		}
+	}
+}
+
+// Events 返回全部事件，事务很大时应使用 Range
+func (t *Transaction) Events() ([]Event, error) {
+	if t.spill == nil {
+		return t.events, nil
+	}
+	events := make([]Event, 0, t.count)
+	err := t.Range(func(event Event) error {
+		events = append(events, event)
+		return nil
+	})
+	return events, err
+}
+
+func (t *Transaction) close() {
+	if t.spill == nil {
+		return
+	}
+	name := t.spill.Name()
+	if err := t.spill.Close(); err != nil {
+		log.Warnf("close transaction spill file %s err:%v", name, err)
+	}
+	if err := os.Remove(name); err != nil {
+		log.Warnf("remove transaction spill file %s err:%v", name, err)
+	}
+	t.spill = nil
+}
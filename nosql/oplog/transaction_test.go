@@ -0,0 +1,49 @@
+package oplog
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestTransactionSpill(t *testing.T) {
+	txnNumber := int64(7)
+	lsid, _ := bson.Marshal(bson.D{{Key: "id", Value: "session"}})
+	events := make([]Event, 0, 3)
+	for _, id := range []int{1, 2, 3} {
+		events = append(events, Event{
+			OperationType: insertOperation,
+			Ns:            bson.M{EventNsDBKey: "db", EventCollectionKey: "users"},
+			FullDocument:  bson.D{{Key: "_id", Value: int32(id)}},
+			TxnNumber:     &txnNumber,
+			LSID:          lsid,
+		})
+	}
+	key, ok := eventTxnKey(events[0])
+	if !ok {
+		t.Fatal("expected transaction event")
+	}
+	txn := newTransaction(key, events[0], 1, t.TempDir())
+	defer txn.close()
+	for _, event := range events {
+		raw, err := bson.Marshal(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = txn.add(event, raw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !txn.Spilled() || txn.Len() != 3 {
+		t.Fatalf("spilled:%v len:%d", txn.Spilled(), txn.Len())
+	}
+	got, err := txn.Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, event := range got {
+		if event.FullDocument[0].Value != int32(i+1) || *event.TxnNumber != txnNumber {
+			t.Fatalf("event %d: %v", i, event.FullDocument)
+		}
+	}
+}
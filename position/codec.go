@@ -0,0 +1,114 @@
+package position
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/xuenqlve/common/errors"
+	"github.com/xuenqlve/common/nosql/oplog"
+	"github.com/xuenqlve/common/relational_database/binlog"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// oplogPositionValue oplog 位点的持久化格式，resume token 以 base64 编码
+type oplogPositionValue struct {
+	Token     string `json:"token,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// Encode 将 binlog.Position 或 oplog.Position 编码为字符串
+func Encode(pos any) (string, error) {
+	switch v := pos.(type) {
+	case binlog.Position:
+		return encodeBinlogPosition(v)
+	case *binlog.Position:
+		return encodeBinlogPosition(*v)
+	case oplog.Position:
+		return encodeOplogPosition(v)
+	case *oplog.Position:
+		return encodeOplogPosition(*v)
+	default:
+		return "", fmt.Errorf("unsupported position type: %T", pos)
+	}
+}
+
+func encodeBinlogPosition(pos binlog.Position) (string, error) {
+	data, err := json.Marshal(pos)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return string(data), nil
+}
+
+func encodeOplogPosition(pos oplog.Position) (string, error) {
+	token, err := pos.ResumeToken()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	value := oplogPositionValue{
+		Timestamp: pos.Timestamp,
+	}
+	if len(token) > 0 {
+		value.Token = base64.StdEncoding.EncodeToString(token)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return string(data), nil
+}
+
+// DecodeBinlogPosition 解析 Encode 生成的 binlog 位点
+func DecodeBinlogPosition(s string) (binlog.Position, error) {
+	pos := binlog.Position{}
+	if err := json.Unmarshal([]byte(s), &pos); err != nil {
+		return pos, errors.Annotatef(err, "decode binlog position %s", s)
+	}
+	return pos, nil
+}
+
+// DecodeOplogPosition 解析 Encode 生成的 oplog 位点，token 还原为 bson.Raw
+func DecodeOplogPosition(s string) (oplog.Position, error) {
+	value := oplogPositionValue{}
+	if err := json.Unmarshal([]byte(s), &value); err != nil {
+		return oplog.Position{}, errors.Annotatef(err, "decode oplog position %s", s)
+	}
+	pos := oplog.Position{
+		Timestamp: value.Timestamp,
+	}
+	if value.Token != "" {
+		data, err := base64.StdEncoding.DecodeString(value.Token)
+		if err != nil {
+			return oplog.Position{}, errors.Annotatef(err, "decode oplog resume token %s", value.Token)
+		}
+		pos.Token = bson.Raw(data)
+	}
+	return pos, nil
+}
+
+// LoadBinlogPosition 从 store 读取 binlog 位点，不存在时返回 false
+func LoadBinlogPosition(store PositionStore, key string) (binlog.Position, bool, error) {
+	record, ok, err := store.Load(key)
+	if err != nil || !ok {
+		return binlog.Position{}, ok, err
+	}
+	pos, err := DecodeBinlogPosition(record.Value)
+	if err != nil {
+		return binlog.Position{}, false, err
+	}
+	return pos, true, nil
+}
+
+// LoadOplogPosition 从 store 读取 oplog 位点，不存在时返回 false
+func LoadOplogPosition(store PositionStore, key string) (oplog.Position, bool, error) {
+	record, ok, err := store.Load(key)
+	if err != nil || !ok {
+		return oplog.Position{}, ok, err
+	}
+	pos, err := DecodeOplogPosition(record.Value)
+	if err != nil {
+		return oplog.Position{}, false, err
+	}
+	return pos, true, nil
+}
@@ -0,0 +1,112 @@
+package position
+
+import (
+	"sync"
+	"time"
+
+	"github.com/xuenqlve/common/errors"
+	"github.com/xuenqlve/common/log"
+)
+
+const DefaultCommitInterval = 3 * time.Second
+
+// Committer 对位点提交做去抖：force 为 true 时立即落盘，否则最多每 interval 落盘一次，
+// 期间只保留最新位点。可直接在 EventHandler.OnPosSynced 中调用 Commit。
+type Committer struct {
+	mu       sync.Mutex
+	store    PositionStore
+	key      string
+	interval time.Duration
+
+	pending   string
+	dirty     bool
+	lastValue string
+	lastSave  time.Time
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+	closed bool
+}
+
+func NewCommitter(store PositionStore, key string, interval time.Duration) *Committer {
+	if interval <= 0 {
+		interval = DefaultCommitInterval
+	}
+	return &Committer{
+		store:    store,
+		key:      key,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start 启动后台协程，定期把去抖期间积压的位点落盘
+func (c *Committer) Start() {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.Flush(); err != nil {
+					log.Errorf("position committer flush key:%s err:%v", c.key, err)
+				}
+			case <-c.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Commit 提交 binlog.Position 或 oplog.Position
+func (c *Committer) Commit(pos any, force bool) error {
+	value, err := Encode(pos)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending = value
+	c.dirty = true
+	if force || time.Since(c.lastSave) >= c.interval {
+		return c.flush()
+	}
+	return nil
+}
+
+func (c *Committer) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flush()
+}
+
+func (c *Committer) flush() error {
+	if !c.dirty {
+		return nil
+	}
+	if c.pending != c.lastValue {
+		if err := c.store.Save(c.key, c.pending); err != nil {
+			return errors.Trace(err)
+		}
+		c.lastValue = c.pending
+	}
+	c.dirty = false
+	c.lastSave = time.Now()
+	return nil
+}
+
+// Close 停止后台协程并把最后的位点落盘，不会关闭 store
+func (c *Committer) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+	close(c.stopCh)
+	c.wg.Wait()
+	return c.Flush()
+}
@@ -0,0 +1,97 @@
+package position
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xuenqlve/common/nosql/oplog"
+	"github.com/xuenqlve/common/relational_database/binlog"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(FileStoreConfig{Dir: t.TempDir(), HistorySize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := store.Load("task"); err != nil || ok {
+		t.Fatalf("empty store load ok:%v err:%v", ok, err)
+	}
+	for _, value := range []string{"a", "b", "c"} {
+		if err = store.Save("task", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record, ok, err := store.Load("task")
+	if err != nil || !ok || record.Value != "c" {
+		t.Fatalf("load record:%v ok:%v err:%v", record, ok, err)
+	}
+	history, err := store.History("task", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Value != "c" || history[1].Value != "b" {
+		t.Fatalf("unexpected history:%v", history)
+	}
+}
+
+func TestCodec(t *testing.T) {
+	binlogPos := binlog.Position{BinLogFileName: "mysql-bin.000003", BinLogFilePos: 1024, BinlogGTID: "3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5"}
+	value, err := Encode(binlogPos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodedBinlog, err := DecodeBinlogPosition(value)
+	if err != nil || decodedBinlog != binlogPos {
+		t.Fatalf("binlog position:%v err:%v", decodedBinlog, err)
+	}
+
+	token, _ := bson.Marshal(bson.D{{Key: "_data", Value: "8263A1"}})
+	value, err = Encode(&oplog.Position{Token: bson.Raw(token), Timestamp: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodedOplog, err := DecodeOplogPosition(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, ok := decodedOplog.Token.(bson.Raw)
+	if !ok || raw.Lookup("_data").StringValue() != "8263A1" || decodedOplog.Timestamp != 42 {
+		t.Fatalf("oplog position:%v", decodedOplog)
+	}
+}
+
+func TestCommitter(t *testing.T) {
+	store, err := NewFileStore(FileStoreConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	committer := NewCommitter(store, "task", time.Hour)
+	if err = committer.Commit(binlog.Position{BinLogFileName: "mysql-bin.000001", BinLogFilePos: 4}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err = committer.Commit(binlog.Position{BinLogFileName: "mysql-bin.000001", BinLogFilePos: 100}, false); err != nil {
+		t.Fatal(err)
+	}
+	pos, _, err := LoadBinlogPosition(store, "task")
+	if err != nil || pos.BinLogFilePos != 4 {
+		t.Fatalf("debounced position should not be saved, got:%v err:%v", pos, err)
+	}
+	if err = committer.Commit(binlog.Position{BinLogFileName: "mysql-bin.000001", BinLogFilePos: 200}, true); err != nil {
+		t.Fatal(err)
+	}
+	pos, _, err = LoadBinlogPosition(store, "task")
+	if err != nil || pos.BinLogFilePos != 200 {
+		t.Fatalf("forced position should be saved, got:%v err:%v", pos, err)
+	}
+	if err = committer.Commit(binlog.Position{BinLogFileName: "mysql-bin.000001", BinLogFilePos: 300}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err = committer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	pos, _, err = LoadBinlogPosition(store, "task")
+	if err != nil || pos.BinLogFilePos != 300 {
+		t.Fatalf("close should flush pending position, got:%v err:%v", pos, err)
+	}
+}
@@ -0,0 +1,168 @@
+package position
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/xuenqlve/common/errors"
+)
+
+type FileStoreConfig struct {
+	Dir         string `mapstructure:"dir" toml:"dir" json:"dir" yaml:"dir"`
+	HistorySize int    `mapstructure:"history-size" toml:"history-size" json:"history-size" yaml:"history-size"`
+}
+
+// FileStore 本地文件位点存储，当前位点通过临时文件 + rename 原子替换
+type FileStore struct {
+	mu          sync.Mutex
+	dir         string
+	historySize int
+}
+
+func NewFileStore(cfg FileStoreConfig) (*FileStore, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("position file store dir is empty")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &FileStore{
+		dir:         cfg.Dir,
+		historySize: historySize(cfg.HistorySize),
+	}, nil
+}
+
+func (s *FileStore) positionFile(key string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s.pos", key))
+}
+
+func (s *FileStore) historyFile(key string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s.history", key))
+}
+
+func (s *FileStore) Load(key string) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := os.ReadFile(s.positionFile(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Record{}, false, nil
+		}
+		return Record{}, false, errors.Trace(err)
+	}
+	record := Record{}
+	if err = json.Unmarshal(data, &record); err != nil {
+		return Record{}, false, errors.Annotatef(err, "decode position file %s", s.positionFile(key))
+	}
+	return record, true, nil
+}
+
+func (s *FileStore) Save(key string, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := newRecord(key, value)
+	data, err := json.Marshal(record)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = writeFileAtomic(s.positionFile(key), data); err != nil {
+		return errors.Trace(err)
+	}
+	return s.appendHistory(key, data)
+}
+
+func (s *FileStore) appendHistory(key string, data []byte) error {
+	lines, err := s.readHistory(key)
+	if err != nil {
+		return err
+	}
+	lines = append(lines, data)
+	if len(lines) > s.historySize {
+		lines = lines[len(lines)-s.historySize:]
+	}
+	return writeFileAtomic(s.historyFile(key), append(bytes.Join(lines, []byte("\n")), '\n'))
+}
+
+func (s *FileStore) readHistory(key string) ([][]byte, error) {
+	file, err := os.Open(s.historyFile(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return [][]byte{}, nil
+		}
+		return nil, errors.Trace(err)
+	}
+	defer file.Close()
+	lines := make([][]byte, 0, s.historySize)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		lines = append(lines, append([]byte{}, line...))
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return lines, nil
+}
+
+func (s *FileStore) History(key string, limit int) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lines, err := s.readHistory(key)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(lines))
+	for i := len(lines) - 1; i >= 0; i-- {
+		if limit > 0 && len(records) >= limit {
+			break
+		}
+		record := Record{}
+		if err = json.Unmarshal(lines[i], &record); err != nil {
+			return nil, errors.Annotatef(err, "decode position history %s", s.historyFile(key))
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (s *FileStore) Close() error {
+	return nil
+}
+
+// writeFileAtomic 先写入同目录临时文件并 fsync，再 rename 覆盖目标文件
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	tmpName := tmp.Name()
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmpName)
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return errors.Trace(err)
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return errors.Trace(err)
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	if err = os.Rename(tmpName, path); err != nil {
+		return errors.Trace(err)
+	}
+	return nil
+}
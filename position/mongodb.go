@@ -0,0 +1,112 @@
+package position
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/xuenqlve/common/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const DefaultPositionCollection = "dts_position"
+
+type MongoDBStoreConfig struct {
+	Database    string `mapstructure:"database" toml:"database" json:"database" yaml:"database"`
+	Collection  string `mapstructure:"collection" toml:"collection" json:"collection" yaml:"collection"`
+	HistorySize int    `mapstructure:"history-size" toml:"history-size" json:"history-size" yaml:"history-size"`
+}
+
+// MongoDBStore 以追加写的方式把位点保存在 MongoDB 集合中，最新一条即当前位点
+type MongoDBStore struct {
+	collection  *mongo.Collection
+	historySize int
+}
+
+// NewMongoDBStore client 由调用方管理，Close 不会断开 client
+func NewMongoDBStore(client *mongo.Client, cfg MongoDBStoreConfig) (*MongoDBStore, error) {
+	if cfg.Database == "" {
+		return nil, fmt.Errorf("position mongodb store database is empty")
+	}
+	if cfg.Collection == "" {
+		cfg.Collection = DefaultPositionCollection
+	}
+	s := &MongoDBStore{
+		collection:  client.Database(cfg.Database).Collection(cfg.Collection),
+		historySize: historySize(cfg.HistorySize),
+	}
+	index := mongo.IndexModel{
+		Keys: bson.D{{Key: "name", Value: 1}, {Key: "update_time", Value: -1}, {Key: "_id", Value: -1}},
+	}
+	if _, err := s.collection.Indexes().CreateOne(context.Background(), index); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return s, nil
+}
+
+func (s *MongoDBStore) Load(key string) (Record, bool, error) {
+	records, err := s.History(key, 1)
+	if err != nil {
+		return Record{}, false, err
+	}
+	if len(records) == 0 {
+		return Record{}, false, nil
+	}
+	return records[0], true, nil
+}
+
+func (s *MongoDBStore) Save(key string, value string) error {
+	ctx := context.Background()
+	if _, err := s.collection.InsertOne(ctx, newRecord(key, value)); err != nil {
+		return errors.Trace(err)
+	}
+	return s.prune(ctx, key)
+}
+
+// prune 只保留最近 historySize 条位点
+func (s *MongoDBStore) prune(ctx context.Context, key string) error {
+	opts := options.FindOne().
+		SetSort(bson.D{{Key: "update_time", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(s.historySize - 1))
+	oldest := Record{}
+	err := s.collection.FindOne(ctx, bson.D{{Key: "name", Value: key}}, opts).Decode(&oldest)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	filter := bson.D{
+		{Key: "name", Value: key},
+		{Key: "update_time", Value: bson.D{{Key: "$lt", Value: oldest.UpdatedAt}}},
+	}
+	if _, err = s.collection.DeleteMany(ctx, filter); err != nil {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+func (s *MongoDBStore) History(key string, limit int) ([]Record, error) {
+	if limit <= 0 {
+		limit = s.historySize
+	}
+	ctx := context.Background()
+	opts := options.Find().
+		SetSort(bson.D{{Key: "update_time", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit))
+	cursor, err := s.collection.Find(ctx, bson.D{{Key: "name", Value: key}}, opts)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	records := make([]Record, 0, limit)
+	if err = cursor.All(ctx, &records); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return records, nil
+}
+
+// Close client 由调用方断开
+func (s *MongoDBStore) Close() error {
+	return nil
+}
@@ -0,0 +1,122 @@
+package position
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/xuenqlve/common/errors"
+	sql_tool "github.com/xuenqlve/common/sql"
+)
+
+const DefaultPositionTable = "dts_position"
+
+type MySQLStoreConfig struct {
+	Database    string `mapstructure:"database" toml:"database" json:"database" yaml:"database"`
+	Table       string `mapstructure:"table" toml:"table" json:"table" yaml:"table"`
+	HistorySize int    `mapstructure:"history-size" toml:"history-size" json:"history-size" yaml:"history-size"`
+}
+
+// MySQLStore 以追加写的方式把位点保存在 MySQL 表中，最新一行即当前位点
+type MySQLStore struct {
+	conn        *sql.DB
+	tableName   string
+	historySize int
+}
+
+// NewMySQLStore conn 由调用方管理，Close 不会关闭 conn
+func NewMySQLStore(conn *sql.DB, cfg MySQLStoreConfig) (*MySQLStore, error) {
+	if cfg.Database == "" {
+		return nil, fmt.Errorf("position mysql store database is empty")
+	}
+	if cfg.Table == "" {
+		cfg.Table = DefaultPositionTable
+	}
+	s := &MySQLStore{
+		conn:        conn,
+		tableName:   sql_tool.GenerateTableName(cfg.Database, cfg.Table),
+		historySize: historySize(cfg.HistorySize),
+	}
+	if err := s.init(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *MySQLStore) init() error {
+	statement := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+		"`id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,"+
+		"`name` VARCHAR(255) NOT NULL,"+
+		"`value` TEXT NOT NULL,"+
+		"`update_time` DATETIME(3) NOT NULL,"+
+		"PRIMARY KEY (`id`),"+
+		"KEY `idx_name_id` (`name`, `id`)"+
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4", s.tableName)
+	if _, err := s.conn.Exec(statement); err != nil {
+		return errors.Annotatef(err, "error %s", statement)
+	}
+	return nil
+}
+
+func (s *MySQLStore) Load(key string) (Record, bool, error) {
+	records, err := s.History(key, 1)
+	if err != nil {
+		return Record{}, false, err
+	}
+	if len(records) == 0 {
+		return Record{}, false, nil
+	}
+	return records[0], true, nil
+}
+
+func (s *MySQLStore) Save(key string, value string) error {
+	record := newRecord(key, value)
+	statement := fmt.Sprintf("INSERT INTO %s (`name`, `value`, `update_time`) VALUES (?, ?, ?)", s.tableName)
+	if _, err := s.conn.Exec(statement, record.Key, record.Value, record.UpdatedAt); err != nil {
+		return errors.Annotatef(err, "error %s", statement)
+	}
+	return s.prune(key)
+}
+
+// prune 只保留最近 historySize 条位点
+func (s *MySQLStore) prune(key string) error {
+	statement := fmt.Sprintf("DELETE FROM %s WHERE `name` = ? AND `id` < ("+
+		"SELECT `id` FROM (SELECT `id` FROM %s WHERE `name` = ? ORDER BY `id` DESC LIMIT 1 OFFSET ?) t)",
+		s.tableName, s.tableName)
+	if _, err := s.conn.Exec(statement, key, key, s.historySize-1); err != nil {
+		return errors.Annotatef(err, "error %s", statement)
+	}
+	return nil
+}
+
+func (s *MySQLStore) History(key string, limit int) ([]Record, error) {
+	if limit <= 0 {
+		limit = s.historySize
+	}
+	statement := fmt.Sprintf("SELECT `name`, `value`, `update_time` FROM %s WHERE `name` = ? ORDER BY `id` DESC LIMIT ?", s.tableName)
+	rows, err := s.conn.Query(statement, key, limit)
+	if err != nil {
+		return nil, errors.Annotatef(err, "error %s", statement)
+	}
+	defer rows.Close()
+	records := make([]Record, 0, limit)
+	for rows.Next() {
+		var (
+			record     Record
+			updateTime sql.NullTime
+		)
+		if err = rows.Scan(&record.Key, &record.Value, &updateTime); err != nil {
+			return nil, errors.Trace(err)
+		}
+		record.UpdatedAt = updateTime.Time
+		records = append(records, record)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return records, nil
+}
+
+// Close conn 由调用方关闭
+func (s *MySQLStore) Close() error {
+	return nil
+}
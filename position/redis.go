@@ -0,0 +1,101 @@
+package position
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/xuenqlve/common/errors"
+)
+
+const DefaultPositionKeyPrefix = "dts:position"
+
+type RedisStoreConfig struct {
+	KeyPrefix   string `mapstructure:"key-prefix" toml:"key-prefix" json:"key-prefix" yaml:"key-prefix"`
+	HistorySize int    `mapstructure:"history-size" toml:"history-size" json:"history-size" yaml:"history-size"`
+}
+
+// RedisStore 当前位点保存在 string key 中，历史位点保存在 list 中
+type RedisStore struct {
+	client      redis.UniversalClient
+	prefix      string
+	historySize int
+}
+
+// NewRedisStore client 由调用方管理，Close 不会关闭 client
+func NewRedisStore(client redis.UniversalClient, cfg RedisStoreConfig) *RedisStore {
+	if cfg.KeyPrefix == "" {
+		cfg.KeyPrefix = DefaultPositionKeyPrefix
+	}
+	return &RedisStore{
+		client:      client,
+		prefix:      cfg.KeyPrefix,
+		historySize: historySize(cfg.HistorySize),
+	}
+}
+
+func (s *RedisStore) positionKey(key string) string {
+	return fmt.Sprintf("%s:{%s}", s.prefix, key)
+}
+
+func (s *RedisStore) historyKey(key string) string {
+	return fmt.Sprintf("%s:{%s}:history", s.prefix, key)
+}
+
+func (s *RedisStore) Load(key string) (Record, bool, error) {
+	data, err := s.client.Get(context.Background(), s.positionKey(key)).Bytes()
+	if err == redis.Nil {
+		return Record{}, false, nil
+	}
+	if err != nil {
+		return Record{}, false, errors.Trace(err)
+	}
+	record := Record{}
+	if err = json.Unmarshal(data, &record); err != nil {
+		return Record{}, false, errors.Annotatef(err, "decode position key %s", s.positionKey(key))
+	}
+	return record, true, nil
+}
+
+func (s *RedisStore) Save(key string, value string) error {
+	data, err := json.Marshal(newRecord(key, value))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// 使用 hash tag 保证两个 key 落在同一个 slot，集群模式下也可以使用事务
+	_, err = s.client.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.Set(context.Background(), s.positionKey(key), data, 0)
+		pipe.LPush(context.Background(), s.historyKey(key), data)
+		pipe.LTrim(context.Background(), s.historyKey(key), 0, int64(s.historySize-1))
+		return nil
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+func (s *RedisStore) History(key string, limit int) ([]Record, error) {
+	if limit <= 0 {
+		limit = s.historySize
+	}
+	list, err := s.client.LRange(context.Background(), s.historyKey(key), 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	records := make([]Record, 0, len(list))
+	for _, item := range list {
+		record := Record{}
+		if err = json.Unmarshal([]byte(item), &record); err != nil {
+			return nil, errors.Annotatef(err, "decode position history %s", s.historyKey(key))
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Close client 由调用方关闭
+func (s *RedisStore) Close() error {
+	return nil
+}
@@ -0,0 +1,38 @@
+package position
+
+import (
+	"time"
+)
+
+// DefaultHistorySize 每个 key 默认保留的历史位点数量
+const DefaultHistorySize = 100
+
+// Record 一次位点持久化记录，Value 为编码后的位点
+type Record struct {
+	Key       string    `json:"key" bson:"name"`
+	Value     string    `json:"value" bson:"value"`
+	UpdatedAt time.Time `json:"updated_at" bson:"update_time"`
+}
+
+// PositionStore 位点存储，Load 返回最近一次保存的位点，History 按时间倒序返回历史位点
+type PositionStore interface {
+	Load(key string) (Record, bool, error)
+	Save(key string, value string) error
+	History(key string, limit int) ([]Record, error)
+	Close() error
+}
+
+func historySize(size int) int {
+	if size <= 0 {
+		return DefaultHistorySize
+	}
+	return size
+}
+
+func newRecord(key, value string) Record {
+	return Record{
+		Key:       key,
+		Value:     value,
+		UpdatedAt: time.Now(),
+	}
+}
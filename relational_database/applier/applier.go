@@ -0,0 +1,267 @@
+package applier
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/xuenqlve/common/errors"
+	"github.com/xuenqlve/common/log"
+	"github.com/xuenqlve/common/relational_database/binlog"
+	"github.com/xuenqlve/common/relational_database/mysql"
+	"github.com/xuenqlve/common/schema_store"
+)
+
+const (
+	DefaultWorkerCount   = 8
+	DefaultBatchSize     = 200
+	DefaultQueueSize     = 1024
+	DefaultFlushInterval = 100 * time.Millisecond
+)
+
+type Config struct {
+	WorkerCount   int           `mapstructure:"worker-count" toml:"worker-count" json:"worker-count" yaml:"worker-count"`
+	BatchSize     int           `mapstructure:"batch-size" toml:"batch-size" json:"batch-size" yaml:"batch-size"`
+	QueueSize     int           `mapstructure:"queue-size" toml:"queue-size" json:"queue-size" yaml:"queue-size"`
+	FlushInterval time.Duration `mapstructure:"flush-interval" toml:"flush-interval" json:"flush-interval" yaml:"flush-interval"`
+}
+
+func (c *Config) init() {
+	if c.WorkerCount <= 0 {
+		c.WorkerCount = DefaultWorkerCount
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = DefaultQueueSize
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = DefaultFlushInterval
+	}
+}
+
+// Applier 按 库.表+guide key 的 hash 将行变更分发到多个有序 worker 并行写入 MySQL。
+// 同一行的变更总是落在同一个 worker，修改主键的 update 会先等待所有 worker 写完再单独执行。
+type Applier struct {
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+
+	cfg         Config
+	conn        *sql.DB
+	schemaStore schema_store.SchemaStore
+	workers     []*worker
+
+	mu        sync.Mutex
+	seq       uint64
+	positions map[uint64]binlog.Position
+	// applied 已全部写入的最大事务序号对应的位点
+	applied    binlog.Position
+	appliedSeq uint64
+	err        error
+}
+
+// NewApplier schemaStore 用于加载目标端表结构，一般为 schema_store.NewBaseSchemaStore(mysql.NewSchema(conn))
+func NewApplier(ctx context.Context, cfg Config, conn *sql.DB, schemaStore schema_store.SchemaStore) *Applier {
+	cfg.init()
+	ctxWithCancel, cancelFunc := context.WithCancel(ctx)
+	a := &Applier{
+		ctx:         ctxWithCancel,
+		cancelFunc:  cancelFunc,
+		cfg:         cfg,
+		conn:        conn,
+		schemaStore: schemaStore,
+		positions:   make(map[uint64]binlog.Position),
+	}
+	for i := 0; i < cfg.WorkerCount; i++ {
+		a.workers = append(a.workers, newWorker(i, a))
+	}
+	return a
+}
+
+// Start 启动全部 worker
+func (a *Applier) Start() {
+	for _, w := range a.workers {
+		a.wg.Add(1)
+		go func(w *worker) {
+			defer a.wg.Done()
+			w.run()
+		}(w)
+	}
+}
+
+// Apply 分发一个事务的行变更，pos 为事务结束后的位点。
+// 返回 nil 不代表已写入，写入进度通过 AppliedPosition 获取。
+func (a *Applier) Apply(changes []binlog.RowChange, pos binlog.Position) error {
+	if err := a.Err(); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.seq++
+	seq := a.seq
+	a.positions[seq] = pos
+	a.mu.Unlock()
+
+	for i := range changes {
+		change := changes[i]
+		if change.PrimaryKeyChanged() {
+			if err := a.applyConflict(change); err != nil {
+				return errors.Trace(err)
+			}
+			continue
+		}
+		row, err := change.RowData()
+		if err != nil {
+			return errors.Annotatef(err, "generate %s.%s guide keys", change.Database, change.Table)
+		}
+		if err = a.dispatch(a.partition(row.Key), task{change: change, row: row}); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	for _, w := range a.workers {
+		if err := a.dispatch(w.id, task{seq: seq}); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// applyConflict 修改主键的 update 前后镜像可能落在不同 worker，等待全部 worker 写完后直接执行
+func (a *Applier) applyConflict(change binlog.RowChange) error {
+	if err := a.Flush(); err != nil {
+		return errors.Trace(err)
+	}
+	log.Infof("applier primary key changed %s.%s %v -> %v, apply serially", change.Database, change.Table, change.Before, change.After)
+	row, err := change.RowData()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(a.exec([]task{{change: change, row: row}}))
+}
+
+func (a *Applier) partition(key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(a.workers)))
+}
+
+func (a *Applier) dispatch(index int, t task) error {
+	select {
+	case a.workers[index].queue <- t:
+		return nil
+	case <-a.ctx.Done():
+		return fmt.Errorf("applier closed")
+	}
+}
+
+// Flush 等待所有 worker 写完已分发的变更
+func (a *Applier) Flush() error {
+	dones := make([]chan error, 0, len(a.workers))
+	for _, w := range a.workers {
+		done := make(chan error, 1)
+		if err := a.dispatch(w.id, task{done: done}); err != nil {
+			return errors.Trace(err)
+		}
+		dones = append(dones, done)
+	}
+	for _, done := range dones {
+		select {
+		case err := <-done:
+			if err != nil {
+				return errors.Trace(err)
+			}
+		case <-a.ctx.Done():
+			return fmt.Errorf("applier closed")
+		}
+	}
+	return a.Err()
+}
+
+// AppliedPosition 返回所有 worker 都已写入的最低事务位点，可以安全地作为断点
+func (a *Applier) AppliedPosition() (binlog.Position, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	lowest := a.seq
+	for _, w := range a.workers {
+		if applied := w.appliedSeq(); applied < lowest {
+			lowest = applied
+		}
+	}
+	for seq := a.appliedSeq + 1; seq <= lowest; seq++ {
+		if pos, ok := a.positions[seq]; ok {
+			a.applied = pos
+			delete(a.positions, seq)
+		}
+	}
+	if lowest > a.appliedSeq {
+		a.appliedSeq = lowest
+	}
+	return a.applied, a.appliedSeq > 0
+}
+
+func (a *Applier) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+func (a *Applier) setErr(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err == nil {
+		a.err = err
+	}
+}
+
+// Close 写完已分发的变更后停止 worker
+func (a *Applier) Close() error {
+	err := a.Flush()
+	a.cancelFunc()
+	a.wg.Wait()
+	return err
+}
+
+func (a *Applier) tableDef(database, table string) (*mysql.Table, error) {
+	schema, err := a.schemaStore.GetSchema(&mysql.Index{Database: database, Table: table})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	tableDef, ok := schema.(*mysql.Table)
+	if !ok {
+		return nil, fmt.Errorf("schema of %s.%s is not *mysql.Table: %T", database, table, schema)
+	}
+	return tableDef, nil
+}
+
+// exec 将有序的变更按连续的 表+操作类型 分组生成批量 SQL，在一个事务中执行
+func (a *Applier) exec(tasks []task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	tx, err := a.conn.BeginTx(a.ctx, nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, group := range groupTasks(tasks) {
+		first := group[0].change
+		tableDef, err := a.tableDef(first.Database, first.Table)
+		if err != nil {
+			_ = tx.Rollback()
+			return errors.Trace(err)
+		}
+		statement, args, err := generateSQL(first.Type, group, tableDef)
+		if err != nil {
+			_ = tx.Rollback()
+			return errors.Annotatef(err, "generate %s sql for %s.%s", first.Type, first.Database, first.Table)
+		}
+		if _, err = tx.ExecContext(a.ctx, statement, args...); err != nil {
+			_ = tx.Rollback()
+			return errors.Annotatef(err, "exec %s", statement)
+		}
+	}
+	return errors.Trace(tx.Commit())
+}
@@ -0,0 +1,73 @@
+package applier
+
+import (
+	"testing"
+
+	"github.com/xuenqlve/common/relational_database/binlog"
+	"github.com/xuenqlve/common/schema_store"
+)
+
+func newTask(t *testing.T, dmlType schema_store.DML, table string, id int) task {
+	change := binlog.RowChange{
+		Database:   "db",
+		Table:      table,
+		Type:       dmlType,
+		PrimaryKey: []string{"id"},
+	}
+	image := map[string]any{"id": id, "name": "a"}
+	switch dmlType {
+	case schema_store.Insert:
+		change.After = image
+	case schema_store.Update:
+		change.Before, change.After = image, image
+	case schema_store.Delete:
+		change.Before = image
+	}
+	row, err := change.RowData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return task{change: change, row: row}
+}
+
+func TestGroupTasks(t *testing.T) {
+	tasks := []task{
+		newTask(t, schema_store.Insert, "a", 1),
+		newTask(t, schema_store.Insert, "a", 2),
+		{seq: 1},
+		newTask(t, schema_store.Insert, "a", 1),
+		newTask(t, schema_store.Update, "a", 3),
+		newTask(t, schema_store.Update, "b", 3),
+		newTask(t, schema_store.Delete, "b", 3),
+	}
+	groups := groupTasks(tasks)
+	sizes := []int{2, 1, 1, 1, 1}
+	if len(groups) != len(sizes) {
+		t.Fatalf("unexpected group count %d", len(groups))
+	}
+	for i, size := range sizes {
+		if len(groups[i]) != size {
+			t.Fatalf("group %d size %d, expected %d", i, len(groups[i]), size)
+		}
+	}
+}
+
+func TestAppliedPosition(t *testing.T) {
+	a := NewApplier(t.Context(), Config{WorkerCount: 2}, nil, nil)
+	a.seq = 3
+	a.positions[1] = binlog.Position{BinLogFileName: "f", BinLogFilePos: 1}
+	a.positions[2] = binlog.Position{BinLogFileName: "f", BinLogFilePos: 2}
+	a.positions[3] = binlog.Position{BinLogFileName: "f", BinLogFilePos: 3}
+	if _, ok := a.AppliedPosition(); ok {
+		t.Fatal("nothing applied yet")
+	}
+	a.workers[0].applied.Store(3)
+	a.workers[1].applied.Store(2)
+	pos, ok := a.AppliedPosition()
+	if !ok || pos.BinLogFilePos != 2 {
+		t.Fatalf("unexpected applied position %v", pos)
+	}
+	if a.partition("db.a.id.1") != a.partition("db.a.id.1") {
+		t.Fatal("partition should be stable")
+	}
+}
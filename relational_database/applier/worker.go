@@ -0,0 +1,144 @@
+package applier
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/xuenqlve/common/log"
+	"github.com/xuenqlve/common/relational_database/binlog"
+	"github.com/xuenqlve/common/relational_database/generate_sql"
+	"github.com/xuenqlve/common/relational_database/mysql"
+	"github.com/xuenqlve/common/schema_store"
+)
+
+// task 行变更、事务结束标记(seq) 或 flush 请求(done) 三选一
+type task struct {
+	change binlog.RowChange
+	row    mysql.RowData
+	seq    uint64
+	done   chan error
+}
+
+func (t task) isChange() bool {
+	return t.seq == 0 && t.done == nil
+}
+
+type worker struct {
+	id      int
+	applier *Applier
+	queue   chan task
+	buffer  []task
+	// pendingSeq 缓存中最后一个事务结束标记，flush 成功后更新 applied
+	pendingSeq uint64
+	applied    atomic.Uint64
+}
+
+func newWorker(id int, a *Applier) *worker {
+	return &worker{
+		id:      id,
+		applier: a,
+		queue:   make(chan task, a.cfg.QueueSize),
+	}
+}
+
+func (w *worker) appliedSeq() uint64 {
+	return w.applied.Load()
+}
+
+func (w *worker) run() {
+	ticker := time.NewTicker(w.applier.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.applier.ctx.Done():
+			return
+		case t := <-w.queue:
+			switch {
+			case t.done != nil:
+				t.done <- w.flush()
+			case t.seq > 0:
+				if len(w.buffer) == 0 {
+					w.applied.Store(t.seq)
+				} else {
+					w.pendingSeq = t.seq
+				}
+			default:
+				w.buffer = append(w.buffer, t)
+				if len(w.buffer) >= w.applier.cfg.BatchSize {
+					_ = w.flush()
+				}
+			}
+		case <-ticker.C:
+			_ = w.flush()
+		}
+	}
+}
+
+func (w *worker) flush() error {
+	if err := w.applier.Err(); err != nil {
+		return err
+	}
+	if len(w.buffer) > 0 {
+		if err := w.applier.exec(w.buffer); err != nil {
+			log.Errorf("applier worker %d exec err: %v", w.id, err)
+			w.applier.setErr(err)
+			return err
+		}
+		w.buffer = w.buffer[:0]
+	}
+	if w.pendingSeq > 0 {
+		w.applied.Store(w.pendingSeq)
+		w.pendingSeq = 0
+	}
+	return nil
+}
+
+// groupTasks 将连续的同表同操作类型变更分为一组，组内出现重复 key 时拆分，保证同一行的变更顺序
+func groupTasks(tasks []task) [][]task {
+	var (
+		groups [][]task
+		group  []task
+		keys   map[string]struct{}
+	)
+	for _, t := range tasks {
+		if !t.isChange() {
+			continue
+		}
+		if len(group) > 0 {
+			last := group[0].change
+			_, duplicate := keys[t.row.Key]
+			if last.Database != t.change.Database || last.Table != t.change.Table || last.Type != t.change.Type || duplicate {
+				groups = append(groups, group)
+				group = nil
+			}
+		}
+		if len(group) == 0 {
+			keys = make(map[string]struct{})
+		}
+		group = append(group, t)
+		keys[t.row.Key] = struct{}{}
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// generateSQL insert 使用 insert on duplicate key update 保证重放幂等
+func generateSQL(dmlType schema_store.DML, group []task, tableDef *mysql.Table) (string, []any, error) {
+	rows := make([]mysql.RowData, 0, len(group))
+	for _, t := range group {
+		rows = append(rows, t.row)
+	}
+	switch dmlType {
+	case schema_store.Insert:
+		return generate_sql.GenerateInsertOnDuplicateKeyUpdateSQL(rows, tableDef)
+	case schema_store.Update:
+		return generate_sql.GenerateUpdateSQLByJoin(rows, tableDef, true)
+	case schema_store.Delete:
+		return generate_sql.GenerateDeleteSQL(rows, tableDef)
+	default:
+		return "", nil, fmt.Errorf("unknown dml type: %v", dmlType)
+	}
+}
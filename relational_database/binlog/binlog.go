@@ -2,6 +2,7 @@ package binlog
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/go-mysql-org/go-mysql/canal"
 	"github.com/go-mysql-org/go-mysql/mysql"
@@ -9,10 +10,39 @@ import (
 	"github.com/xuenqlve/common/errors"
 )
 
+const (
+	FlavorMySQL   = "mysql"
+	FlavorMariaDB = "mariadb"
+	FlavorPercona = "percona"
+)
+
+// CheckFlavor 校验 flavor，空值视为 mysql
+func CheckFlavor(flavor string) error {
+	switch strings.ToLower(flavor) {
+	case "", FlavorMySQL, FlavorMariaDB, FlavorPercona:
+		return nil
+	default:
+		return fmt.Errorf("unsupported flavor: %s", flavor)
+	}
+}
+
+// syncerFlavor 转换为 go-mysql 使用的 flavor，percona 与 mysql 协议一致
+func syncerFlavor(flavor string) string {
+	if strings.ToLower(flavor) == FlavorMariaDB {
+		return mysql.MariaDBFlavor
+	}
+	return mysql.MySQLFlavor
+}
+
 func NewBinlogCanal(serverID uint32, host string, port uint16, user, password string) (*canal.Canal, error) {
+	return NewBinlogCanalWithFlavor(FlavorMySQL, serverID, host, port, user, password)
+}
+
+// NewBinlogCanalWithFlavor flavor 为 mysql | mariadb | percona
+func NewBinlogCanalWithFlavor(flavor string, serverID uint32, host string, port uint16, user, password string) (*canal.Canal, error) {
 	canalConfig := &canal.Config{
 		ServerID:             serverID,
-		Flavor:               "mysql",
+		Flavor:               syncerFlavor(flavor),
 		Addr:                 fmt.Sprintf("%s:%d", host, port),
 		User:                 user,
 		Password:             password,
@@ -23,6 +53,11 @@ func NewBinlogCanal(serverID uint32, host string, port uint16, user, password st
 }
 
 func CanalRunFrom(c *canal.Canal, position Position) error {
+	return CanalRunFromWithFlavor(c, FlavorMySQL, position)
+}
+
+// CanalRunFromWithFlavor flavor 决定 GTID 的解析方式
+func CanalRunFromWithFlavor(c *canal.Canal, flavor string, position Position) error {
 	if position.BinlogGTID == "" {
 		pos := mysql.Position{
 			Name: position.BinLogFileName,
@@ -31,7 +66,7 @@ func CanalRunFrom(c *canal.Canal, position Position) error {
 		return c.RunFrom(pos)
 
 	} else {
-		gtidSet, err := mysql.ParseMysqlGTIDSet(position.BinlogGTID)
+		gtidSet, err := position.GTIDSet(flavor)
 		if err != nil {
 			return err
 		}
@@ -40,9 +75,18 @@ func CanalRunFrom(c *canal.Canal, position Position) error {
 }
 
 func NewBinlogSyncer(serverID uint32, host string, port uint16, user, password string) *replication.BinlogSyncer {
-	syncerConfig := replication.BinlogSyncerConfig{
+	return NewBinlogSyncerWithFlavor(FlavorMySQL, serverID, host, port, user, password)
+}
+
+// NewBinlogSyncerWithFlavor flavor 为 mysql | mariadb | percona
+func NewBinlogSyncerWithFlavor(flavor string, serverID uint32, host string, port uint16, user, password string) *replication.BinlogSyncer {
+	return replication.NewBinlogSyncer(binlogSyncerConfig(flavor, serverID, host, port, user, password))
+}
+
+func binlogSyncerConfig(flavor string, serverID uint32, host string, port uint16, user, password string) replication.BinlogSyncerConfig {
+	return replication.BinlogSyncerConfig{
 		ServerID:             serverID,
-		Flavor:               "mysql",
+		Flavor:               syncerFlavor(flavor),
 		Host:                 host,
 		Port:                 port,
 		User:                 user,
@@ -50,11 +94,14 @@ func NewBinlogSyncer(serverID uint32, host string, port uint16, user, password s
 		ParseTime:            true,
 		MaxReconnectAttempts: 10,
 	}
+}
 
-	return replication.NewBinlogSyncer(syncerConfig)
+func NewBinlogStreamer(syncer *replication.BinlogSyncer, position Position) (*replication.BinlogStreamer, error) {
+	return NewBinlogStreamerWithFlavor(syncer, FlavorMySQL, position)
 }
 
-func NewBinlogStreamer(syncer *replication.BinlogSyncer, position Position) (streamer *replication.BinlogStreamer, err error) {
+// NewBinlogStreamerWithFlavor flavor 决定 GTID 的解析方式
+func NewBinlogStreamerWithFlavor(syncer *replication.BinlogSyncer, flavor string, position Position) (streamer *replication.BinlogStreamer, err error) {
 	if position.BinlogGTID == "" {
 		pos := mysql.Position{
 			Name: position.BinLogFileName,
@@ -66,7 +113,7 @@ func NewBinlogStreamer(syncer *replication.BinlogSyncer, position Position) (str
 		}
 	} else {
 		var gtidSet mysql.GTIDSet
-		gtidSet, err = mysql.ParseMysqlGTIDSet(position.BinlogGTID)
+		gtidSet, err = position.GTIDSet(flavor)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
@@ -0,0 +1,461 @@
+package binlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xuenqlve/common/relational_database/mysql"
+	"github.com/xuenqlve/common/schema_store"
+)
+
+const (
+	EnvelopeCanal    = "canal"
+	EnvelopeDebezium = "debezium"
+	EnvelopeMaxwell  = "maxwell"
+)
+
+const envelopeTimeLayout = "2006-01-02 15:04:05"
+
+// DDLChange 解析后的 DDL 变更
+type DDLChange struct {
+	Database string
+	Table    string
+	Type     schema_store.DDL
+	SQL      string
+}
+
+// EventMeta 变更所在 binlog 事件的元信息
+type EventMeta struct {
+	ServerName string
+	ServerID   uint32
+	// Position 事务开始时的位点
+	Position Position
+	GTID     string
+	// Timestamp binlog 事件时间(秒)
+	Timestamp uint32
+	XID       uint64
+	// Row 行在事务中的序号
+	Row int
+	// Commit 是否事务最后一行
+	Commit bool
+	// Query binlog_rows_query_log_events=ON 时的原始 SQL
+	Query string
+}
+
+// EnvelopeEncoder 将变更编码为 kafka 消息 key/value，value 为 nil 时表示该格式不输出此变更
+type EnvelopeEncoder interface {
+	EncodeRow(change RowChange, meta EventMeta) (key []byte, value []byte, err error)
+	EncodeDDL(change DDLChange, meta EventMeta) (key []byte, value []byte, err error)
+}
+
+func NewEnvelopeEncoder(format string) (EnvelopeEncoder, error) {
+	switch strings.ToLower(format) {
+	case EnvelopeCanal, "":
+		return &CanalEncoder{}, nil
+	case EnvelopeDebezium:
+		return &DebeziumEncoder{}, nil
+	case EnvelopeMaxwell:
+		return &MaxwellEncoder{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported envelope format: %s", format)
+	}
+}
+
+// CanalEncoder canal flat message 格式，列值统一转为字符串
+type CanalEncoder struct {
+	id int64
+}
+
+type canalMessage struct {
+	ID        int64             `json:"id"`
+	Database  string            `json:"database"`
+	Table     string            `json:"table"`
+	PkNames   []string          `json:"pkNames"`
+	IsDdl     bool              `json:"isDdl"`
+	Type      string            `json:"type"`
+	Es        int64             `json:"es"`
+	Ts        int64             `json:"ts"`
+	SQL       string            `json:"sql"`
+	SqlType   map[string]int    `json:"sqlType"`
+	MysqlType map[string]string `json:"mysqlType"`
+	Data      []map[string]any  `json:"data"`
+	Old       []map[string]any  `json:"old"`
+	Gtid      string            `json:"gtid,omitempty"`
+}
+
+var canalDDLType = map[schema_store.DDL]string{
+	schema_store.CREATE_TABLE:        "CREATE",
+	schema_store.ALTER_TABLE:         "ALTER",
+	schema_store.DROP_TABLE:          "ERASE",
+	schema_store.RENAME_TABLE:        "RENAME",
+	schema_store.TRUNCATE_TABLE:      "TRUNCATE",
+	schema_store.CREATE_INDEX:        "CINDEX",
+	schema_store.DROP_INDEX:          "DINDEX",
+	schema_store.CREATE_DATABASE:     "QUERY",
+	schema_store.DROP_DATABASE:       "QUERY",
+	schema_store.CREATE_TABLE_LIKE:   "CREATE",
+	schema_store.CREATE_TABLE_SELECT: "CREATE",
+	schema_store.ADD_PARTITION:       "ALTER",
+	schema_store.DROP_PARTITION:      "ALTER",
+	schema_store.TRUNCATE_PARTITION:  "ALTER",
+}
+
+func (e *CanalEncoder) EncodeRow(change RowChange, meta EventMeta) ([]byte, []byte, error) {
+	e.id++
+	msg := canalMessage{
+		ID:        e.id,
+		Database:  change.Database,
+		Table:     change.Table,
+		PkNames:   change.PrimaryKey,
+		Type:      strings.ToUpper(change.Type.String()),
+		Es:        int64(meta.Timestamp) * 1000,
+		Ts:        time.Now().UnixMilli(),
+		SQL:       meta.Query,
+		SqlType:   make(map[string]int, len(change.Columns)),
+		MysqlType: make(map[string]string, len(change.Columns)),
+		Gtid:      meta.GTID,
+	}
+	for _, column := range change.Columns {
+		msg.SqlType[column.Name] = javaSQLType(column)
+		msg.MysqlType[column.Name] = column.RawType
+	}
+	msg.Data = []map[string]any{canalValues(change.Image())}
+	if change.Type == schema_store.Update {
+		msg.Old = []map[string]any{canalValues(changedColumns(change.Before, change.After))}
+	}
+	value, err := json.Marshal(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []byte(change.Key()), value, nil
+}
+
+func (e *CanalEncoder) EncodeDDL(change DDLChange, meta EventMeta) ([]byte, []byte, error) {
+	e.id++
+	ddlType, ok := canalDDLType[change.Type]
+	if !ok {
+		ddlType, ok = canalDDLType[change.Type.Base()]
+	}
+	if !ok {
+		ddlType = "QUERY"
+	}
+	msg := canalMessage{
+		ID:       e.id,
+		Database: change.Database,
+		Table:    change.Table,
+		IsDdl:    true,
+		Type:     ddlType,
+		Es:       int64(meta.Timestamp) * 1000,
+		Ts:       time.Now().UnixMilli(),
+		SQL:      change.SQL,
+		Gtid:     meta.GTID,
+	}
+	value, err := json.Marshal(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []byte(change.Database), value, nil
+}
+
+// DebeziumEncoder debezium mysql connector 格式(不带 schema)
+type DebeziumEncoder struct{}
+
+type debeziumSource struct {
+	Version   string `json:"version"`
+	Connector string `json:"connector"`
+	Name      string `json:"name"`
+	TsMs      int64  `json:"ts_ms"`
+	Snapshot  string `json:"snapshot"`
+	Db        string `json:"db"`
+	Table     string `json:"table,omitempty"`
+	ServerID  uint32 `json:"server_id"`
+	Gtid      string `json:"gtid,omitempty"`
+	File      string `json:"file"`
+	Pos       uint32 `json:"pos"`
+	Row       int    `json:"row"`
+	Query     string `json:"query,omitempty"`
+}
+
+type debeziumMessage struct {
+	Before map[string]any `json:"before"`
+	After  map[string]any `json:"after"`
+	Source debeziumSource `json:"source"`
+	Op     string         `json:"op"`
+	TsMs   int64          `json:"ts_ms"`
+}
+
+type debeziumSchemaChange struct {
+	Source       debeziumSource  `json:"source"`
+	DatabaseName string          `json:"databaseName"`
+	SchemaName   string          `json:"schemaName,omitempty"`
+	DDL          string          `json:"ddl"`
+	TableChanges []debeziumTable `json:"tableChanges"`
+}
+
+type debeziumTable struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+var debeziumOp = map[schema_store.DML]string{
+	schema_store.Insert: "c",
+	schema_store.Update: "u",
+	schema_store.Delete: "d",
+}
+
+func (e *DebeziumEncoder) source(database, table string, meta EventMeta) debeziumSource {
+	return debeziumSource{
+		Version:   "1.0",
+		Connector: "mysql",
+		Name:      meta.ServerName,
+		TsMs:      int64(meta.Timestamp) * 1000,
+		Snapshot:  "false",
+		Db:        database,
+		Table:     table,
+		ServerID:  meta.ServerID,
+		Gtid:      meta.GTID,
+		File:      meta.Position.BinLogFileName,
+		Pos:       meta.Position.BinLogFilePos,
+		Row:       meta.Row,
+		Query:     meta.Query,
+	}
+}
+
+func (e *DebeziumEncoder) EncodeRow(change RowChange, meta EventMeta) ([]byte, []byte, error) {
+	msg := debeziumMessage{
+		Before: jsonValues(change.Before),
+		After:  jsonValues(change.After),
+		Source: e.source(change.Database, change.Table, meta),
+		Op:     debeziumOp[change.Type],
+		TsMs:   time.Now().UnixMilli(),
+	}
+	keyData := make(map[string]any, len(change.PrimaryKey))
+	image := change.Image()
+	for _, column := range change.PrimaryKey {
+		keyData[column] = jsonValue(image[column])
+	}
+	key, err := json.Marshal(keyData)
+	if err != nil {
+		return nil, nil, err
+	}
+	value, err := json.Marshal(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, value, nil
+}
+
+func (e *DebeziumEncoder) EncodeDDL(change DDLChange, meta EventMeta) ([]byte, []byte, error) {
+	msg := debeziumSchemaChange{
+		Source:       e.source(change.Database, change.Table, meta),
+		DatabaseName: change.Database,
+		DDL:          change.SQL,
+		TableChanges: []debeziumTable{},
+	}
+	if change.Table != "" {
+		tableChange := debeziumTable{Type: "ALTER", ID: fmt.Sprintf("\"%s\".\"%s\"", change.Database, change.Table)}
+		switch change.Type.Base() {
+		case schema_store.CREATE_TABLE, schema_store.CREATE_TABLE_LIKE, schema_store.CREATE_TABLE_SELECT:
+			tableChange.Type = "CREATE"
+		case schema_store.DROP_TABLE:
+			tableChange.Type = "DROP"
+		}
+		msg.TableChanges = append(msg.TableChanges, tableChange)
+	}
+	key, err := json.Marshal(map[string]string{"databaseName": change.Database})
+	if err != nil {
+		return nil, nil, err
+	}
+	value, err := json.Marshal(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, value, nil
+}
+
+// MaxwellEncoder maxwell 格式
+type MaxwellEncoder struct{}
+
+type maxwellMessage struct {
+	Database string         `json:"database"`
+	Table    string         `json:"table"`
+	Type     string         `json:"type"`
+	Ts       int64          `json:"ts"`
+	Xid      uint64         `json:"xid,omitempty"`
+	Commit   bool           `json:"commit,omitempty"`
+	Position string         `json:"position,omitempty"`
+	Gtid     string         `json:"gtid,omitempty"`
+	ServerID uint32         `json:"server_id,omitempty"`
+	Data     map[string]any `json:"data"`
+	Old      map[string]any `json:"old,omitempty"`
+}
+
+type maxwellDDLMessage struct {
+	Type     string `json:"type"`
+	Database string `json:"database"`
+	Table    string `json:"table,omitempty"`
+	SQL      string `json:"sql"`
+	Ts       int64  `json:"ts"`
+	Position string `json:"position,omitempty"`
+	Gtid     string `json:"gtid,omitempty"`
+}
+
+var maxwellDDLType = map[schema_store.DDL]string{
+	schema_store.CREATE_DATABASE:     "database-create",
+	schema_store.DROP_DATABASE:       "database-drop",
+	schema_store.CREATE_TABLE:        "table-create",
+	schema_store.DROP_TABLE:          "table-drop",
+	schema_store.ALTER_TABLE:         "table-alter",
+	schema_store.RENAME_TABLE:        "table-alter",
+	schema_store.CREATE_INDEX:        "table-alter",
+	schema_store.DROP_INDEX:          "table-alter",
+	schema_store.CREATE_TABLE_LIKE:   "table-create",
+	schema_store.CREATE_TABLE_SELECT: "table-create",
+	schema_store.ADD_PARTITION:       "table-alter",
+	schema_store.DROP_PARTITION:      "table-alter",
+	schema_store.TRUNCATE_PARTITION:  "table-alter",
+}
+
+func maxwellPosition(pos Position) string {
+	if pos.BinLogFileName == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", pos.BinLogFileName, pos.BinLogFilePos)
+}
+
+func (e *MaxwellEncoder) EncodeRow(change RowChange, meta EventMeta) ([]byte, []byte, error) {
+	msg := maxwellMessage{
+		Database: change.Database,
+		Table:    change.Table,
+		Type:     change.Type.String(),
+		Ts:       int64(meta.Timestamp),
+		Xid:      meta.XID,
+		Commit:   meta.Commit,
+		Position: maxwellPosition(meta.Position),
+		Gtid:     meta.GTID,
+		ServerID: meta.ServerID,
+		Data:     jsonValues(change.Image()),
+	}
+	if change.Type == schema_store.Update {
+		msg.Old = jsonValues(changedColumns(change.Before, change.After))
+	}
+	value, err := json.Marshal(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []byte(change.Key()), value, nil
+}
+
+func (e *MaxwellEncoder) EncodeDDL(change DDLChange, meta EventMeta) ([]byte, []byte, error) {
+	ddlType, ok := maxwellDDLType[change.Type]
+	if !ok {
+		ddlType, ok = maxwellDDLType[change.Type.Base()]
+	}
+	if !ok {
+		return nil, nil, nil
+	}
+	msg := maxwellDDLMessage{
+		Type:     ddlType,
+		Database: change.Database,
+		Table:    change.Table,
+		SQL:      change.SQL,
+		Ts:       int64(meta.Timestamp),
+		Position: maxwellPosition(meta.Position),
+		Gtid:     meta.GTID,
+	}
+	value, err := json.Marshal(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []byte(change.Database), value, nil
+}
+
+// changedColumns 返回 update 中被修改列的旧值
+func changedColumns(before, after map[string]any) map[string]any {
+	old := make(map[string]any)
+	for name, value := range before {
+		if fmt.Sprint(value) != fmt.Sprint(after[name]) {
+			old[name] = value
+		}
+	}
+	return old
+}
+
+func jsonValue(value any) any {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(envelopeTimeLayout)
+	default:
+		return v
+	}
+}
+
+func jsonValues(row map[string]any) map[string]any {
+	if row == nil {
+		return nil
+	}
+	values := make(map[string]any, len(row))
+	for name, value := range row {
+		values[name] = jsonValue(value)
+	}
+	return values
+}
+
+func canalValues(row map[string]any) map[string]any {
+	values := make(map[string]any, len(row))
+	for name, value := range row {
+		if value == nil {
+			values[name] = nil
+			continue
+		}
+		values[name] = fmt.Sprint(jsonValue(value))
+	}
+	return values
+}
+
+// javaSQLType 对应 java.sql.Types
+func javaSQLType(column mysql.Column) int {
+	rawType := strings.ToLower(column.RawType)
+	switch column.Type {
+	case mysql.TypeNumber, mysql.TypeMediumInt:
+		switch {
+		case strings.HasPrefix(rawType, "tinyint"):
+			return -6
+		case strings.HasPrefix(rawType, "smallint"):
+			return 5
+		case strings.HasPrefix(rawType, "bigint"):
+			return -5
+		default:
+			return 4
+		}
+	case mysql.TypeFloat:
+		return 7
+	case mysql.TypeDouble:
+		return 8
+	case mysql.TypeDecimal:
+		return 3
+	case mysql.TypeDatetime, mysql.TypeTimestamp:
+		return 93
+	case mysql.TypeDate:
+		return 91
+	case mysql.TypeTime:
+		return 92
+	case mysql.TypeBit:
+		return -7
+	case mysql.TypeEnum, mysql.TypeSet:
+		return 1
+	}
+	switch {
+	case strings.Contains(rawType, "blob") || strings.Contains(rawType, "binary"):
+		return 2004
+	case strings.Contains(rawType, "text"):
+		return 2005
+	case strings.HasPrefix(rawType, "char"):
+		return 1
+	}
+	return 12
+}
@@ -0,0 +1,132 @@
+package binlog
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/xuenqlve/common/ddl_parser"
+	"github.com/xuenqlve/common/relational_database/mysql"
+	"github.com/xuenqlve/common/schema_store"
+)
+
+func testUpdateChange() RowChange {
+	return RowChange{
+		Database: "db",
+		Table:    "user",
+		Type:     schema_store.Update,
+		Columns: []mysql.Column{
+			{Name: "id", Type: mysql.TypeNumber, RawType: "bigint(20)", IsPrimaryKey: true},
+			{Name: "name", Type: mysql.TypeString, RawType: "varchar(32)"},
+		},
+		PrimaryKey: []string{"id"},
+		Before:     map[string]any{"id": int64(1), "name": "a"},
+		After:      map[string]any{"id": int64(1), "name": "b"},
+	}
+}
+
+func TestCanalEncoder(t *testing.T) {
+	encoder, _ := NewEnvelopeEncoder(EnvelopeCanal)
+	key, value, err := encoder.EncodeRow(testUpdateChange(), EventMeta{Timestamp: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(key) != mysql.MakeRowKey("db", "user", "id.1") {
+		t.Fatalf("unexpected key %s", key)
+	}
+	msg := canalMessage{}
+	if err = json.Unmarshal(value, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "UPDATE" || msg.Es != 10000 || msg.SqlType["id"] != -5 {
+		t.Fatalf("unexpected message %s", value)
+	}
+	if msg.Data[0]["name"] != "b" || msg.Data[0]["id"] != "1" {
+		t.Fatalf("unexpected data %v", msg.Data)
+	}
+	if len(msg.Old[0]) != 1 || msg.Old[0]["name"] != "a" {
+		t.Fatalf("unexpected old %v", msg.Old)
+	}
+}
+
+func TestDebeziumEncoder(t *testing.T) {
+	encoder, _ := NewEnvelopeEncoder(EnvelopeDebezium)
+	pos := Position{BinLogFileName: "mysql-bin.000001", BinLogFilePos: 4}
+	key, value, err := encoder.EncodeRow(testUpdateChange(), EventMeta{Position: pos, ServerName: "dts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(key) != `{"id":1}` {
+		t.Fatalf("unexpected key %s", key)
+	}
+	msg := debeziumMessage{}
+	if err = json.Unmarshal(value, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Op != "u" || msg.Source.File != pos.BinLogFileName || msg.Source.Name != "dts" || msg.Before["name"] != "a" {
+		t.Fatalf("unexpected message %s", value)
+	}
+}
+
+func TestMaxwellEncoder(t *testing.T) {
+	encoder, _ := NewEnvelopeEncoder(EnvelopeMaxwell)
+	_, value, err := encoder.EncodeRow(testUpdateChange(), EventMeta{XID: 7, Commit: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := maxwellMessage{}
+	if err = json.Unmarshal(value, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "update" || msg.Xid != 7 || !msg.Commit || msg.Old["name"] != "a" {
+		t.Fatalf("unexpected message %s", value)
+	}
+	_, value, err = encoder.EncodeDDL(DDLChange{Database: "db", Table: "user", Type: schema_store.TRUNCATE_TABLE}, EventMeta{})
+	if err != nil || value != nil {
+		t.Fatalf("truncate should be skipped, got %s %v", value, err)
+	}
+	_, value, err = encoder.EncodeDDL(DDLChange{Database: "db", Table: "v", Type: schema_store.DROP_VIEW}, EventMeta{})
+	if err != nil || !strings.Contains(string(value), `"type":"table-drop"`) {
+		t.Fatalf("drop view should keep table-drop, got %s %v", value, err)
+	}
+}
+
+func TestTopic(t *testing.T) {
+	cfg := KafkaPublisherConfig{}
+	cfg.init()
+	if topic := cfg.Topic("db", "user"); topic != "db.user" {
+		t.Fatalf("unexpected topic %s", topic)
+	}
+	if topic := cfg.Topic("db", ""); topic != "db" {
+		t.Fatalf("unexpected topic %s", topic)
+	}
+	router, err := ddl_parser.NewRouter(ddl_parser.RouterConfig{Topics: []ddl_parser.RouteRule{{Pattern: "db.*", Target: "cdc_$1_v2"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Router = router
+	if topic := cfg.Topic("db", "user"); topic != "cdc_user_v2" {
+		t.Fatalf("unexpected routed topic %s", topic)
+	}
+	if topic := cfg.Topic("other", "user"); topic != "other.user" {
+		t.Fatalf("unexpected unrouted topic %s", topic)
+	}
+}
+
+func TestSplitPrimaryKeyUpdate(t *testing.T) {
+	change := testUpdateChange()
+	if rows := change.SplitPrimaryKeyUpdate(); len(rows) != 1 || rows[0].Type != schema_store.Update {
+		t.Fatalf("update without primary key change: %+v", rows)
+	}
+	change.After = map[string]any{"id": int64(2), "name": "b"}
+	rows := change.SplitPrimaryKeyUpdate()
+	if len(rows) != 2 || rows[0].Type != schema_store.Delete || rows[1].Type != schema_store.Insert {
+		t.Fatalf("split: %+v", rows)
+	}
+	encoder, _ := NewEnvelopeEncoder(EnvelopeCanal)
+	oldKey, _, _ := encoder.EncodeRow(rows[0], EventMeta{})
+	newKey, _, _ := encoder.EncodeRow(rows[1], EventMeta{})
+	if string(oldKey) != testUpdateChange().Key() || string(newKey) != change.Key() {
+		t.Fatalf("canal keys: %s %s", oldKey, newKey)
+	}
+}
@@ -0,0 +1,209 @@
+package binlog
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/xuenqlve/common/ddl_parser"
+	"github.com/xuenqlve/common/match"
+	"github.com/xuenqlve/common/schema_store"
+	sql_tool "github.com/xuenqlve/common/sql"
+	"github.com/xuenqlve/common/transform"
+)
+
+// TableFilterRule 表过滤规则，库名为 glob，表名规则与 mysql.TableFilterConfig 一致
+type TableFilterRule struct {
+	Database         string   `mapstructure:"database" toml:"database" json:"database" yaml:"database"`
+	AcceptTableRegex []string `mapstructure:"accept-table-regex" toml:"accept-table-regex" json:"accept-table-regex" yaml:"accept-table-regex"`
+	IgnoreTableRegex []string `mapstructure:"ignore-table-regex" toml:"ignore-table-regex" json:"ignore-table-regex" yaml:"ignore-table-regex"`
+	// AcceptDML 为空时接收全部 DML 类型
+	AcceptDML []string `mapstructure:"accept-dml" toml:"accept-dml" json:"accept-dml" yaml:"accept-dml"`
+	// IgnoreColumns 表名 -> 需要剔除的列，不能包含主键列；BinlogReader 依赖 binlog_row_metadata=FULL 提供列名
+	IgnoreColumns map[string][]string `mapstructure:"ignore-columns" toml:"ignore-columns" json:"ignore-columns" yaml:"ignore-columns"`
+}
+
+func (r *TableFilterRule) Check() error {
+	if r.Database == "" {
+		return fmt.Errorf("table-filter need database")
+	}
+	for _, dml := range r.AcceptDML {
+		if _, ok := schema_store.DMLMap[dml]; !ok {
+			return fmt.Errorf("table-filter database:%s unknown dml type:%s", r.Database, dml)
+		}
+	}
+	return nil
+}
+
+func (r *TableFilterRule) matchTable(database, table string) bool {
+	if !match.Glob(r.Database, database) {
+		return false
+	}
+	if match.MatchRegex(table, r.IgnoreTableRegex) {
+		return false
+	}
+	return len(r.AcceptTableRegex) == 0 || match.MatchRegex(table, r.AcceptTableRegex)
+}
+
+type tableFilterResult struct {
+	accept        bool
+	dml           map[string]struct{}
+	ignoreColumns map[string]struct{}
+}
+
+// TableFilter 按规则过滤 binlog 事件，命中任意规则即接收，没有规则时全部接收
+type TableFilter struct {
+	rules []TableFilterRule
+	ddl   [][]ddl_parser.FilterOption
+
+	mu    sync.RWMutex
+	cache map[string]*tableFilterResult
+}
+
+func NewTableFilter(rules []TableFilterRule) (*TableFilter, error) {
+	f := &TableFilter{
+		rules: rules,
+		cache: make(map[string]*tableFilterResult),
+	}
+	for i := range rules {
+		if err := rules[i].Check(); err != nil {
+			return nil, err
+		}
+		f.ddl = append(f.ddl, []ddl_parser.FilterOption{
+			ddl_parser.MatchDatabaseTable(rules[i].Database, rules[i].AcceptTableRegex, rules[i].IgnoreTableRegex),
+		})
+	}
+	return f, nil
+}
+
+func (f *TableFilter) Empty() bool {
+	return f == nil || len(f.rules) == 0
+}
+
+func (f *TableFilter) result(database, table string) *tableFilterResult {
+	key := sql_tool.UniqueID(database, table)
+	f.mu.RLock()
+	result, ok := f.cache[key]
+	f.mu.RUnlock()
+	if ok {
+		return result
+	}
+
+	result = &tableFilterResult{}
+	for _, rule := range f.rules {
+		if !rule.matchTable(database, table) {
+			continue
+		}
+		result.accept = true
+		if len(rule.AcceptDML) > 0 {
+			result.dml = transform.StringSliceToMap(rule.AcceptDML)
+		}
+		if columns := rule.IgnoreColumns[table]; len(columns) > 0 {
+			result.ignoreColumns = transform.StringSliceToMap(columns)
+		}
+		break
+	}
+	f.mu.Lock()
+	f.cache[key] = result
+	f.mu.Unlock()
+	return result
+}
+
+// AcceptTable 表是否需要同步
+func (f *TableFilter) AcceptTable(database, table string) bool {
+	if f.Empty() {
+		return true
+	}
+	return f.result(database, table).accept
+}
+
+// AcceptDML 表的该类 DML 是否需要同步
+func (f *TableFilter) AcceptDML(database, table string, dmlType schema_store.DML) bool {
+	if f.Empty() {
+		return true
+	}
+	result := f.result(database, table)
+	if !result.accept {
+		return false
+	}
+	if result.dml == nil {
+		return true
+	}
+	_, ok := result.dml[dmlType.String()]
+	return ok
+}
+
+// IgnoreColumns 表需要剔除的列
+func (f *TableFilter) IgnoreColumns(database, table string) map[string]struct{} {
+	if f.Empty() {
+		return nil
+	}
+	return f.result(database, table).ignoreColumns
+}
+
+// ignoreColumnIndexes 表需要剔除的列在 binlog 中的下标，需要 binlog_row_metadata=FULL 提供列名，主键列不能剔除
+func (f *TableFilter) ignoreColumnIndexes(tableMap *replication.TableMapEvent) ([]int, error) {
+	database, table := string(tableMap.Schema), string(tableMap.Table)
+	ignoreColumns := f.IgnoreColumns(database, table)
+	if len(ignoreColumns) == 0 {
+		return nil, nil
+	}
+	names := tableMap.ColumnNameString()
+	if len(names) != int(tableMap.ColumnCount) {
+		return nil, fmt.Errorf("table %s.%s column names unavailable for ignore-columns, set binlog_row_metadata=FULL", database, table)
+	}
+	primaryKey := make(map[int]struct{}, len(tableMap.PrimaryKey))
+	for _, index := range tableMap.PrimaryKey {
+		primaryKey[int(index)] = struct{}{}
+	}
+	indexes := make([]int, 0, len(ignoreColumns))
+	for i, name := range names {
+		if _, ok := ignoreColumns[name]; !ok {
+			continue
+		}
+		if _, ok := primaryKey[i]; ok {
+			return nil, fmt.Errorf("table %s.%s primary key column %s can not be ignored", database, table, name)
+		}
+		indexes = append(indexes, i)
+	}
+	return indexes, nil
+}
+
+// excludeRowsColumns 剔除的列置为 nil 并记入 SkippedColumns，与未出现在行镜像中的列一致
+func excludeRowsColumns(e *replication.RowsEvent, indexes []int) {
+	for i, row := range e.Rows {
+		for _, index := range indexes {
+			if index < len(row) {
+				row[index] = nil
+			}
+		}
+		if i < len(e.SkippedColumns) {
+			e.SkippedColumns[i] = append(e.SkippedColumns[i], indexes...)
+		}
+	}
+}
+
+// AcceptDDL 任意 statement 命中规则即接收
+func (f *TableFilter) AcceptDDL(stmts []ddl_parser.Statement) bool {
+	if f.Empty() {
+		return true
+	}
+	for _, stmt := range stmts {
+		if ddl_parser.FilterOR(stmt, f.ddl...) {
+			return true
+		}
+	}
+	return false
+}
+
+func rowsEventDML(e *replication.RowsEvent) schema_store.DML {
+	switch e.Type() {
+	case replication.EnumRowsEventTypeInsert:
+		return schema_store.Insert
+	case replication.EnumRowsEventTypeUpdate:
+		return schema_store.Update
+	case replication.EnumRowsEventTypeDelete:
+		return schema_store.Delete
+	}
+	return ""
+}
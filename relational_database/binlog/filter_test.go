@@ -0,0 +1,83 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/xuenqlve/common/ddl_parser"
+	mysql_ddl "github.com/xuenqlve/common/relational_database/ddl_parser"
+	"github.com/xuenqlve/common/schema_store"
+)
+
+func TestTableFilter(t *testing.T) {
+	filter, err := NewTableFilter([]TableFilterRule{
+		{
+			Database:         "order_*",
+			AcceptTableRegex: []string{"order*"},
+			IgnoreTableRegex: []string{"order_tmp*"},
+			AcceptDML:        []string{"insert", "update"},
+			IgnoreColumns:    map[string][]string{"order": {"secret"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filter.AcceptDML("order_1", "order", schema_store.Insert) {
+		t.Fatal("order_1.order insert should be accepted")
+	}
+	if filter.AcceptDML("order_1", "order", schema_store.Delete) {
+		t.Fatal("order_1.order delete should be ignored")
+	}
+	if filter.AcceptTable("order_1", "order_tmp1") || filter.AcceptTable("user", "order") {
+		t.Fatal("unexpected accepted table")
+	}
+	if _, ok := filter.IgnoreColumns("order_1", "order")["secret"]; !ok {
+		t.Fatal("secret column should be ignored")
+	}
+
+	tableMap := &replication.TableMapEvent{
+		Schema:      []byte("order_1"),
+		Table:       []byte("order"),
+		ColumnCount: 3,
+		ColumnName:  [][]byte{[]byte("id"), []byte("secret"), []byte("amount")},
+		PrimaryKey:  []uint64{0},
+	}
+	indexes, err := filter.ignoreColumnIndexes(tableMap)
+	if err != nil || len(indexes) != 1 || indexes[0] != 1 {
+		t.Fatalf("ignore column indexes: %v %v", indexes, err)
+	}
+	rows := &replication.RowsEvent{Rows: [][]interface{}{{1, "s", 10}}, SkippedColumns: [][]int{nil}}
+	excludeRowsColumns(rows, indexes)
+	if rows.Rows[0][1] != nil || rows.Rows[0][2] != 10 || len(rows.SkippedColumns[0]) != 1 {
+		t.Fatalf("exclude rows columns: %v %v", rows.Rows, rows.SkippedColumns)
+	}
+	tableMap.PrimaryKey = []uint64{0, 1}
+	if _, err = filter.ignoreColumnIndexes(tableMap); err == nil {
+		t.Fatal("primary key column should not be ignored")
+	}
+	tableMap.ColumnName = nil
+	if _, err = filter.ignoreColumnIndexes(tableMap); err == nil {
+		t.Fatal("column names unavailable should be rejected")
+	}
+
+	loader := mysql_ddl.NewPingCapLoader()
+	cases := map[string]bool{
+		"ALTER TABLE order_1.order ADD COLUMN a INT":      true,
+		"ALTER TABLE order_1.order_tmp1 ADD COLUMN a INT": false,
+		"CREATE DATABASE order_2":                         true,
+		"DROP TABLE user.order":                           false,
+	}
+	for sql, expected := range cases {
+		stmts, err := loader.Parse(ddl_parser.DDL{SQL: sql})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filter.AcceptDDL(stmts) != expected {
+			t.Fatalf("%s expected %v", sql, expected)
+		}
+	}
+
+	if _, err = NewTableFilter([]TableFilterRule{{Database: "a", AcceptDML: []string{"replace"}}}); err == nil {
+		t.Fatal("unknown dml type should be rejected")
+	}
+}
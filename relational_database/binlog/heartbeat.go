@@ -0,0 +1,173 @@
+package binlog
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/xuenqlve/common/errors"
+	"github.com/xuenqlve/common/log"
+	sql_tool "github.com/xuenqlve/common/sql"
+)
+
+const (
+	DefaultHeartbeatDatabase = "heartbeat"
+	DefaultHeartbeatTable    = "heartbeat"
+	DefaultHeartbeatInterval = time.Second
+	// heartbeatTimeLayout 与 pt-heartbeat --utc 写入的 ts 格式一致
+	heartbeatTimeLayout = "2006-01-02T15:04:05.000000"
+)
+
+// HeartbeatTableConfig pt-heartbeat 风格的心跳表，表结构兼容 pt-heartbeat
+type HeartbeatTableConfig struct {
+	Enable   bool          `mapstructure:"enable" yaml:"enable" toml:"enable" json:"enable"`
+	Database string        `mapstructure:"database" yaml:"database" toml:"database" json:"database"`
+	Table    string        `mapstructure:"table" yaml:"table" toml:"table" json:"table"`
+	Interval time.Duration `mapstructure:"interval" yaml:"interval" toml:"interval" json:"interval"`
+	// ServerID 写入心跳行的 server_id，为 0 时使用源库的 @@server_id
+	ServerID uint32 `mapstructure:"server-id" yaml:"server-id" toml:"server-id" json:"server-id"`
+}
+
+func (c *HeartbeatTableConfig) init() {
+	if c.Database == "" {
+		c.Database = DefaultHeartbeatDatabase
+	}
+	if c.Table == "" {
+		c.Table = DefaultHeartbeatTable
+	}
+	if c.Interval <= 0 {
+		c.Interval = DefaultHeartbeatInterval
+	}
+}
+
+func isHeartbeatEvent(ev *replication.BinlogEvent) bool {
+	return ev.Header.EventType == replication.HEARTBEAT_EVENT || ev.Header.EventType == replication.HEARTBEAT_LOG_EVENT_V2
+}
+
+// heartbeatLag 从心跳表的行事件中解析写入时间，返回端到端延迟
+func heartbeatLag(e *replication.RowsEvent) (time.Duration, bool) {
+	if len(e.Rows) == 0 {
+		return 0, false
+	}
+	index := 0
+	for i, name := range e.Table.ColumnNameString() {
+		if name == "ts" {
+			index = i
+			break
+		}
+	}
+	row := e.Rows[len(e.Rows)-1]
+	if index >= len(row) {
+		return 0, false
+	}
+	var value string
+	switch v := row[index].(type) {
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	default:
+		return 0, false
+	}
+	ts, err := time.ParseInLocation(heartbeatTimeLayout, value, time.UTC)
+	if err != nil {
+		log.Warnf("parse heartbeat ts %s err: %v", value, err)
+		return 0, false
+	}
+	lag := time.Since(ts)
+	if lag < 0 {
+		lag = 0
+	}
+	return lag, true
+}
+
+// HeartbeatWriter 定时向源库心跳表写入当前时间，BinlogReader 读到心跳行后计算端到端延迟
+type HeartbeatWriter struct {
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+	conn       *sql.DB
+	cfg        HeartbeatTableConfig
+}
+
+func NewHeartbeatWriter(ctx context.Context, conn *sql.DB, cfg HeartbeatTableConfig) *HeartbeatWriter {
+	cfg.init()
+	ctxWithCancel, cancelFunc := context.WithCancel(ctx)
+	return &HeartbeatWriter{
+		ctx:        ctxWithCancel,
+		cancelFunc: cancelFunc,
+		conn:       conn,
+		cfg:        cfg,
+	}
+}
+
+func (w *HeartbeatWriter) tableName() string {
+	return sql_tool.GenerateTableName(w.cfg.Database, w.cfg.Table)
+}
+
+// Init 创建心跳库表
+func (w *HeartbeatWriter) Init() error {
+	if _, err := w.conn.ExecContext(w.ctx, fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", sql_tool.ColumnName(w.cfg.Database))); err != nil {
+		return errors.Trace(err)
+	}
+	createTable := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+  ts VARCHAR(26) NOT NULL,
+  server_id INT UNSIGNED NOT NULL PRIMARY KEY,
+  file VARCHAR(255) DEFAULT NULL,
+  position BIGINT UNSIGNED DEFAULT NULL,
+  relay_master_log_file VARCHAR(255) DEFAULT NULL,
+  exec_master_log_pos BIGINT UNSIGNED DEFAULT NULL
+)`, w.tableName())
+	if _, err := w.conn.ExecContext(w.ctx, createTable); err != nil {
+		return errors.Trace(err)
+	}
+	if w.cfg.ServerID == 0 {
+		if err := w.conn.QueryRowContext(w.ctx, "SELECT @@server_id").Scan(&w.cfg.ServerID); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// Start 初始化心跳表后按 Interval 写入心跳
+func (w *HeartbeatWriter) Start() error {
+	if err := w.Init(); err != nil {
+		return errors.Trace(err)
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(w.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.ctx.Done():
+				return
+			case <-ticker.C:
+				if err := w.Beat(); err != nil {
+					log.Warnf("heartbeat write err: %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (w *HeartbeatWriter) Beat() error {
+	statement := fmt.Sprintf("REPLACE INTO %s (ts, server_id) VALUES (?, ?)", w.tableName())
+	_, err := w.conn.ExecContext(w.ctx, statement, time.Now().UTC().Format(heartbeatTimeLayout), w.cfg.ServerID)
+	return errors.Trace(err)
+}
+
+func (w *HeartbeatWriter) Close() {
+	w.cancelFunc()
+	w.wg.Wait()
+}
+
+func (c *HeartbeatTableConfig) match(database, table string) bool {
+	return c.Enable && strings.EqualFold(database, c.Database) && strings.EqualFold(table, c.Table)
+}
@@ -0,0 +1,358 @@
+package binlog
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/segmentio/kafka-go"
+	kafka_source "github.com/xuenqlve/common/data_source/kafka"
+	"github.com/xuenqlve/common/ddl_parser"
+	"github.com/xuenqlve/common/errors"
+	"github.com/xuenqlve/common/log"
+	mysql_ddl "github.com/xuenqlve/common/relational_database/ddl_parser"
+	"github.com/xuenqlve/common/schema_store"
+)
+
+const (
+	DefaultTopicTemplate        = "{database}.{table}"
+	DefaultPublishBatchSize     = 500
+	DefaultPublishFlushInterval = time.Second
+)
+
+// PositionCommitter 位点提交，position.Committer 实现了该接口
+type PositionCommitter interface {
+	Commit(pos any, force bool) error
+}
+
+// MessageWriter kafka 消息写入，*kafka.Writer 实现了该接口
+type MessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+type KafkaPublisherConfig struct {
+	// Format canal | debezium | maxwell
+	Format string `mapstructure:"format" toml:"format" json:"format" yaml:"format"`
+	// TopicTemplate 支持 {database} {table} 占位符
+	TopicTemplate string `mapstructure:"topic-template" toml:"topic-template" json:"topic-template" yaml:"topic-template"`
+	// DDLTopic 为空时 DDL 按 TopicTemplate 投递
+	DDLTopic      string        `mapstructure:"ddl-topic" toml:"ddl-topic" json:"ddl-topic" yaml:"ddl-topic"`
+	ServerName    string        `mapstructure:"server-name" toml:"server-name" json:"server-name" yaml:"server-name"`
+	ServerID      uint32        `mapstructure:"server-id" toml:"server-id" json:"server-id" yaml:"server-id"`
+	BatchSize     int           `mapstructure:"batch-size" toml:"batch-size" json:"batch-size" yaml:"batch-size"`
+	FlushInterval time.Duration `mapstructure:"flush-interval" toml:"flush-interval" json:"flush-interval" yaml:"flush-interval"`
+	// Router 不为空时按 topics 规则改写 TopicTemplate 及 DDLTopic 生成的 topic
+	Router *ddl_parser.Router `mapstructure:"-" toml:"-" json:"-" yaml:"-"`
+}
+
+func (c *KafkaPublisherConfig) init() {
+	if c.TopicTemplate == "" {
+		c.TopicTemplate = DefaultTopicTemplate
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultPublishBatchSize
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = DefaultPublishFlushInterval
+	}
+}
+
+// Topic 按模板生成 topic，table 为空时去掉多余的分隔符
+func (c *KafkaPublisherConfig) Topic(database, table string) string {
+	topic := strings.NewReplacer("{database}", database, "{table}", table).Replace(c.TopicTemplate)
+	if table == "" {
+		topic = strings.Trim(topic, "._-")
+	}
+	return c.routeTopic(topic)
+}
+
+func (c *KafkaPublisherConfig) routeTopic(topic string) string {
+	if c.Router == nil {
+		return topic
+	}
+	return c.Router.RouteTopic(topic)
+}
+
+type txnRow struct {
+	change RowChange
+	query  string
+}
+
+// KafkaPublisher 实现 EventHandler，将 binlog 行变更和 DDL 按事务投递到 kafka。
+// 位点只在消息被 kafka 确认写入之后才提交。
+type KafkaPublisher struct {
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+
+	cfg       KafkaPublisherConfig
+	writer    MessageWriter
+	encoder   EnvelopeEncoder
+	decoder   *RowDecoder
+	loader    mysql_ddl.PingCapLoader
+	committer PositionCommitter
+
+	txn       []txnRow
+	rowsQuery string
+	gtid      string
+	timestamp uint32
+	// txnStart 当前事务开始时的位点
+	txnStart   Position
+	messages   []kafka.Message
+	pendingPos *Position
+	flushErr   error
+}
+
+// NewKafkaPublisher 创建 publisher，消息按 key hash 分区，保证同一行的变更有序
+func NewKafkaPublisher(ctx context.Context, cfg KafkaPublisherConfig, kafkaCfg *kafka_source.Config, schemaStore schema_store.SchemaStore, committer PositionCommitter) (*KafkaPublisher, error) {
+	writer, err := kafkaCfg.CreateWriterCustomBalancer(&kafka.Hash{})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	// 位点依赖 kafka 确认，必须等待所有副本写入
+	writer.RequiredAcks = kafka.RequireAll
+	writer.Async = false
+	return NewKafkaPublisherWithWriter(ctx, cfg, writer, schemaStore, committer)
+}
+
+func NewKafkaPublisherWithWriter(ctx context.Context, cfg KafkaPublisherConfig, writer MessageWriter, schemaStore schema_store.SchemaStore, committer PositionCommitter) (*KafkaPublisher, error) {
+	cfg.init()
+	encoder, err := NewEnvelopeEncoder(cfg.Format)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	ctxWithCancel, cancelFunc := context.WithCancel(ctx)
+	return &KafkaPublisher{
+		ctx:        ctxWithCancel,
+		cancelFunc: cancelFunc,
+		cfg:        cfg,
+		writer:     writer,
+		encoder:    encoder,
+		decoder:    NewRowDecoder(schemaStore),
+		loader:     mysql_ddl.NewPingCapLoader(),
+		committer:  committer,
+	}, nil
+}
+
+// SetTableFilter 剔除过滤规则中的列，一般传入 BinlogReader.TableFilter()
+func (p *KafkaPublisher) SetTableFilter(filter *TableFilter) {
+	p.decoder.SetTableFilter(filter)
+}
+
+// Start 启动定时 flush
+func (p *KafkaPublisher) Start() {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(p.cfg.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-ticker.C:
+				p.mu.Lock()
+				if err := p.flush(); err != nil {
+					log.Errorf("kafka publisher flush err: %v", err)
+				}
+				p.mu.Unlock()
+			}
+		}
+	}()
+}
+
+func (p *KafkaPublisher) OnXID(xid uint64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.flushErr != nil {
+		return p.flushErr
+	}
+	for i, row := range p.txn {
+		meta := p.meta()
+		meta.XID = xid
+		meta.Row = i
+		meta.Commit = i == len(p.txn)-1
+		meta.Query = row.query
+		key, value, err := p.encoder.EncodeRow(row.change, meta)
+		if err != nil {
+			return errors.Annotatef(err, "encode %s.%s row", row.change.Database, row.change.Table)
+		}
+		p.append(p.cfg.Topic(row.change.Database, row.change.Table), key, value)
+	}
+	p.txn = p.txn[:0]
+	p.rowsQuery = ""
+	if len(p.messages) >= p.cfg.BatchSize {
+		return p.flush()
+	}
+	return nil
+}
+
+func (p *KafkaPublisher) OnGTID(gtid string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.gtid = gtid
+	return nil
+}
+
+func (p *KafkaPublisher) OnRow(dmlType schema_store.DML, event *replication.RowsEvent) error {
+	changes, err := p.decoder.Decode(dmlType, event)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, change := range changes {
+		// 主键变更拆分后旧 key 和新 key 的消息各自有序
+		for _, row := range change.SplitPrimaryKeyUpdate() {
+			p.txn = append(p.txn, txnRow{change: row, query: p.rowsQuery})
+		}
+	}
+	return nil
+}
+
+func (p *KafkaPublisher) OnDDL(schema, query []byte) error {
+	ddl := ddl_parser.DDL{Schema: string(schema), SQL: string(query)}
+	stmts, err := p.loader.Parse(ddl)
+	if err != nil {
+		log.Warnf("kafka publisher skip query: %s, err: %v", query, err)
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.flushErr != nil {
+		return p.flushErr
+	}
+	for _, stmt := range stmts {
+		md := stmt.Metadata()
+		change := DDLChange{
+			Database: md.Database,
+			Table:    md.Table,
+			Type:     stmt.DDLType(),
+			SQL:      string(query),
+		}
+		if change.Database == "" {
+			change.Database = string(schema)
+		}
+		if change.Table != "" {
+			p.decoder.Invalidate(change.Database, change.Table)
+		}
+		if md.RenameTable != "" {
+			p.decoder.Invalidate(md.RenameDatabase, md.RenameTable)
+		}
+		key, value, err := p.encoder.EncodeDDL(change, p.meta())
+		if err != nil {
+			return errors.Annotatef(err, "encode ddl %s", query)
+		}
+		topic := p.cfg.routeTopic(p.cfg.DDLTopic)
+		if p.cfg.DDLTopic == "" {
+			topic = p.cfg.Topic(change.Database, change.Table)
+		}
+		p.append(topic, key, value)
+	}
+	// DDL 前后的数据依赖表结构，立即投递
+	return p.flush()
+}
+
+func (p *KafkaPublisher) OnRowsQueryEvent(query []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rowsQuery = string(query)
+	return nil
+}
+
+// OnPosSynced 有未确认的消息时暂存位点，等 flush 成功后提交
+func (p *KafkaPublisher) OnPosSynced(pos Position, force bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.txnStart = pos
+	if len(p.messages) > 0 || len(p.txn) > 0 {
+		// 缓存的消息由 OnXID 或定时 flush 投递后再提交位点
+		p.pendingPos = &pos
+		return nil
+	}
+	return p.commit(pos, force)
+}
+
+func (p *KafkaPublisher) SyncedTimestamp(timestamp uint32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.timestamp = timestamp
+}
+
+// Flush 投递缓存的消息并提交位点
+func (p *KafkaPublisher) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.flush()
+}
+
+// Close 停止定时 flush，投递剩余消息后关闭 writer
+func (p *KafkaPublisher) Close() error {
+	p.cancelFunc()
+	p.wg.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.txn) > 0 {
+		log.Warnf("kafka publisher close with %d uncommitted rows, drop them", len(p.txn))
+		p.txn = nil
+	}
+	p.flushErr = nil
+	err := p.flushWithContext(context.Background())
+	if closeErr := p.writer.Close(); err == nil {
+		err = closeErr
+	}
+	return errors.Trace(err)
+}
+
+func (p *KafkaPublisher) meta() EventMeta {
+	return EventMeta{
+		ServerName: p.cfg.ServerName,
+		ServerID:   p.cfg.ServerID,
+		Position:   p.txnStart,
+		GTID:       p.gtid,
+		Timestamp:  p.timestamp,
+	}
+}
+
+func (p *KafkaPublisher) append(topic string, key, value []byte) {
+	if value == nil {
+		return
+	}
+	p.messages = append(p.messages, kafka.Message{
+		Topic: topic,
+		Key:   key,
+		Value: value,
+	})
+}
+
+func (p *KafkaPublisher) flush() error {
+	return p.flushWithContext(p.ctx)
+}
+
+func (p *KafkaPublisher) flushWithContext(ctx context.Context) error {
+	if len(p.messages) > 0 {
+		if err := p.writer.WriteMessages(ctx, p.messages...); err != nil {
+			p.flushErr = errors.Annotatef(err, "write %d messages to kafka", len(p.messages))
+			return p.flushErr
+		}
+		p.messages = p.messages[:0]
+	}
+	p.flushErr = nil
+	if p.pendingPos != nil && len(p.txn) == 0 {
+		pos := *p.pendingPos
+		p.pendingPos = nil
+		return p.commit(pos, true)
+	}
+	return nil
+}
+
+func (p *KafkaPublisher) commit(pos Position, force bool) error {
+	if p.committer == nil {
+		return nil
+	}
+	return errors.Trace(p.committer.Commit(pos, force))
+}
@@ -0,0 +1,282 @@
+package binlog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/xuenqlve/common/ddl_parser"
+	"github.com/xuenqlve/common/log"
+	mysql_ddl "github.com/xuenqlve/common/relational_database/ddl_parser"
+	"github.com/xuenqlve/common/schema_store"
+)
+
+// GhostTableKind 在线变更工具创建的辅助表类型
+type GhostTableKind int
+
+const (
+	// GhostTableShadow gh-ost 的 _t_gho、pt-osc 的 _t_new，接收拷贝和增量数据，cut-over 后替换原表
+	GhostTableShadow GhostTableKind = iota + 1
+	// GhostTableChangelog gh-ost 的 _t_ghc 心跳及状态表
+	GhostTableChangelog
+	// GhostTableOld cut-over 时原表被重命名成的 gh-ost _t_del、pt-osc _t_old
+	GhostTableOld
+)
+
+var (
+	// gh-ost --timestamp-old-table 时为 _t_20060102150405_del，pt-osc 遇到重名会增加前导下划线
+	ghostTableRegex = regexp.MustCompile(`^_+(.+?)(?:_\d{14})?_(gho|ghc|del|new|old)$`)
+	// gh-ost 执行的 DDL 都带有 /* gh-ost */ 注释
+	ghostMarkerRegex = regexp.MustCompile(`(?i)/\*\s*gh-ost\s*\*/`)
+	// pt-osc 同步增量数据的触发器 pt_osc_<db>_<table>_ins|upd|del
+	ptOscTriggerRegex = regexp.MustCompile("(?is)^\\s*(?:/\\*.*?\\*/\\s*)?(?:create|drop)\\s+(?:definer\\s*=\\s*\\S+\\s+)?trigger\\s+(?:if\\s+(?:not\\s+)?exists\\s+)?(?:`?[^`\\s.]+`?\\.)?`?pt_osc_")
+)
+
+// ParseGhostTable 按 gh-ost/pt-osc 的命名规则解析辅助表，返回原表名及辅助表类型。
+// 只检查表名，_foo_new 这样的业务表同样会匹配，是否是辅助表由 OnlineDDL 根据 DDL 序列确认
+func ParseGhostTable(table string) (string, GhostTableKind, bool) {
+	matches := ghostTableRegex.FindStringSubmatch(table)
+	if matches == nil {
+		return "", 0, false
+	}
+	switch matches[2] {
+	case "gho", "new":
+		return matches[1], GhostTableShadow, true
+	case "ghc":
+		return matches[1], GhostTableChangelog, true
+	default:
+		return matches[1], GhostTableOld, true
+	}
+}
+
+func isOnlineDDLTrigger(query string) bool {
+	return ptOscTriggerRegex.MatchString(query)
+}
+
+type ghostTable struct {
+	kind GhostTableKind
+	// confirmed 已确认是在线变更工具创建的辅助表
+	confirmed bool
+	// downstream 建表语句已经输出，pt-osc 的影子表在看到触发器之前按普通表处理
+	downstream bool
+}
+
+// OnlineDDL 跟踪 gh-ost/pt-osc 的表结构变更：屏蔽辅助表上的 DDL，
+// 记录作用在影子表上的 ALTER，cut-over 的 RENAME 到原表时改写为原表上的 ALTER。
+// 表名符合命名规则还不够：gh-ost 的辅助表由 DDL 中的 /* gh-ost */ 注释确认，
+// pt-osc 的影子表由写入它的 pt_osc_ 触发器确认，确认之前按普通表输出，cut-over 时再删除。
+// 在迁移过程中重启时，重启前创建的辅助表按普通表处理
+type OnlineDDL struct {
+	loader mysql_ddl.PingCapLoader
+	// ghosts 符合命名规则且由在线变更工具创建的表
+	ghosts map[ddl_parser.Table]*ghostTable
+	// pending 影子表上尚未 cut-over 的 ALTER
+	pending map[ddl_parser.Table][]*ddl_parser.AlterTableStatement
+}
+
+func NewOnlineDDL() *OnlineDDL {
+	return &OnlineDDL{
+		loader:  mysql_ddl.NewPingCapLoader(),
+		ghosts:  make(map[ddl_parser.Table]*ghostTable),
+		pending: make(map[ddl_parser.Table][]*ddl_parser.AlterTableStatement),
+	}
+}
+
+// IsGhostTable 已确认的辅助表的行事件和 DDL 不需要同步
+func (o *OnlineDDL) IsGhostTable(database, table string) bool {
+	ghost, ok := o.ghosts[ddl_parser.Table{Database: database, Table: table}]
+	return ok && ghost.confirmed
+}
+
+// HandleTrigger 识别 pt-osc 的触发器并确认其写入的影子表，返回 true 时语句不需要同步
+func (o *OnlineDDL) HandleTrigger(query string) bool {
+	if !isOnlineDDLTrigger(query) {
+		return false
+	}
+	for table, ghost := range o.ghosts {
+		if ghost.confirmed || ghost.kind != GhostTableShadow || !strings.Contains(query, "`"+table.Table+"`") {
+			continue
+		}
+		ghost.confirmed = true
+		log.Infof("online ddl: confirm pt-osc shadow table %s.%s", table.Database, table.Table)
+	}
+	return true
+}
+
+// Handle query 为原始 SQL，返回改写后的语句，changed 为 false 时语句与输入相同，可以直接使用原 SQL
+func (o *OnlineDDL) Handle(query string, stmts []ddl_parser.Statement) ([]ddl_parser.Statement, bool) {
+	marked := ghostMarkerRegex.MatchString(query)
+	result := make([]ddl_parser.Statement, 0, len(stmts))
+	changed := false
+	for _, stmt := range stmts {
+		out, ok := o.handle(stmt, marked)
+		if ok {
+			changed = true
+		}
+		result = append(result, out...)
+	}
+	return result, changed
+}
+
+func (o *OnlineDDL) handle(stmt ddl_parser.Statement, marked bool) ([]ddl_parser.Statement, bool) {
+	md := stmt.Metadata()
+	if stmt.DDLType() == schema_store.RENAME_TABLE {
+		return o.handleRename(stmt, md, marked)
+	}
+	origin, kind, ok := ParseGhostTable(md.Table)
+	if !ok {
+		return []ddl_parser.Statement{stmt}, false
+	}
+	table := ddl_parser.Table{Database: md.Database, Table: md.Table}
+	switch stmt.DDLType() {
+	case schema_store.CREATE_TABLE, schema_store.CREATE_TABLE_LIKE, schema_store.CREATE_TABLE_SELECT:
+		delete(o.pending, table)
+		if marked {
+			o.ghosts[table] = &ghostTable{kind: kind, confirmed: true}
+			return nil, true
+		}
+		if kind == GhostTableShadow {
+			// 可能是 pt-osc 的影子表，等待触发器确认
+			o.ghosts[table] = &ghostTable{kind: kind, downstream: true}
+		}
+		return []ddl_parser.Statement{stmt}, false
+	}
+	ghost, ok := o.ghosts[table]
+	if !ok {
+		if marked {
+			// gh-ost 开始前清理同名辅助表
+			return nil, true
+		}
+		return []ddl_parser.Statement{stmt}, false
+	}
+	switch stmt.DDLType() {
+	case schema_store.ALTER_TABLE, schema_store.ADD_PARTITION, schema_store.DROP_PARTITION, schema_store.TRUNCATE_PARTITION:
+		alter, ok := stmt.(*ddl_parser.AlterTableStatement)
+		if !ok || kind != GhostTableShadow {
+			break
+		}
+		if alter.AlterSpec().Type == ddl_parser.RenameTable {
+			newDatabase, newTable := alter.RenameNewTable()
+			if !ghost.confirmed {
+				delete(o.ghosts, table)
+				delete(o.pending, table)
+				return []ddl_parser.Statement{stmt}, false
+			}
+			// ALTER TABLE _t_gho RENAME TO t 等价于 cut-over
+			if newDatabase == md.Database && newTable == origin {
+				return o.cutOver(table, origin), true
+			}
+			o.renameGhost(table, ddl_parser.Table{Database: newDatabase, Table: newTable})
+			break
+		}
+		o.pending[table] = append(o.pending[table], alter)
+		log.Infof("online ddl: record %s on %s.%s for %s", alter.AlterType(), md.Database, md.Table, origin)
+	case schema_store.DROP_TABLE:
+		delete(o.ghosts, table)
+		delete(o.pending, table)
+		if ghost.downstream {
+			return []ddl_parser.Statement{stmt}, false
+		}
+		return nil, true
+	}
+	if !ghost.confirmed {
+		return []ddl_parser.Statement{stmt}, false
+	}
+	return nil, true
+}
+
+func (o *OnlineDDL) handleRename(stmt ddl_parser.Statement, md ddl_parser.Metadata, marked bool) ([]ddl_parser.Statement, bool) {
+	oldTable := ddl_parser.Table{Database: md.Database, Table: md.Table}
+	newTable := ddl_parser.Table{Database: md.RenameDatabase, Table: md.RenameTable}
+	oldOrigin, oldKind, _ := ParseGhostTable(md.Table)
+	newOrigin, newKind, newGhost := ParseGhostTable(md.RenameTable)
+	ghost, oldGhost := o.ghosts[oldTable]
+	switch {
+	case oldGhost && !ghost.confirmed:
+		// 未确认的影子表被重命名，按普通表处理
+		delete(o.ghosts, oldTable)
+		delete(o.pending, oldTable)
+		return []ddl_parser.Statement{stmt}, false
+	case oldGhost && oldKind == GhostTableShadow && newTable.Database == md.Database && newTable.Table == oldOrigin:
+		// cut-over: _t_gho -> t
+		return o.cutOver(oldTable, oldOrigin), true
+	case oldGhost:
+		// 辅助表之间的重命名
+		o.renameGhost(oldTable, newTable)
+		return nil, true
+	case newGhost && newKind == GhostTableOld && newOrigin == md.Table && newTable.Database == md.Database &&
+		(marked || o.migrating(md.Database, md.Table)):
+		// cut-over: t -> _t_del
+		o.ghosts[newTable] = &ghostTable{kind: GhostTableOld, confirmed: true}
+		return nil, true
+	default:
+		return []ddl_parser.Statement{stmt}, false
+	}
+}
+
+// migrating 表上是否有已确认且尚未 cut-over 的影子表
+func (o *OnlineDDL) migrating(database, table string) bool {
+	for name, ghost := range o.ghosts {
+		if !ghost.confirmed || ghost.kind != GhostTableShadow || name.Database != database {
+			continue
+		}
+		if origin, _, _ := ParseGhostTable(name.Table); origin == table {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *OnlineDDL) renameGhost(oldTable, newTable ddl_parser.Table) {
+	ghost := o.ghosts[oldTable]
+	delete(o.ghosts, oldTable)
+	if _, kind, ok := ParseGhostTable(newTable.Table); ok {
+		ghost.kind = kind
+	}
+	o.ghosts[newTable] = ghost
+	if alters, ok := o.pending[oldTable]; ok {
+		delete(o.pending, oldTable)
+		o.pending[newTable] = alters
+	}
+}
+
+// cutOver 将影子表上记录的 ALTER 改写到原表，影子表已经输出过时在下游删除
+func (o *OnlineDDL) cutOver(shadow ddl_parser.Table, origin string) []ddl_parser.Statement {
+	alters := o.pending[shadow]
+	ghost := o.ghosts[shadow]
+	delete(o.pending, shadow)
+	delete(o.ghosts, shadow)
+	if len(alters) == 0 {
+		log.Warnf("online ddl: cut-over %s.%s to %s without recorded alter", shadow.Database, shadow.Table, origin)
+	}
+	stmts := make([]ddl_parser.Statement, 0, len(alters)+1)
+	for _, alter := range alters {
+		alter.ReplaceTable(shadow.Table, origin)
+		stmts = append(stmts, alter)
+	}
+	if ghost != nil && ghost.downstream {
+		drop, err := o.loader.Parse(ddl_parser.DDL{Schema: shadow.Database, SQL: fmt.Sprintf("DROP TABLE IF EXISTS `%s`.`%s`", shadow.Database, shadow.Table)})
+		if err != nil {
+			log.Warnf("online ddl: drop shadow table %s.%s err: %v", shadow.Database, shadow.Table, err)
+		} else {
+			stmts = append(stmts, drop...)
+		}
+	}
+	log.Infof("online ddl: cut-over %s.%s to %s, translate %d alter", shadow.Database, shadow.Table, origin, len(alters))
+	return stmts
+}
+
+// Pending 返回影子表上尚未 cut-over 的 ALTER 数量
+func (o *OnlineDDL) Pending() int {
+	count := 0
+	for _, alters := range o.pending {
+		count += len(alters)
+	}
+	return count
+}
+
+// Reset 丢弃所有未 cut-over 的 ALTER 及已识别的辅助表，迁移被中止时使用
+func (o *OnlineDDL) Reset() {
+	o.ghosts = make(map[ddl_parser.Table]*ghostTable)
+	o.pending = make(map[ddl_parser.Table][]*ddl_parser.AlterTableStatement)
+}
@@ -0,0 +1,136 @@
+package binlog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xuenqlve/common/ddl_parser"
+	mysql_ddl "github.com/xuenqlve/common/relational_database/ddl_parser"
+)
+
+func TestParseGhostTable(t *testing.T) {
+	cases := []struct {
+		table  string
+		origin string
+		kind   GhostTableKind
+		ok     bool
+	}{
+		{"_orders_gho", "orders", GhostTableShadow, true},
+		{"_orders_ghc", "orders", GhostTableChangelog, true},
+		{"_orders_del", "orders", GhostTableOld, true},
+		{"_orders_20240102150405_del", "orders", GhostTableOld, true},
+		{"_orders_new", "orders", GhostTableShadow, true},
+		{"__orders_old", "orders", GhostTableOld, true},
+		{"orders_new", "", 0, false},
+		{"orders", "", 0, false},
+	}
+	for _, c := range cases {
+		origin, kind, ok := ParseGhostTable(c.table)
+		if origin != c.origin || kind != c.kind || ok != c.ok {
+			t.Fatalf("%s: got (%s, %d, %v)", c.table, origin, kind, ok)
+		}
+	}
+	if !isOnlineDDLTrigger("CREATE DEFINER=`root`@`%` TRIGGER `db`.`pt_osc_db_orders_ins` AFTER INSERT ON `db`.`orders` FOR EACH ROW REPLACE INTO `db`.`_orders_new` (`id`) VALUES (NEW.`id`)") {
+		t.Fatal("pt-osc trigger should be detected")
+	}
+	if isOnlineDDLTrigger("CREATE TRIGGER audit_ins AFTER INSERT ON orders FOR EACH ROW SET @a = 1") {
+		t.Fatal("user trigger should not be detected")
+	}
+}
+
+func TestOnlineDDLCutOver(t *testing.T) {
+	loader := mysql_ddl.NewPingCapLoader()
+	online := NewOnlineDDL()
+	handle := func(query string) []string {
+		stmts, err := loader.Parse(ddl_parser.DDL{Schema: "db", SQL: query})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, changed := online.Handle(query, stmts)
+		if !changed {
+			return []string{query}
+		}
+		queries := make([]string, 0, len(out))
+		for _, stmt := range out {
+			sql, err := stmt.GenerateSQL()
+			if err != nil {
+				t.Fatal(err)
+			}
+			queries = append(queries, sql.(string))
+		}
+		return queries
+	}
+
+	// gh-ost
+	for _, query := range []string{
+		"drop /* gh-ost */ table if exists `_orders_gho`",
+		"create /* gh-ost */ table `_orders_ghc` (id bigint PRIMARY KEY, hint varchar(64))",
+		"create /* gh-ost */ table `_orders_gho` like `orders`",
+		"alter /* gh-ost */ table `_orders_gho` ADD COLUMN `note` varchar(32), ADD INDEX `idx_note` (`note`)",
+	} {
+		if queries := handle(query); len(queries) != 0 {
+			t.Fatalf("%s should be suppressed, got %v", query, queries)
+		}
+	}
+	if online.Pending() != 2 || !online.IsGhostTable("db", "_orders_gho") || !online.IsGhostTable("db", "_orders_ghc") {
+		t.Fatalf("pending alter: %d", online.Pending())
+	}
+	queries := handle("rename /* gh-ost */ table `orders` to `_orders_del`, `_orders_gho` to `orders`")
+	if len(queries) != 2 {
+		t.Fatalf("cut-over queries: %v", queries)
+	}
+	for _, query := range queries {
+		if !strings.Contains(query, "`db`.`orders`") || strings.Contains(query, "_gho") {
+			t.Fatalf("unexpected cut-over query: %s", query)
+		}
+	}
+	if queries = handle("drop /* gh-ost */ table if exists `_orders_del`"); len(queries) != 0 {
+		t.Fatalf("drop old table should be suppressed, got %v", queries)
+	}
+
+	// pt-osc 的影子表在触发器之前按普通表输出，cut-over 时删除
+	if queries = handle("CREATE TABLE `db`.`_users_new` LIKE `db`.`users`"); len(queries) != 1 {
+		t.Fatalf("unconfirmed shadow table should pass through, got %v", queries)
+	}
+	handle("ALTER TABLE `db`.`_users_new` DROP COLUMN `age`")
+	if online.IsGhostTable("db", "_users_new") {
+		t.Fatal("shadow table confirmed before trigger")
+	}
+	if !online.HandleTrigger("CREATE TRIGGER `pt_osc_db_users_ins` AFTER INSERT ON `db`.`users` FOR EACH ROW REPLACE INTO `db`.`_users_new` (`id`) VALUES (NEW.`id`)") ||
+		!online.IsGhostTable("db", "_users_new") {
+		t.Fatal("pt-osc trigger should confirm shadow table")
+	}
+	queries = handle("RENAME TABLE `db`.`users` TO `db`.`_users_old`, `db`.`_users_new` TO `db`.`users`")
+	if len(queries) != 2 || !strings.Contains(queries[0], "`db`.`users`") || !strings.Contains(queries[0], "drop column `age`") ||
+		!strings.Contains(queries[1], "drop table if exists `db`.`_users_new`") {
+		t.Fatalf("pt-osc cut-over queries: %v", queries)
+	}
+	if queries = handle("DROP TABLE IF EXISTS `db`.`_users_old`"); len(queries) != 0 {
+		t.Fatalf("drop old table should be suppressed, got %v", queries)
+	}
+	if online.Pending() != 0 {
+		t.Fatalf("pending alter after cut-over: %d", online.Pending())
+	}
+
+	queries = handle("ALTER TABLE `orders` ADD COLUMN `c` int")
+	if len(queries) != 1 || queries[0] != "ALTER TABLE `orders` ADD COLUMN `c` int" {
+		t.Fatalf("normal ddl should pass through, got %v", queries)
+	}
+
+	// 名字符合规则的业务表
+	for _, query := range []string{
+		"CREATE TABLE `_foo_new` (id int PRIMARY KEY)",
+		"ALTER TABLE `_foo_new` ADD COLUMN `c` int",
+		"CREATE TABLE `_bar_old` (id int PRIMARY KEY)",
+		"RENAME TABLE `_foo_new` TO `foo`",
+		"RENAME TABLE `bar` TO `_bar_old`",
+		"DROP TABLE `_bar_old`",
+	} {
+		if queries = handle(query); len(queries) != 1 || queries[0] != query {
+			t.Fatalf("%s should pass through, got %v", query, queries)
+		}
+	}
+	if online.IsGhostTable("db", "_foo_new") || online.IsGhostTable("db", "_bar_old") || online.Pending() != 0 {
+		t.Fatal("real tables should not be ghost tables")
+	}
+}
@@ -16,6 +16,23 @@ func (pos Position) mysqlPosition() mysql.Position {
 	return mysql.Position{Name: pos.BinLogFileName, Pos: pos.BinLogFilePos}
 }
 
+// GTIDSet 按 flavor 解析 GTID，mariadb 格式为 domain-server-sequence
+func (pos Position) GTIDSet(flavor string) (mysql.GTIDSet, error) {
+	return mysql.ParseGTIDSet(syncerFlavor(flavor), pos.BinlogGTID)
+}
+
+// MergeGTID 将单个事务的 gtid 合并进 gtid 集合
+func MergeGTID(flavor, gtidSet, gtid string) (string, error) {
+	set, err := mysql.ParseGTIDSet(syncerFlavor(flavor), gtidSet)
+	if err != nil {
+		return "", fmt.Errorf("parse gtid set %s err: %v", gtidSet, err)
+	}
+	if err = set.Update(gtid); err != nil {
+		return "", fmt.Errorf("merge gtid %s into %s err: %v", gtid, gtidSet, err)
+	}
+	return set.String(), nil
+}
+
 func (pos Position) Check() (bool, error) {
 	if pos.BinlogGTID != "" {
 		return true, nil
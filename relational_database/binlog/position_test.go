@@ -0,0 +1,26 @@
+package binlog
+
+import "testing"
+
+func TestMergeGTID(t *testing.T) {
+	merged, err := MergeGTID(FlavorMariaDB, "0-1-10", "0-1-11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged != "0-1-11" {
+		t.Fatalf("unexpected mariadb gtid %s", merged)
+	}
+	merged, err = MergeGTID(FlavorPercona, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5", "3e11fa47-71ca-11e1-9e33-c80aa9429562:6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged != "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-6" {
+		t.Fatalf("unexpected mysql gtid %s", merged)
+	}
+	if _, err = (Position{BinlogGTID: "0-1-10"}).GTIDSet(FlavorMySQL); err == nil {
+		t.Fatal("mariadb gtid should not parse as mysql")
+	}
+	if err = CheckFlavor("oracle"); err == nil {
+		t.Fatal("unknown flavor should be rejected")
+	}
+}
@@ -0,0 +1,457 @@
+package binlog
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/xuenqlve/common/errors"
+	"github.com/xuenqlve/common/log"
+)
+
+type Severity string
+
+const (
+	SeverityInfo    Severity = "INFO"
+	SeverityWarning Severity = "WARNING"
+	SeverityError   Severity = "ERROR"
+)
+
+// MinBinlogRetention binlog 保留时间低于该值时告警
+const MinBinlogRetention = 24 * time.Hour
+
+// PreflightCheck 单项检查，Run 返回是否通过及说明，返回 error 视为未通过
+type PreflightCheck struct {
+	Name        string
+	Severity    Severity
+	Remediation string
+	Run         func(p *Preflight) (bool, string, error)
+}
+
+type CheckResult struct {
+	Name        string   `json:"name"`
+	Severity    Severity `json:"severity"`
+	Passed      bool     `json:"passed"`
+	Message     string   `json:"message"`
+	Remediation string   `json:"remediation,omitempty"`
+}
+
+type PreflightReport struct {
+	Results []CheckResult `json:"results"`
+}
+
+// Failed 未通过的检查
+func (r *PreflightReport) Failed() []CheckResult {
+	var failed []CheckResult
+	for _, result := range r.Results {
+		if !result.Passed {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Error 存在未通过的 ERROR 级别检查时返回错误
+func (r *PreflightReport) Error() error {
+	var messages []string
+	for _, result := range r.Failed() {
+		if result.Severity == SeverityError {
+			messages = append(messages, fmt.Sprintf("%s: %s", result.Name, result.Message))
+		}
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return fmt.Errorf("binlog preflight failed: %s", strings.Join(messages, "; "))
+}
+
+// Preflight binlog CDC 启动前检查，cfg 为即将使用的 reader 配置
+type Preflight struct {
+	conn      *sql.DB
+	cfg       BinlogReaderConfig
+	tool      *StartBinlogTool
+	variables map[string]string
+	files     []BinlogFile
+}
+
+func NewPreflight(conn *sql.DB, cfg BinlogReaderConfig) *Preflight {
+	return &Preflight{
+		conn: conn,
+		cfg:  cfg,
+		tool: NewStartBinlogTool(conn),
+	}
+}
+
+var preflightVariables = []string{
+	"binlog_format", "binlog_row_image", "binlog_rows_query_log_events", "binlog_row_metadata",
+	"gtid_mode", "enforce_gtid_consistency", "gtid_purged",
+	"expire_logs_days", "binlog_expire_logs_seconds", "server_id", "log_bin",
+}
+
+// Variable 返回全局变量，不存在时 ok 为 false
+func (p *Preflight) Variable(name string) (string, bool, error) {
+	if p.variables == nil {
+		variables, err := p.tool.GlobalVariables(preflightVariables...)
+		if err != nil {
+			return "", false, errors.Trace(err)
+		}
+		p.variables = variables
+	}
+	value, ok := p.variables[name]
+	return value, ok, nil
+}
+
+func (p *Preflight) binaryLogs() ([]BinlogFile, error) {
+	if p.files == nil {
+		files, err := NewTimestampPositionTool(p.conn, p.cfg).ShowBinaryLogs()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		p.files = files
+	}
+	return p.files, nil
+}
+
+func (p *Preflight) mariadb() bool {
+	return syncerFlavor(p.cfg.Flavor) == mysql.MariaDBFlavor
+}
+
+// Run 执行检查，不传 checks 时执行 DefaultPreflightChecks
+func (p *Preflight) Run(checks ...PreflightCheck) *PreflightReport {
+	if len(checks) == 0 {
+		checks = DefaultPreflightChecks()
+	}
+	report := &PreflightReport{}
+	for _, check := range checks {
+		result := CheckResult{
+			Name:     check.Name,
+			Severity: check.Severity,
+		}
+		passed, message, err := check.Run(p)
+		if err != nil {
+			passed = false
+			message = fmt.Sprintf("check failed: %v", err)
+		}
+		result.Passed = passed
+		result.Message = message
+		if !passed {
+			result.Remediation = check.Remediation
+			log.Warnf("binlog preflight [%s] %s: %s", result.Severity, result.Name, result.Message)
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+// expectVariable 变量等于期望值即通过，变量不存在时按 missingPassed 处理
+func expectVariable(name, expected string, missingPassed bool) func(p *Preflight) (bool, string, error) {
+	return func(p *Preflight) (bool, string, error) {
+		value, ok, err := p.Variable(name)
+		if err != nil {
+			return false, "", err
+		}
+		if !ok {
+			return missingPassed, fmt.Sprintf("%s is not supported by server", name), nil
+		}
+		return strings.EqualFold(value, expected), fmt.Sprintf("%s=%s", name, value), nil
+	}
+}
+
+func DefaultPreflightChecks() []PreflightCheck {
+	return []PreflightCheck{
+		{
+			Name:        "log_bin",
+			Severity:    SeverityError,
+			Remediation: "enable binary logging with log_bin in my.cnf and restart the server",
+			Run:         expectVariable("log_bin", "ON", false),
+		},
+		{
+			Name:        "binlog_format",
+			Severity:    SeverityError,
+			Remediation: "SET GLOBAL binlog_format = 'ROW' and persist it in my.cnf",
+			Run:         expectVariable("binlog_format", "ROW", false),
+		},
+		{
+			Name:        "binlog_row_image",
+			Severity:    SeverityError,
+			Remediation: "SET GLOBAL binlog_row_image = 'FULL' and persist it in my.cnf",
+			Run:         expectVariable("binlog_row_image", "FULL", true),
+		},
+		{
+			Name:        "binlog_rows_query_log_events",
+			Severity:    SeverityInfo,
+			Remediation: "SET GLOBAL binlog_rows_query_log_events = ON to carry the original SQL of row events",
+			Run:         expectVariable("binlog_rows_query_log_events", "ON", true),
+		},
+		{
+			Name:        "binlog_row_metadata",
+			Severity:    SeverityWarning,
+			Remediation: "SET GLOBAL binlog_row_metadata = 'FULL' (MySQL 8.0.1+) so row events carry column names, otherwise a schema store is required",
+			Run:         expectVariable("binlog_row_metadata", "FULL", false),
+		},
+		{
+			Name:        "gtid_mode",
+			Severity:    SeverityWarning,
+			Remediation: "enable gtid_mode = ON to resume by GTID after failover",
+			Run:         checkGTIDMode,
+		},
+		{
+			Name:        "enforce_gtid_consistency",
+			Severity:    SeverityWarning,
+			Remediation: "SET GLOBAL enforce_gtid_consistency = ON before enabling gtid_mode",
+			Run: func(p *Preflight) (bool, string, error) {
+				if p.mariadb() {
+					return true, "mariadb has no enforce_gtid_consistency", nil
+				}
+				return expectVariable("enforce_gtid_consistency", "ON", false)(p)
+			},
+		},
+		{
+			Name:        "binlog_retention",
+			Severity:    SeverityWarning,
+			Remediation: "increase binlog_expire_logs_seconds (or expire_logs_days) so binlogs outlive sync downtime",
+			Run:         checkBinlogRetention,
+		},
+		{
+			Name:        "replication_privileges",
+			Severity:    SeverityError,
+			Remediation: "GRANT REPLICATION SLAVE, REPLICATION CLIENT ON *.* TO the sync user",
+			Run:         checkReplicationPrivileges,
+		},
+		{
+			Name:        "server_id",
+			Severity:    SeverityError,
+			Remediation: "choose a BinlogReaderConfig.ServerID unused by the source and its replicas",
+			Run:         checkServerID,
+		},
+		{
+			Name:        "start_position",
+			Severity:    SeverityError,
+			Remediation: "the requested start position has been purged, start from a newer position or resnapshot",
+			Run:         checkStartPosition,
+		},
+	}
+}
+
+func checkGTIDMode(p *Preflight) (bool, string, error) {
+	if p.mariadb() {
+		return true, "mariadb gtid is always enabled", nil
+	}
+	value, ok, err := p.Variable("gtid_mode")
+	if err != nil {
+		return false, "", err
+	}
+	if ok && strings.EqualFold(value, "ON") {
+		return true, "gtid_mode=ON", nil
+	}
+	if p.cfg.StartPosition.BinlogGTID != "" {
+		return false, "", fmt.Errorf("start position uses gtid %s but gtid_mode=%s", p.cfg.StartPosition.BinlogGTID, value)
+	}
+	return false, fmt.Sprintf("gtid_mode=%s", value), nil
+}
+
+// binlogRetention 返回 binlog 保留时间，0 表示不自动清理
+func (p *Preflight) binlogRetention() (time.Duration, error) {
+	if value, ok, err := p.Variable("binlog_expire_logs_seconds"); err != nil {
+		return 0, err
+	} else if ok {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		if seconds > 0 {
+			return time.Duration(seconds) * time.Second, nil
+		}
+	}
+	if value, ok, err := p.Variable("expire_logs_days"); err != nil {
+		return 0, err
+	} else if ok {
+		days, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+	return 0, nil
+}
+
+func checkBinlogRetention(p *Preflight) (bool, string, error) {
+	retention, err := p.binlogRetention()
+	if err != nil {
+		return false, "", err
+	}
+	if retention == 0 {
+		return true, "binlogs never expire", nil
+	}
+	if retention < MinBinlogRetention {
+		return false, fmt.Sprintf("binlog retention %s is shorter than %s", retention, MinBinlogRetention), nil
+	}
+	file := p.cfg.StartPosition.BinLogFileName
+	if file == "" {
+		return true, fmt.Sprintf("binlog retention %s", retention), nil
+	}
+	// 起始文件按创建时间估算剩余保留时间
+	tool := NewTimestampPositionTool(p.conn, p.cfg)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	header, err := tool.readHeader(ctx, BinlogFile{Name: file})
+	if err != nil {
+		return false, "", err
+	}
+	remaining := time.Until(time.Unix(int64(header.timestamp), 0).Add(retention))
+	if remaining < time.Hour {
+		return false, fmt.Sprintf("start file %s expires in %s", file, remaining.Truncate(time.Second)), nil
+	}
+	return true, fmt.Sprintf("start file %s expires in %s", file, remaining.Truncate(time.Second)), nil
+}
+
+func checkReplicationPrivileges(p *Preflight) (bool, string, error) {
+	rows, err := p.conn.Query("SHOW GRANTS FOR CURRENT_USER()")
+	if err != nil {
+		return false, "", errors.Trace(err)
+	}
+	defer func() {
+		if err = rows.Close(); err != nil {
+			log.Warnf("failed to close rows: %s", err.Error())
+		}
+	}()
+	var grants []string
+	for rows.Next() {
+		var grant string
+		if err = rows.Scan(&grant); err != nil {
+			return false, "", errors.Trace(err)
+		}
+		grants = append(grants, strings.ToUpper(grant))
+	}
+	if err = rows.Err(); err != nil {
+		return false, "", errors.Trace(err)
+	}
+	var (
+		slave  bool
+		client bool
+	)
+	for _, grant := range grants {
+		if !strings.Contains(grant, " ON *.* ") {
+			continue
+		}
+		if strings.Contains(grant, "ALL PRIVILEGES") {
+			return true, "ALL PRIVILEGES ON *.*", nil
+		}
+		// MySQL 8.0.26+ 的别名 REPLICATION REPLICA
+		slave = slave || strings.Contains(grant, "REPLICATION SLAVE") || strings.Contains(grant, "REPLICATION REPLICA")
+		client = client || strings.Contains(grant, "REPLICATION CLIENT") || strings.Contains(grant, "BINLOG MONITOR")
+	}
+	var missing []string
+	if !slave {
+		missing = append(missing, "REPLICATION SLAVE")
+	}
+	if !client {
+		missing = append(missing, "REPLICATION CLIENT")
+	}
+	if len(missing) > 0 {
+		return false, fmt.Sprintf("missing %s", strings.Join(missing, ", ")), nil
+	}
+	return true, "REPLICATION SLAVE, REPLICATION CLIENT granted", nil
+}
+
+func checkServerID(p *Preflight) (bool, string, error) {
+	serverID := strconv.FormatUint(uint64(p.cfg.ServerID), 10)
+	if p.cfg.ServerID == 0 {
+		return false, "BinlogReaderConfig.ServerID must not be 0", nil
+	}
+	if value, _, err := p.Variable("server_id"); err != nil {
+		return false, "", err
+	} else if value == serverID {
+		return false, fmt.Sprintf("server_id %s equals the source server_id", serverID), nil
+	}
+	replicas, err := p.replicaServerIDs()
+	if err != nil {
+		log.Warnf("list replicas err: %v", err)
+		return true, fmt.Sprintf("server_id %s does not collide with source, replicas unknown", serverID), nil
+	}
+	if _, ok := replicas[serverID]; ok {
+		return false, fmt.Sprintf("server_id %s is used by a connected replica", serverID), nil
+	}
+	return true, fmt.Sprintf("server_id %s is unused", serverID), nil
+}
+
+// replicaServerIDs SHOW REPLICAS(8.0.22+) 不存在时使用 SHOW SLAVE HOSTS
+func (p *Preflight) replicaServerIDs() (map[string]struct{}, error) {
+	rows, err := p.conn.Query("SHOW REPLICAS")
+	if err != nil {
+		if rows, err = p.conn.Query("SHOW SLAVE HOSTS"); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	defer func() {
+		if err = rows.Close(); err != nil {
+			log.Warnf("failed to close rows: %s", err.Error())
+		}
+	}()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	ids := make(map[string]struct{})
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, errors.Trace(err)
+		}
+		for i, column := range columns {
+			if strings.EqualFold(column, "Server_id") {
+				ids[values[i].String] = struct{}{}
+			}
+		}
+	}
+	return ids, errors.Trace(rows.Err())
+}
+
+func checkStartPosition(p *Preflight) (bool, string, error) {
+	pos := p.cfg.StartPosition
+	if pos.BinlogGTID != "" {
+		if p.mariadb() {
+			return true, fmt.Sprintf("start from gtid %s", pos.BinlogGTID), nil
+		}
+		purged, _, err := p.Variable("gtid_purged")
+		if err != nil {
+			return false, "", err
+		}
+		purgedSet, err := mysql.ParseMysqlGTIDSet(strings.ReplaceAll(purged, "\n", ""))
+		if err != nil {
+			return false, "", errors.Trace(err)
+		}
+		startSet, err := pos.GTIDSet(p.cfg.Flavor)
+		if err != nil {
+			return false, "", errors.Trace(err)
+		}
+		if !startSet.Contain(purgedSet) {
+			return false, fmt.Sprintf("gtid_purged %s is not contained in start gtid %s", purged, pos.BinlogGTID), nil
+		}
+		return true, fmt.Sprintf("start from gtid %s", pos.BinlogGTID), nil
+	}
+	if pos.BinLogFileName == "" {
+		return true, "start from current position", nil
+	}
+	files, err := p.binaryLogs()
+	if err != nil {
+		return false, "", err
+	}
+	for _, file := range files {
+		if file.Name == pos.BinLogFileName {
+			if uint64(pos.BinLogFilePos) > file.Size {
+				return false, fmt.Sprintf("start pos %d exceeds %s size %d", pos.BinLogFilePos, file.Name, file.Size), nil
+			}
+			return true, fmt.Sprintf("start file %s exists", file.Name), nil
+		}
+	}
+	return false, fmt.Sprintf("start file %s no longer exists", pos.BinLogFileName), nil
+}
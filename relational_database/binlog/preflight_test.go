@@ -0,0 +1,48 @@
+package binlog
+
+import "testing"
+
+func TestPreflightReport(t *testing.T) {
+	p := &Preflight{
+		cfg: BinlogReaderConfig{ServerID: 1001},
+		variables: map[string]string{
+			"log_bin":                    "ON",
+			"binlog_format":              "ROW",
+			"binlog_row_image":           "MINIMAL",
+			"gtid_mode":                  "OFF",
+			"binlog_expire_logs_seconds": "3600",
+			"server_id":                  "1001",
+		},
+	}
+	checks := []PreflightCheck{}
+	for _, check := range DefaultPreflightChecks() {
+		switch check.Name {
+		case "log_bin", "binlog_format", "binlog_row_image", "binlog_row_metadata", "gtid_mode", "binlog_retention", "server_id":
+			checks = append(checks, check)
+		}
+	}
+	report := p.Run(checks...)
+	expected := map[string]bool{
+		"log_bin":             true,
+		"binlog_format":       true,
+		"binlog_row_image":    false,
+		"binlog_row_metadata": false,
+		"gtid_mode":           false,
+		"binlog_retention":    false,
+		"server_id":           false,
+	}
+	for _, result := range report.Results {
+		if result.Passed != expected[result.Name] {
+			t.Fatalf("%s passed %v: %s", result.Name, result.Passed, result.Message)
+		}
+		if !result.Passed && result.Remediation == "" {
+			t.Fatalf("%s missing remediation", result.Name)
+		}
+	}
+	if report.Error() == nil {
+		t.Fatal("report should contain errors")
+	}
+	if len(report.Failed()) != 5 {
+		t.Fatalf("unexpected failed count %d", len(report.Failed()))
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"math"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/go-mysql-org/go-mysql/replication"
@@ -17,16 +18,27 @@ import (
 	"github.com/xuenqlve/common/errors"
 	"github.com/xuenqlve/common/event"
 	"github.com/xuenqlve/common/log"
+	mysql_ddl "github.com/xuenqlve/common/relational_database/ddl_parser"
 	"github.com/xuenqlve/common/schema_store"
 )
 
 type BinlogReaderConfig struct {
-	Host          string   `mapstructure:"host" yaml:"host" toml:"host"`
-	Port          uint16   `mapstructure:"port" yaml:"port" toml:"port"`
-	User          string   `mapstructure:"user" yaml:"user" toml:"user"`
-	Password      string   `mapstructure:"password" yaml:"password" toml:"password"`
-	ServerID      uint32   `mapstructure:"app-id" yaml:"app-id" toml:"app-id"`
+	Host     string `mapstructure:"host" yaml:"host" toml:"host"`
+	Port     uint16 `mapstructure:"port" yaml:"port" toml:"port"`
+	User     string `mapstructure:"user" yaml:"user" toml:"user"`
+	Password string `mapstructure:"password" yaml:"password" toml:"password"`
+	ServerID uint32 `mapstructure:"app-id" yaml:"app-id" toml:"app-id"`
+	// Flavor mysql | mariadb | percona，为空时为 mysql
+	Flavor        string   `mapstructure:"flavor" yaml:"flavor" toml:"flavor"`
 	StartPosition Position `mapstructure:"start-pos" yaml:"start-pos" toml:"start-pos"`
+	// TableFilter 为空时同步全部库表
+	TableFilter []TableFilterRule `mapstructure:"table-filter" yaml:"table-filter" toml:"table-filter"`
+	// HeartbeatPeriod 源库空闲时发送 HeartbeatEvent 的间隔，为 0 时不开启
+	HeartbeatPeriod time.Duration `mapstructure:"heartbeat-period" yaml:"heartbeat-period" toml:"heartbeat-period"`
+	// Heartbeat 心跳表的行事件用于计算端到端延迟，不会传递给 eventHandler
+	Heartbeat HeartbeatTableConfig `mapstructure:"heartbeat" yaml:"heartbeat" toml:"heartbeat"`
+	// OnlineDDL 识别 gh-ost/pt-osc 的辅助表，屏蔽其行事件和 DDL，cut-over 时输出原表上的 ALTER
+	OnlineDDL bool `mapstructure:"online-ddl" yaml:"online-ddl" toml:"online-ddl"`
 }
 
 func (c *BinlogReaderConfig) SetStartPosition(pos Position) {
@@ -34,6 +46,9 @@ func (c *BinlogReaderConfig) SetStartPosition(pos Position) {
 }
 
 func (c *BinlogReaderConfig) Check() (bool, error) {
+	if err := CheckFlavor(c.Flavor); err != nil {
+		return false, err
+	}
 	pos := c.StartPosition
 	if pos.BinlogGTID != "" {
 		return true, nil
@@ -57,6 +72,9 @@ type BinlogReader struct {
 	cfg             BinlogReaderConfig
 	eventHandler    EventHandler
 	loader          ddl_parser.Loader
+	filter          *TableFilter
+	onlineDDL       *OnlineDDL
+	endToEndDelay   atomic.Int64
 	timestamp       uint32
 	currentPosition Position
 	closed          atomic.Bool
@@ -72,8 +90,24 @@ func NewBinlogReader(ctx context.Context, cfg BinlogReaderConfig) (reader *Binlo
 		currentPosition: cfg.StartPosition,
 	}
 	reader.closed.Store(false)
-	reader.syncer = NewBinlogSyncer(cfg.ServerID, cfg.Host, cfg.Port, cfg.User, cfg.Password)
-	reader.streamer, err = NewBinlogStreamer(reader.syncer, cfg.StartPosition)
+	if reader.filter, err = NewTableFilter(cfg.TableFilter); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if reader.cfg.Heartbeat.Enable {
+		reader.cfg.Heartbeat.init()
+	}
+	syncerConfig := binlogSyncerConfig(cfg.Flavor, cfg.ServerID, cfg.Host, cfg.Port, cfg.User, cfg.Password)
+	syncerConfig.HeartbeatPeriod = cfg.HeartbeatPeriod
+	if cfg.OnlineDDL {
+		reader.onlineDDL = NewOnlineDDL()
+	}
+	if !reader.filter.Empty() || reader.onlineDDL != nil {
+		syncerConfig.RowsEventDecodeFunc = reader.decodeRowsEvent
+		loader := mysql_ddl.NewPingCapLoader()
+		reader.loader = &loader
+	}
+	reader.syncer = replication.NewBinlogSyncer(syncerConfig)
+	reader.streamer, err = NewBinlogStreamerWithFlavor(reader.syncer, cfg.Flavor, cfg.StartPosition)
 	if err != nil {
 		return nil, err
 	}
@@ -119,6 +153,11 @@ func (r *BinlogReader) Run() error {
 			}
 			return errors.Trace(err)
 		}
+		// 心跳只在源库空闲且已追上时发送
+		if isHeartbeatEvent(event) {
+			atomic.StoreUint32(r.delay, 0)
+			continue
+		}
 		r.currentPosition.BinLogFilePos = event.Header.LogPos
 		r.updateReplicationDelay(event)
 		switch e := event.Event.(type) {
@@ -181,8 +220,12 @@ func (r *BinlogReader) handleEvent(ev *replication.BinlogEvent) (err error) {
 		if err != nil {
 			return errors.Trace(err)
 		}
-		currentPos.BinlogGTID = gtidSet.String()
-		if err = r.eventHandler.OnGTID(gtidSet.String()); err != nil {
+		binlogGTID := ""
+		if binlogGTID, err = MergeGTID(FlavorMariaDB, r.currentPosition.BinlogGTID, gtidSet.String()); err != nil {
+			return errors.Trace(err)
+		}
+		currentPos.BinlogGTID = binlogGTID
+		if err = r.eventHandler.OnGTID(binlogGTID); err != nil {
 			return errors.Trace(err)
 		}
 	case *replication.GTIDEvent:
@@ -213,9 +256,15 @@ func (r *BinlogReader) handleEvent(ev *replication.BinlogEvent) (err error) {
 			currentPos.BinlogGTID = e.GSet.String()
 		}
 		force = true
-		if err = r.eventHandler.OnDDL(e.Schema, e.Query); err != nil {
+		var queries [][]byte
+		if queries, err = r.rewriteDDL(e.Schema, e.Query); err != nil {
 			return errors.Trace(err)
 		}
+		for _, query := range queries {
+			if err = r.eventHandler.OnDDL(e.Schema, query); err != nil {
+				return errors.Trace(err)
+			}
+		}
 	case *replication.RowsEvent:
 		var dmlType schema_store.DML
 		switch ev.Header.EventType {
@@ -228,6 +277,15 @@ func (r *BinlogReader) handleEvent(ev *replication.BinlogEvent) (err error) {
 		default:
 			return errors.Errorf("[RowsEvent] unknown rows event type: %v", ev.Header.EventType)
 		}
+		if r.cfg.Heartbeat.match(string(e.Table.Schema), string(e.Table.Table)) {
+			if lag, ok := heartbeatLag(e); ok {
+				r.endToEndDelay.Store(int64(lag))
+			}
+			return nil
+		}
+		if !r.acceptRows(string(e.Table.Schema), string(e.Table.Table), dmlType) {
+			return nil
+		}
 		if err = r.eventHandler.OnRow(dmlType, e); err != nil {
 			return errors.Trace(err)
 		}
@@ -242,6 +300,86 @@ func (r *BinlogReader) handleEvent(ev *replication.BinlogEvent) (err error) {
 	return nil
 }
 
+// rewriteDDL 按表过滤规则及在线变更识别处理 DDL，返回需要交给 eventHandler 的语句，
+// 无法解析的语句原样返回
+func (r *BinlogReader) rewriteDDL(schema []byte, query []byte) ([][]byte, error) {
+	if r.filter.Empty() && r.onlineDDL == nil {
+		return [][]byte{query}, nil
+	}
+	ddlSQL := strings.TrimSpace(string(query))
+	if r.onlineDDL != nil && r.onlineDDL.HandleTrigger(ddlSQL) {
+		return nil, nil
+	}
+	stmts, err := r.loader.Parse(ddl_parser.DDL{Schema: string(schema), SQL: ddlSQL})
+	if err != nil {
+		log.Warnf("parse ddl failed, pass through query: %s, err: %v", ddlSQL, err)
+		return [][]byte{query}, nil
+	}
+	changed := false
+	if r.onlineDDL != nil {
+		stmts, changed = r.onlineDDL.Handle(ddlSQL, stmts)
+	}
+	if !changed {
+		if !r.filter.AcceptDDL(stmts) {
+			return nil, nil
+		}
+		return [][]byte{query}, nil
+	}
+	queries := make([][]byte, 0, len(stmts))
+	for _, stmt := range stmts {
+		// 先生成 SQL，改写后的表名才会进入 Metadata
+		generated, err := stmt.GenerateSQL()
+		if err != nil {
+			return nil, errors.Annotatef(err, "online ddl generate sql from %s", ddlSQL)
+		}
+		if !r.filter.AcceptDDL([]ddl_parser.Statement{stmt}) {
+			continue
+		}
+		log.Infof("online ddl: translate %s to %v", ddlSQL, generated)
+		queries = append(queries, []byte(fmt.Sprint(generated)))
+	}
+	return queries, nil
+}
+
+// acceptRows 辅助表由 Run 中按顺序处理的 DDL 确认，解码时只检查过滤规则
+func (r *BinlogReader) acceptRows(database, table string, dmlType schema_store.DML) bool {
+	if r.onlineDDL != nil && r.onlineDDL.IsGhostTable(database, table) {
+		return false
+	}
+	return r.filter.AcceptDML(database, table, dmlType)
+}
+
+// decodeRowsEvent 心跳表总是解码，其余按表过滤规则跳过，并剔除过滤规则中的列。
+// 解码在读取事件的协程中进行，先于 Run 处理之前的 DDL，在线变更辅助表在 Run 中跳过
+func (r *BinlogReader) decodeRowsEvent(e *replication.RowsEvent, data []byte) error {
+	pos, err := e.DecodeHeader(data)
+	if err != nil {
+		return err
+	}
+	if r.cfg.Heartbeat.match(string(e.Table.Schema), string(e.Table.Table)) {
+		return e.DecodeData(pos, data)
+	}
+	if !r.filter.AcceptDML(string(e.Table.Schema), string(e.Table.Table), rowsEventDML(e)) {
+		return nil
+	}
+	indexes, err := r.filter.ignoreColumnIndexes(e.Table)
+	if err != nil {
+		return err
+	}
+	if err = e.DecodeData(pos, data); err != nil {
+		return err
+	}
+	if len(indexes) > 0 {
+		excludeRowsColumns(e, indexes)
+	}
+	return nil
+}
+
+// TableFilter 返回 reader 使用的表过滤规则
+func (r *BinlogReader) TableFilter() *TableFilter {
+	return r.filter
+}
+
 func (r *BinlogReader) makeGTIDSet(sid []byte, gno int64) (string, error) {
 	u, err := uuid.FromBytes(sid)
 	if err != nil {
@@ -278,6 +416,11 @@ func (r *BinlogReader) GetDelay() uint32 {
 	return atomic.LoadUint32(r.delay)
 }
 
+// GetEndToEndDelay 最近一次心跳行从写入到被读取的延迟，需要开启 Heartbeat
+func (r *BinlogReader) GetEndToEndDelay() time.Duration {
+	return time.Duration(r.endToEndDelay.Load())
+}
+
 func (r *BinlogReader) SyncedTimestamp() uint32 {
 	return r.timestamp
 }
@@ -0,0 +1,256 @@
+package binlog
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/xuenqlve/common/errors"
+	"github.com/xuenqlve/common/relational_database/mysql"
+	"github.com/xuenqlve/common/schema_store"
+	sql_tool "github.com/xuenqlve/common/sql"
+)
+
+// RowChange 解码后的单行变更，Before 在 update/delete 时存在，After 在 insert/update 时存在
+type RowChange struct {
+	Database string
+	Table    string
+	Type     schema_store.DML
+	Columns  []mysql.Column
+	// PrimaryKey 行的唯一标识列，无主键时为最短的唯一键
+	PrimaryKey []string
+	Before     map[string]any
+	After      map[string]any
+}
+
+// Image 返回标识该行的镜像，delete 为 Before，其余为 After
+func (c RowChange) Image() map[string]any {
+	if c.Type == schema_store.Delete {
+		return c.Before
+	}
+	return c.After
+}
+
+// Key 按 库.表.主键 生成行标识，同一行的变更 Key 相同
+func (c RowChange) Key() string {
+	return mysql.MakeRowKey(c.Database, c.Table, sql_tool.ScanKey(c.PrimaryKey, c.Image()))
+}
+
+// PrimaryKeyChanged update 是否修改了主键
+func (c RowChange) PrimaryKeyChanged() bool {
+	if c.Type != schema_store.Update {
+		return false
+	}
+	return sql_tool.ScanKey(c.PrimaryKey, c.Before) != sql_tool.ScanKey(c.PrimaryKey, c.After)
+}
+
+// SplitPrimaryKeyUpdate 修改了主键的 update 拆分为按变更前镜像的 delete 和按变更后镜像的 insert，
+// 使按 Key 分区的消费者分别在旧行和新行上保持顺序，其余变更原样返回
+func (c RowChange) SplitPrimaryKeyUpdate() []RowChange {
+	if !c.PrimaryKeyChanged() {
+		return []RowChange{c}
+	}
+	deleted, inserted := c, c
+	deleted.Type, deleted.After = schema_store.Delete, nil
+	inserted.Type, inserted.Before = schema_store.Insert, nil
+	return []RowChange{deleted, inserted}
+}
+
+// RowData 转换为 generate_sql 使用的 mysql.RowData，GuideKeys 取自变更前镜像
+func (c RowChange) RowData() (mysql.RowData, error) {
+	row := mysql.RowData{}
+	var err error
+	switch c.Type {
+	case schema_store.Insert:
+		row.Data = c.After
+		row.GuideKeys, row.Key, err = sql_tool.GenerateGuideKeys(c.PrimaryKey, c.After)
+	case schema_store.Update:
+		row.Data = c.After
+		row.Old = c.Before
+		row.GuideKeys, row.Key, err = sql_tool.GenerateGuideKeys(c.PrimaryKey, c.Before)
+	case schema_store.Delete:
+		row.Data = c.Before
+		row.GuideKeys, row.Key, err = sql_tool.GenerateGuideKeys(c.PrimaryKey, c.Before)
+	default:
+		return row, fmt.Errorf("unknown dml type: %v", c.Type)
+	}
+	if err != nil {
+		return row, errors.Trace(err)
+	}
+	row.Key = mysql.MakeRowKey(c.Database, c.Table, row.Key)
+	return row, nil
+}
+
+// RowDecoder 将 RowsEvent 解码为 RowChange。
+// schemaStore 不为空时使用表结构解析列，否则依赖 binlog_row_metadata=FULL 时 TableMapEvent 中的列信息。
+type RowDecoder struct {
+	schemaStore schema_store.SchemaStore
+	filter      *TableFilter
+}
+
+func NewRowDecoder(schemaStore schema_store.SchemaStore) *RowDecoder {
+	return &RowDecoder{
+		schemaStore: schemaStore,
+	}
+}
+
+// SetTableFilter 设置后解码时剔除过滤规则中的列
+func (d *RowDecoder) SetTableFilter(filter *TableFilter) {
+	d.filter = filter
+}
+
+// Invalidate 表结构变更后清理缓存
+func (d *RowDecoder) Invalidate(database, table string) {
+	if d.schemaStore == nil {
+		return
+	}
+	d.schemaStore.InvalidateSchemaCache(&mysql.Index{Database: database, Table: table})
+}
+
+func (d *RowDecoder) Decode(dmlType schema_store.DML, e *replication.RowsEvent) ([]RowChange, error) {
+	database, table := string(e.Table.Schema), string(e.Table.Table)
+	columns, primaryKey, err := d.columns(e.Table)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	ignoreColumns := d.filter.IgnoreColumns(database, table)
+	changeColumns := columns
+	if len(ignoreColumns) > 0 {
+		for _, key := range primaryKey {
+			if _, ok := ignoreColumns[key]; ok {
+				return nil, fmt.Errorf("table %s.%s primary key column %s can not be ignored", database, table, key)
+			}
+		}
+		changeColumns = excludeColumns(columns, ignoreColumns)
+	}
+
+	step := 1
+	if dmlType == schema_store.Update {
+		step = 2
+	}
+	changes := make([]RowChange, 0, len(e.Rows)/step)
+	for i := 0; i+step <= len(e.Rows); i += step {
+		change := RowChange{
+			Database:   database,
+			Table:      table,
+			Type:       dmlType,
+			Columns:    changeColumns,
+			PrimaryKey: primaryKey,
+		}
+		switch dmlType {
+		case schema_store.Insert:
+			change.After, err = decodeRow(e.Rows[i], columns, ignoreColumns)
+		case schema_store.Delete:
+			change.Before, err = decodeRow(e.Rows[i], columns, ignoreColumns)
+		case schema_store.Update:
+			if change.Before, err = decodeRow(e.Rows[i], columns, ignoreColumns); err == nil {
+				change.After, err = decodeRow(e.Rows[i+1], columns, ignoreColumns)
+			}
+		default:
+			err = fmt.Errorf("unknown dml type: %v", dmlType)
+		}
+		if err != nil {
+			return nil, errors.Annotatef(err, "decode %s.%s rows", database, table)
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+func (d *RowDecoder) columns(tableMap *replication.TableMapEvent) ([]mysql.Column, []string, error) {
+	database, table := string(tableMap.Schema), string(tableMap.Table)
+	if d.schemaStore != nil {
+		index := &mysql.Index{Database: database, Table: table}
+		schema, err := d.schemaStore.GetSchema(index)
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		tableDef, ok := schema.(*mysql.Table)
+		if !ok {
+			return nil, nil, fmt.Errorf("schema of %s.%s is not *mysql.Table: %T", database, table, schema)
+		}
+		// 缓存的表结构与 binlog 列数不一致时重新加载一次
+		if len(tableDef.Columns) != int(tableMap.ColumnCount) {
+			d.schemaStore.InvalidateSchemaCache(index)
+			if schema, err = d.schemaStore.GetSchema(index); err != nil {
+				return nil, nil, errors.Trace(err)
+			}
+			tableDef = schema.(*mysql.Table)
+			if len(tableDef.Columns) != int(tableMap.ColumnCount) {
+				return nil, nil, fmt.Errorf("table %s.%s column count %d not equal binlog column count %d", database, table, len(tableDef.Columns), tableMap.ColumnCount)
+			}
+		}
+		return tableDef.Columns, identityColumns(tableDef), nil
+	}
+
+	names := tableMap.ColumnNameString()
+	if len(names) != int(tableMap.ColumnCount) {
+		return nil, nil, fmt.Errorf("table %s.%s column names unavailable, set binlog_row_metadata=FULL or use schema store", database, table)
+	}
+	unsigned := tableMap.UnsignedMap()
+	columns := make([]mysql.Column, 0, len(names))
+	for i, name := range names {
+		column := mysql.Column{
+			Name:       name,
+			IsUnsigned: unsigned[i],
+		}
+		if tableMap.IsCharacterColumn(i) {
+			column.Type = mysql.TypeString
+		}
+		columns = append(columns, column)
+	}
+	primaryKey := make([]string, 0, len(tableMap.PrimaryKey))
+	for _, index := range tableMap.PrimaryKey {
+		if int(index) < len(columns) {
+			columns[index].IsPrimaryKey = true
+			primaryKey = append(primaryKey, columns[index].Name)
+		}
+	}
+	return columns, primaryKey, nil
+}
+
+// identityColumns 行标识列：优先 scan column，其次主键，最后取最短的唯一键
+func identityColumns(table *mysql.Table) []string {
+	if columns := table.ScanColumns(); len(columns) > 0 {
+		return columns
+	}
+	if len(table.PrimaryIndex) > 0 {
+		return table.PrimaryIndex
+	}
+	var columns []string
+	names := make([]string, 0, len(table.UniqueIndex))
+	for name := range table.UniqueIndex {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if uk := table.UniqueIndex[name]; columns == nil || len(uk) < len(columns) {
+			columns = uk
+		}
+	}
+	return columns
+}
+
+func excludeColumns(columns []mysql.Column, ignoreColumns map[string]struct{}) []mysql.Column {
+	result := make([]mysql.Column, 0, len(columns))
+	for _, column := range columns {
+		if _, ok := ignoreColumns[column.Name]; !ok {
+			result = append(result, column)
+		}
+	}
+	return result
+}
+
+func decodeRow(values []any, columns []mysql.Column, ignoreColumns map[string]struct{}) (map[string]any, error) {
+	if len(values) != len(columns) {
+		return nil, fmt.Errorf("row value count %d not equal column count %d", len(values), len(columns))
+	}
+	row := make(map[string]any, len(columns))
+	for i, column := range columns {
+		if _, ok := ignoreColumns[column.Name]; ok {
+			continue
+		}
+		row[column.Name] = mysql.Deserialize(values[i], column)
+	}
+	return row, nil
+}
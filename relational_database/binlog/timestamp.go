@@ -0,0 +1,328 @@
+package binlog
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/xuenqlve/common/errors"
+	"github.com/xuenqlve/common/log"
+)
+
+// DefaultScanTimeout 单个 binlog 文件的扫描超时时间
+const DefaultScanTimeout = 5 * time.Minute
+
+// BinlogFile SHOW BINARY LOGS 的一行
+type BinlogFile struct {
+	Name string
+	Size uint64
+}
+
+// binlogFileHeader 文件开头的创建时间及之前文件已执行的 gtid
+type binlogFileHeader struct {
+	timestamp uint32
+	gtid      string
+}
+
+// TimestampPositionTool 按时间查找 binlog 起始位点，cfg 提供复制连接信息，
+// 扫描使用的 server id 由 cfg.ServerID 派生，不会与同一配置的 BinlogReader 冲突
+type TimestampPositionTool struct {
+	conn        *sql.DB
+	cfg         BinlogReaderConfig
+	ScanTimeout time.Duration
+}
+
+func NewTimestampPositionTool(conn *sql.DB, cfg BinlogReaderConfig) *TimestampPositionTool {
+	return &TimestampPositionTool{
+		conn:        conn,
+		cfg:         cfg,
+		ScanTimeout: DefaultScanTimeout,
+	}
+}
+
+// scanServerID 扫描 binlog 的 server id，翻转最高位以区别于 reader 使用的 server id
+func scanServerID(serverID uint32) uint32 {
+	return serverID ^ (1 << 31)
+}
+
+func (t *TimestampPositionTool) ShowBinaryLogs() ([]BinlogFile, error) {
+	rows, err := t.conn.Query(`SHOW BINARY LOGS`)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer func() {
+		if err = rows.Close(); err != nil {
+			log.Warnf("failed to close rows: %s", err.Error())
+		}
+	}()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	// Show an example.
+	/*
+		mysql> SHOW BINARY LOGS;
+		+---------------+-----------+-----------+
+		| Log_name      | File_size | Encrypted |
+		+---------------+-----------+-----------+
+		| binlog.000001 |       180 | No        |
+		| binlog.000002 |   1073201 | No        |
+		+---------------+-----------+-----------+
+	*/
+	var files []BinlogFile
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, errors.Trace(err)
+		}
+		file := BinlogFile{}
+		for i, column := range columns {
+			switch column {
+			case "Log_name":
+				file.Name = values[i].String
+			case "File_size":
+				if _, err = fmt.Sscan(values[i].String, &file.Size); err != nil {
+					return nil, errors.Trace(err)
+				}
+			}
+		}
+		files = append(files, file)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return files, nil
+}
+
+// FindPosition 返回时间 >= ts 的第一个事务开始位点及此前已执行的 gtid 集合，
+// ts 早于最早的 binlog 时返回最早文件的开头，晚于最新的事务时返回当前写入位置
+func (t *TimestampPositionTool) FindPosition(ctx context.Context, ts time.Time) (Position, error) {
+	files, err := t.ShowBinaryLogs()
+	if err != nil {
+		return Position{}, errors.Trace(err)
+	}
+	if len(files) == 0 {
+		return Position{}, fmt.Errorf("no binary logs, check log_bin is enabled")
+	}
+	target := uint32(ts.Unix())
+
+	low, header, err := searchBinlogFile(len(files), target, func(i int) (binlogFileHeader, error) {
+		header, err := t.readHeader(ctx, files[i])
+		if err != nil {
+			return header, errors.Annotatef(err, "read binlog %s header", files[i].Name)
+		}
+		return header, nil
+	})
+	if err != nil {
+		return Position{}, err
+	}
+	if header.timestamp > target {
+		log.Warnf("timestamp %s is earlier than the oldest binlog %s, start from its beginning", ts, files[low].Name)
+		return Position{BinLogFileName: files[low].Name, BinLogFilePos: 4, BinlogGTID: header.gtid}, nil
+	}
+
+	for i := low; i < len(files); i++ {
+		pos, found, err := t.scanFile(ctx, files[i], target)
+		if err != nil {
+			return Position{}, errors.Annotatef(err, "scan binlog %s", files[i].Name)
+		}
+		if found || i == len(files)-1 {
+			return pos, nil
+		}
+	}
+	return Position{}, fmt.Errorf("unreachable")
+}
+
+// searchBinlogFile 二分查找最后一个创建时间 <= target 的文件，都晚于 target 时返回第一个文件
+func searchBinlogFile(n int, target uint32, readHeader func(i int) (binlogFileHeader, error)) (int, binlogFileHeader, error) {
+	headers := make(map[int]binlogFileHeader)
+	read := func(i int) (binlogFileHeader, error) {
+		if header, ok := headers[i]; ok {
+			return header, nil
+		}
+		header, err := readHeader(i)
+		if err != nil {
+			return header, err
+		}
+		headers[i] = header
+		return header, nil
+	}
+	low, high := 0, n-1
+	for low < high {
+		mid := (low + high + 1) / 2
+		header, err := read(mid)
+		if err != nil {
+			return 0, header, err
+		}
+		if header.timestamp <= target {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	header, err := read(low)
+	return low, header, err
+}
+
+func (t *TimestampPositionTool) newStreamer(file string) (*replication.BinlogSyncer, *replication.BinlogStreamer, error) {
+	syncer := NewBinlogSyncerWithFlavor(t.cfg.Flavor, scanServerID(t.cfg.ServerID), t.cfg.Host, t.cfg.Port, t.cfg.User, t.cfg.Password)
+	streamer, err := syncer.StartSync(mysql.Position{Name: file, Pos: 4})
+	if err != nil {
+		syncer.Close()
+		return nil, nil, errors.Trace(err)
+	}
+	return syncer, streamer, nil
+}
+
+func (t *TimestampPositionTool) readHeader(ctx context.Context, file BinlogFile) (binlogFileHeader, error) {
+	header := binlogFileHeader{}
+	ctx, cancel := context.WithTimeout(ctx, t.ScanTimeout)
+	defer cancel()
+	syncer, streamer, err := t.newStreamer(file.Name)
+	if err != nil {
+		return header, err
+	}
+	defer syncer.Close()
+	for {
+		ev, err := streamer.GetEvent(ctx)
+		if err != nil {
+			return header, errors.Trace(err)
+		}
+		switch e := ev.Event.(type) {
+		case *replication.FormatDescriptionEvent:
+			header.timestamp = ev.Header.Timestamp
+		case *replication.PreviousGTIDsEvent:
+			header.gtid = e.GTIDSets
+			return header, nil
+		case *replication.MariadbGTIDListEvent:
+			gtids := make([]string, 0, len(e.GTIDs))
+			for _, gtid := range e.GTIDs {
+				gtids = append(gtids, gtid.String())
+			}
+			header.gtid = strings.Join(gtids, ",")
+			return header, nil
+		case *replication.RotateEvent:
+			continue
+		default:
+			// 未开启 gtid 的老版本没有 PreviousGTIDsEvent
+			return header, nil
+		}
+	}
+}
+
+// scanFile 在文件中查找第一个时间 >= target 的事务开始位置，文件内没有时返回文件末尾
+func (t *TimestampPositionTool) scanFile(ctx context.Context, file BinlogFile, target uint32) (Position, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.ScanTimeout)
+	defer cancel()
+	syncer, streamer, err := t.newStreamer(file.Name)
+	if err != nil {
+		return Position{}, false, err
+	}
+	defer syncer.Close()
+
+	scanner, err := newTimestampScanner(t.cfg.Flavor, file, target)
+	if err != nil {
+		return Position{BinLogFileName: file.Name, BinLogFilePos: 4}, false, err
+	}
+	for {
+		ev, err := streamer.GetEvent(ctx)
+		if err != nil {
+			return Position{BinLogFileName: file.Name, BinLogFilePos: 4}, false, errors.Trace(err)
+		}
+		pos, done, found, err := scanner.next(ev)
+		if err != nil || done {
+			return pos, found, err
+		}
+	}
+}
+
+// timestampScanner 按顺序处理一个文件的事件，记录已执行的 gtid 并识别事务边界
+type timestampScanner struct {
+	file    BinlogFile
+	target  uint32
+	gtidSet mysql.GTIDSet
+	inTxn   bool
+}
+
+func newTimestampScanner(flavor string, file BinlogFile, target uint32) (*timestampScanner, error) {
+	gtidSet, err := mysql.ParseGTIDSet(syncerFlavor(flavor), "")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &timestampScanner{file: file, target: target, gtidSet: gtidSet}, nil
+}
+
+func (s *timestampScanner) position(pos uint32) Position {
+	return Position{BinLogFileName: s.file.Name, BinLogFilePos: pos, BinlogGTID: s.gtidSet.String()}
+}
+
+// next done 为 true 时扫描结束，found 表示找到了时间 >= target 的事务
+func (s *timestampScanner) next(ev *replication.BinlogEvent) (pos Position, done bool, found bool, err error) {
+	if ev.Header.LogPos == 0 {
+		// fake rotate
+		return
+	}
+	start := ev.Header.LogPos - ev.Header.EventSize
+	if ev.Header.EventType == replication.STOP_EVENT {
+		return s.position(start), true, false, nil
+	}
+	boundary, begin := false, false
+	var gtid string
+	switch e := ev.Event.(type) {
+	case *replication.PreviousGTIDsEvent:
+		if err = s.gtidSet.Update(e.GTIDSets); err != nil {
+			return pos, false, false, errors.Trace(err)
+		}
+	case *replication.MariadbGTIDListEvent:
+		for _, g := range e.GTIDs {
+			if err = s.gtidSet.Update(g.String()); err != nil {
+				return pos, false, false, errors.Trace(err)
+			}
+		}
+	case *replication.GTIDEvent:
+		boundary, begin = true, true
+		if e.GNO > 0 {
+			next, err := e.GTIDNext()
+			if err != nil {
+				return pos, false, false, errors.Trace(err)
+			}
+			gtid = next.String()
+		}
+	case *replication.MariadbGTIDEvent:
+		boundary, begin = true, true
+		gtid = e.GTID.String()
+	case *replication.QueryEvent:
+		// 没有 gtid 事件时 BEGIN 或 DDL 是事务开始
+		boundary = !s.inTxn
+		begin = strings.EqualFold(strings.TrimSpace(string(e.Query)), "BEGIN")
+	case *replication.XIDEvent:
+		s.inTxn = false
+	case *replication.RotateEvent:
+		return s.position(start), true, false, nil
+	}
+	if boundary {
+		if ev.Header.Timestamp >= s.target {
+			return s.position(start), true, true, nil
+		}
+		s.inTxn = begin
+	}
+	if gtid != "" {
+		// 事务开始时间早于 target，视为已执行
+		if err = s.gtidSet.Update(gtid); err != nil {
+			return pos, false, false, errors.Trace(err)
+		}
+	}
+	// 当前正在写入的文件，读到 SHOW BINARY LOGS 时的大小即结束
+	if s.file.Size > 0 && uint64(ev.Header.LogPos) >= s.file.Size {
+		return s.position(ev.Header.LogPos), true, false, nil
+	}
+	return
+}
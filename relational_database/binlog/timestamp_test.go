@@ -0,0 +1,119 @@
+package binlog
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+func TestSearchBinlogFile(t *testing.T) {
+	timestamps := []uint32{10, 20, 30, 40}
+	reads := 0
+	readHeader := func(i int) (binlogFileHeader, error) {
+		reads++
+		return binlogFileHeader{timestamp: timestamps[i]}, nil
+	}
+	cases := map[uint32]int{5: 0, 10: 0, 25: 1, 30: 2, 50: 3}
+	for target, expected := range cases {
+		reads = 0
+		index, header, err := searchBinlogFile(len(timestamps), target, readHeader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if index != expected || header.timestamp != timestamps[expected] {
+			t.Fatalf("target %d expect file %d, got %d %+v", target, expected, index, header)
+		}
+		if reads > 3 {
+			t.Fatalf("target %d read %d headers", target, reads)
+		}
+	}
+
+	if _, _, err := searchBinlogFile(len(timestamps), 25, func(i int) (binlogFileHeader, error) {
+		return binlogFileHeader{}, fmt.Errorf("read header")
+	}); err == nil {
+		t.Fatal("read header error should be returned")
+	}
+
+	if scanServerID(5) == 5 || scanServerID(scanServerID(5)) != 5 {
+		t.Fatalf("scan server id: %d", scanServerID(5))
+	}
+}
+
+func scanEvent(timestamp, logPos, size uint32, eventType replication.EventType, event replication.Event) *replication.BinlogEvent {
+	return &replication.BinlogEvent{
+		Header: &replication.EventHeader{Timestamp: timestamp, LogPos: logPos, EventSize: size, EventType: eventType},
+		Event:  event,
+	}
+}
+
+func TestTimestampScanner(t *testing.T) {
+	const uuid = "11111111-1111-1111-1111-111111111111"
+	sid := bytes.Repeat([]byte{0x11}, 16)
+	scan := func(file BinlogFile, target uint32, events []*replication.BinlogEvent) (Position, bool) {
+		scanner, err := newTimestampScanner(FlavorMySQL, file, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ev := range events {
+			pos, done, found, err := scanner.next(ev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if done {
+				return pos, found
+			}
+		}
+		t.Fatal("scan not done")
+		return Position{}, false
+	}
+
+	file := BinlogFile{Name: "binlog.000002"}
+	gtidEvents := []*replication.BinlogEvent{
+		scanEvent(0, 0, 0, replication.ROTATE_EVENT, &replication.RotateEvent{}),
+		scanEvent(100, 120, 100, replication.FORMAT_DESCRIPTION_EVENT, &replication.FormatDescriptionEvent{}),
+		scanEvent(100, 190, 70, replication.PREVIOUS_GTIDS_EVENT, &replication.PreviousGTIDsEvent{GTIDSets: uuid + ":1-5"}),
+		scanEvent(100, 200, 10, replication.GTID_EVENT, &replication.GTIDEvent{SID: sid, GNO: 6}),
+		scanEvent(100, 250, 50, replication.QUERY_EVENT, &replication.QueryEvent{Query: []byte("BEGIN")}),
+		scanEvent(100, 280, 30, replication.XID_EVENT, &replication.XIDEvent{}),
+		scanEvent(150, 300, 20, replication.GTID_EVENT, &replication.GTIDEvent{SID: sid, GNO: 7}),
+	}
+	pos, found := scan(file, 120, gtidEvents)
+	if !found || pos.BinLogFilePos != 280 || pos.BinlogGTID != uuid+":1-6" {
+		t.Fatalf("gtid scan: %+v %v", pos, found)
+	}
+	// 第一个事务的时间等于 target 时从该事务开始
+	pos, found = scan(file, 100, gtidEvents)
+	if !found || pos.BinLogFilePos != 190 || pos.BinlogGTID != uuid+":1-5" {
+		t.Fatalf("gtid scan boundary: %+v %v", pos, found)
+	}
+
+	// 没有 gtid 时以 BEGIN 为事务开始，事务内的事件不是边界
+	pos, found = scan(file, 120, []*replication.BinlogEvent{
+		scanEvent(100, 200, 20, replication.QUERY_EVENT, &replication.QueryEvent{Query: []byte("BEGIN")}),
+		scanEvent(130, 250, 50, replication.QUERY_EVENT, &replication.QueryEvent{Query: []byte("INSERT INTO t VALUES (1)")}),
+		scanEvent(130, 280, 30, replication.XID_EVENT, &replication.XIDEvent{}),
+		scanEvent(140, 300, 20, replication.QUERY_EVENT, &replication.QueryEvent{Query: []byte("BEGIN")}),
+	})
+	if !found || pos.BinLogFilePos != 280 {
+		t.Fatalf("query scan: %+v %v", pos, found)
+	}
+
+	// 文件内没有更晚的事务时返回文件末尾
+	pos, found = scan(file, 1000, []*replication.BinlogEvent{
+		scanEvent(100, 200, 10, replication.GTID_EVENT, &replication.GTIDEvent{SID: sid, GNO: 1}),
+		scanEvent(100, 250, 50, replication.XID_EVENT, &replication.XIDEvent{}),
+		scanEvent(100, 300, 50, replication.ROTATE_EVENT, &replication.RotateEvent{}),
+	})
+	if found || pos.BinLogFilePos != 250 || pos.BinlogGTID != uuid+":1" {
+		t.Fatalf("rotate: %+v %v", pos, found)
+	}
+	pos, found = scan(BinlogFile{Name: "binlog.000003", Size: 250}, 1000, []*replication.BinlogEvent{
+		scanEvent(100, 200, 10, replication.GTID_EVENT, &replication.GTIDEvent{SID: sid, GNO: 2}),
+		scanEvent(100, 250, 50, replication.XID_EVENT, &replication.XIDEvent{}),
+	})
+	if found || pos.BinLogFileName != "binlog.000003" || pos.BinLogFilePos != 250 {
+		t.Fatalf("current file: %+v %v", pos, found)
+	}
+}
@@ -3,6 +3,8 @@ package binlog
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/xuenqlve/common/errors"
@@ -17,10 +19,21 @@ type StartBinlogTool struct {
 	conn *sql.DB
 }
 
-func (s *StartBinlogTool) CheckBinlogFormat() error {
-	rows, err := s.conn.Query(`SHOW GLOBAL VARIABLES LIKE "binlog_format";`)
+// GlobalVariables 查询全局变量，不存在的变量不会出现在结果中
+func (s *StartBinlogTool) GlobalVariables(names ...string) (map[string]string, error) {
+	variables := make(map[string]string, len(names))
+	if len(names) == 0 {
+		return variables, nil
+	}
+	placeholders := make([]string, 0, len(names))
+	args := make([]any, 0, len(names))
+	for _, name := range names {
+		placeholders = append(placeholders, "?")
+		args = append(args, name)
+	}
+	rows, err := s.conn.Query(fmt.Sprintf("SHOW GLOBAL VARIABLES WHERE Variable_name IN (%s)", strings.Join(placeholders, ",")), args...)
 	if err != nil {
-		return errors.Trace(err)
+		return nil, errors.Trace(err)
 	}
 	defer func() {
 		if err = rows.Close(); err != nil {
@@ -41,134 +54,143 @@ func (s *StartBinlogTool) CheckBinlogFormat() error {
 			variable string
 			value    string
 		)
-		err = rows.Scan(&variable, &value)
-
-		if err != nil {
-			return errors.Trace(err)
-		}
-
-		if variable == "binlog_format" && value != "ROW" {
-			err = fmt.Errorf("binlog_format is not 'ROW': %v", value)
-			return err
+		if err = rows.Scan(&variable, &value); err != nil {
+			return nil, errors.Trace(err)
 		}
-	}
-
-	if rows.Err() != nil {
-		return errors.Trace(rows.Err())
+		variables[variable] = value
 	}
 	if err = rows.Err(); err != nil {
-		return errors.Trace(err)
+		return nil, errors.Trace(err)
 	}
-	// make sure binlog_row_image is FULL
-	binlogRowImageRows, err := s.conn.Query(`SHOW GLOBAL VARIABLES LIKE 'binlog_row_image';`)
+	return variables, nil
+}
+
+func (s *StartBinlogTool) CheckBinlogFormat() error {
+	variables, err := s.GlobalVariables("binlog_format", "binlog_row_image")
 	if err != nil {
 		return errors.Trace(err)
 	}
-	defer func() {
-		if err = binlogRowImageRows.Close(); err != nil {
-			log.Warnf("failed to close rows: %s", err.Error())
-		}
-	}()
-
-	for binlogRowImageRows.Next() {
-		var (
-			variable string
-			value    string
-		)
-
-		err = binlogRowImageRows.Scan(&variable, &value)
-		if err != nil {
-			return errors.Trace(err)
-		}
-
-		if variable == "binlog_row_image" && value != "FULL" {
-			err = fmt.Errorf("binlog_row_image is not 'FULL' : %v", value)
-			return err
-		}
+	if value, ok := variables["binlog_format"]; ok && value != "ROW" {
+		return fmt.Errorf("binlog_format is not 'ROW': %v", value)
 	}
-
-	if binlogRowImageRows.Err() != nil {
-		return errors.Trace(binlogRowImageRows.Err())
+	// make sure binlog_row_image is FULL
+	if value, ok := variables["binlog_row_image"]; ok && value != "FULL" {
+		return fmt.Errorf("binlog_row_image is not 'FULL' : %v", value)
 	}
-
 	return nil
 }
 
 func (s *StartBinlogTool) CheckBinlogSQLLog() error {
-	binlogRowsQueryLogEvent, err := s.conn.Query(`SHOW GLOBAL VARIABLES LIKE 'binlog_rows_query_log_events';`)
+	variables, err := s.GlobalVariables("binlog_rows_query_log_events")
 	if err != nil {
 		return errors.Trace(err)
 	}
-	defer func() {
-		if err = binlogRowsQueryLogEvent.Close(); err != nil {
-			log.Warnf("failed to close rows:%s", err.Error())
+	if value, ok := variables["binlog_rows_query_log_events"]; ok && value != "ON" {
+		return fmt.Errorf("binlog_rows_query_log_events is not 'ON' : %v", value)
+	}
+	return nil
+}
+
+func (s *StartBinlogTool) GetMasterStatus() (mysql.Position, mysql.MysqlGTIDSet, error) {
+	var gs mysql.MysqlGTIDSet
+	binlogPos, gtidSet, err := s.GetMasterStatusByFlavor(FlavorMySQL)
+	if err != nil {
+		return binlogPos, gs, errors.Trace(err)
+	}
+	return binlogPos, *(gtidSet.(*mysql.MysqlGTIDSet)), nil
+}
+
+// GetMasterStatusByFlavor MySQL 8.4 移除了 SHOW MASTER STATUS，优先使用 SHOW BINARY LOG STATUS；
+// MariaDB 的 gtid 从 gtid_binlog_pos 获取
+func (s *StartBinlogTool) GetMasterStatusByFlavor(flavor string) (mysql.Position, mysql.GTIDSet, error) {
+	var (
+		binlogPos mysql.Position
+		gtid      string
+		err       error
+	)
+	if syncerFlavor(flavor) == mysql.MariaDBFlavor {
+		binlogPos, _, err = s.queryBinlogStatus(`SHOW MASTER STATUS`)
+		if err != nil {
+			return binlogPos, nil, errors.Trace(err)
 		}
-	}()
-	for binlogRowsQueryLogEvent.Next() {
-		var (
-			variable string
-			value    string
-		)
-		err = binlogRowsQueryLogEvent.Scan(&variable, &value)
+		if err = s.conn.QueryRow(`SELECT @@GLOBAL.gtid_binlog_pos`).Scan(&gtid); err != nil {
+			return binlogPos, nil, errors.Trace(err)
+		}
+	} else {
+		binlogPos, gtid, err = s.queryBinlogStatus(`SHOW BINARY LOG STATUS`)
 		if err != nil {
-			return errors.Trace(err)
+			log.Infof("SHOW BINARY LOG STATUS err: %v, fallback to SHOW MASTER STATUS", err)
+			binlogPos, gtid, err = s.queryBinlogStatus(`SHOW MASTER STATUS`)
 		}
-		if variable == "binlog_rows_query_log_events" && value != "ON" {
-			err = fmt.Errorf("binlog_row_image is not 'ON' : %v", value)
-			return err
+		if err != nil {
+			return binlogPos, nil, errors.Trace(err)
 		}
 	}
-	if binlogRowsQueryLogEvent.Err() != nil {
-		return errors.Trace(binlogRowsQueryLogEvent.Err())
+	gtidSet, err := mysql.ParseGTIDSet(syncerFlavor(flavor), gtid)
+	if err != nil {
+		return binlogPos, nil, errors.Trace(err)
 	}
-	return nil
+	return binlogPos, gtidSet, nil
 }
 
-func (s *StartBinlogTool) GetMasterStatus() (mysql.Position, mysql.MysqlGTIDSet, error) {
+func (s *StartBinlogTool) queryBinlogStatus(query string) (mysql.Position, string, error) {
 	var (
 		binlogPos mysql.Position
-		gs        mysql.MysqlGTIDSet
+		gtid      string
 	)
-	rows, err := s.conn.Query(`SHOW MASTER STATUS`)
+	rows, err := s.conn.Query(query)
+	if err != nil {
+		return binlogPos, gtid, errors.Trace(err)
+	}
 	defer func() {
 		if err = rows.Close(); err != nil {
 			log.Warnf("failed to close rows: %s", err.Error())
 		}
 	}()
-	if err != nil {
-		return binlogPos, gs, errors.Trace(err)
-	}
 
 	rowColumns, err := rows.Columns()
 	if err != nil {
-		return binlogPos, gs, errors.Trace(err)
+		return binlogPos, gtid, errors.Trace(err)
 	}
-
-	var (
-		gtid       string
-		binlogName string
-		pos        uint32
-		nullPtr    interface{}
-	)
+	// Show an example.
+	/*
+		mysql> SHOW BINARY LOG STATUS;
+		+---------------+----------+--------------+------------------+-------------------------------------------+
+		| File          | Position | Binlog_Do_DB | Binlog_Ignore_DB | Executed_Gtid_Set                         |
+		+---------------+----------+--------------+------------------+-------------------------------------------+
+		| binlog.000003 |      157 |              |                  | 5b5f3a4c-0d8e-11ef-9a7e-0242ac110002:1-20 |
+		+---------------+----------+--------------+------------------+-------------------------------------------+
+	*/
 	for rows.Next() {
-		if len(rowColumns) == 5 {
-			err = rows.Scan(&binlogName, &pos, &nullPtr, &nullPtr, &gtid)
-		} else {
-			err = rows.Scan(&binlogName, &pos, &nullPtr, &nullPtr)
+		values := make([]sql.NullString, len(rowColumns))
+		dest := make([]any, len(rowColumns))
+		for i := range values {
+			dest[i] = &values[i]
 		}
-		if err != nil {
-			return binlogPos, gs, errors.Trace(err)
+		if err = rows.Scan(dest...); err != nil {
+			return binlogPos, gtid, errors.Trace(err)
 		}
-
-		binlogPos = mysql.Position{Name: binlogName, Pos: pos}
-		generalGTIDSet, err := mysql.ParseMysqlGTIDSet(gtid)
-		if err != nil {
-			return binlogPos, gs, errors.Trace(err)
+		for i, column := range rowColumns {
+			switch column {
+			case "File":
+				binlogPos.Name = values[i].String
+			case "Position":
+				pos, err := strconv.ParseUint(values[i].String, 10, 32)
+				if err != nil {
+					return binlogPos, gtid, errors.Trace(err)
+				}
+				binlogPos.Pos = uint32(pos)
+			case "Executed_Gtid_Set":
+				// 多行 gtid 会带换行
+				gtid = strings.ReplaceAll(values[i].String, "\n", "")
+			}
 		}
-		gs = *(generalGTIDSet.(*mysql.MysqlGTIDSet))
 	}
-	if rows.Err() != nil {
-		return binlogPos, gs, errors.Trace(rows.Err())
+	if err = rows.Err(); err != nil {
+		return binlogPos, gtid, errors.Trace(err)
+	}
+	if binlogPos.Name == "" {
+		return binlogPos, gtid, fmt.Errorf("%s returned no binlog file, check log_bin is enabled", query)
 	}
-	return binlogPos, gs, nil
+	return binlogPos, gtid, nil
 }
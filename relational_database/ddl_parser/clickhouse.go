@@ -0,0 +1,396 @@
+package ddl_parser
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	pmysql "github.com/pingcap/tidb/pkg/parser/mysql"
+	"github.com/pingcap/tidb/pkg/parser/types"
+	"github.com/xuenqlve/common/ddl_parser"
+	"github.com/xuenqlve/common/schema_store"
+)
+
+// DefaultClickHouseVersionColumn ReplacingMergeTree 的版本列，写入时使用 binlog 位点或提交时间递增
+const DefaultClickHouseVersionColumn = "_version"
+
+func init() {
+	ddl_parser.GlobalTransformer.RegisterTransformer(ddl_parser.DatabaseMySQL, ddl_parser.DatabaseClickHouse, NewClickHouseTransformer(DefaultClickHouseVersionColumn))
+}
+
+// ClickHouseStatement 转换后的 ClickHouse DDL，GenerateSQL 返回 []string，按顺序执行
+type ClickHouseStatement struct {
+	ddlType  schema_store.DDL
+	metadata ddl_parser.Metadata
+	sqls     []string
+}
+
+func (s *ClickHouseStatement) DDLType() schema_store.DDL {
+	return s.ddlType
+}
+
+// SubmitModification 库表列的改写需要在转换前作用于 MySQL 语句
+func (s *ClickHouseStatement) SubmitModification(event int, parameter any) {}
+
+func (s *ClickHouseStatement) Metadata() ddl_parser.Metadata {
+	return s.metadata
+}
+
+func (s *ClickHouseStatement) GenerateSQL() (any, error) {
+	return s.sqls, nil
+}
+
+// ClickHouseTransformer MySQL DDL 转换为 ClickHouse DDL，建表使用 ReplacingMergeTree(versionColumn)，
+// 按主键排序；索引、约束、分区、视图等无法对应的操作返回 SkippedError。
+// 排序键列不能是 Nullable，转换器记录建过的表的排序键，同步开始前已存在的表通过 SetSortingKey 设置
+type ClickHouseTransformer struct {
+	versionColumn string
+	// parser 不是并发安全的
+	mu     sync.Mutex
+	parser *parser.Parser
+
+	keyMu sync.Mutex
+	// db.table -> 排序键列，均为小写
+	sortingKeys map[string]map[string]struct{}
+}
+
+func NewClickHouseTransformer(versionColumn string) *ClickHouseTransformer {
+	if versionColumn == "" {
+		versionColumn = DefaultClickHouseVersionColumn
+	}
+	return &ClickHouseTransformer{
+		versionColumn: versionColumn,
+		parser:        parser.New(),
+		sortingKeys:   make(map[string]map[string]struct{}),
+	}
+}
+
+// SetSortingKey 设置已存在的表的排序键列，MODIFY/CHANGE COLUMN 时这些列不使用 Nullable
+func (t *ClickHouseTransformer) SetSortingKey(database, table string, columns ...string) {
+	keys := make(map[string]struct{}, len(columns))
+	for _, column := range columns {
+		keys[strings.ToLower(column)] = struct{}{}
+	}
+	t.keyMu.Lock()
+	defer t.keyMu.Unlock()
+	t.sortingKeys[sortingKeyTable(database, table)] = keys
+}
+
+func (t *ClickHouseTransformer) isSortingKey(database, table, column string) bool {
+	t.keyMu.Lock()
+	defer t.keyMu.Unlock()
+	_, ok := t.sortingKeys[sortingKeyTable(database, table)][strings.ToLower(column)]
+	return ok
+}
+
+func (t *ClickHouseTransformer) renameSortingKeyTable(database, table, renameDatabase, renameTable string) {
+	t.keyMu.Lock()
+	defer t.keyMu.Unlock()
+	name := sortingKeyTable(database, table)
+	if keys, ok := t.sortingKeys[name]; ok {
+		delete(t.sortingKeys, name)
+		t.sortingKeys[sortingKeyTable(renameDatabase, renameTable)] = keys
+	}
+}
+
+func (t *ClickHouseTransformer) renameSortingKeyColumn(database, table, column, newColumn string) {
+	t.keyMu.Lock()
+	defer t.keyMu.Unlock()
+	keys := t.sortingKeys[sortingKeyTable(database, table)]
+	if _, ok := keys[strings.ToLower(column)]; ok {
+		delete(keys, strings.ToLower(column))
+		keys[strings.ToLower(newColumn)] = struct{}{}
+	}
+}
+
+func (t *ClickHouseTransformer) dropSortingKeys(database, table string) {
+	t.keyMu.Lock()
+	defer t.keyMu.Unlock()
+	if table != "" {
+		delete(t.sortingKeys, sortingKeyTable(database, table))
+		return
+	}
+	prefix := sortingKeyTable(database, "")
+	for name := range t.sortingKeys {
+		if strings.HasPrefix(name, prefix) {
+			delete(t.sortingKeys, name)
+		}
+	}
+}
+
+func sortingKeyTable(database, table string) string {
+	return strings.ToLower(database) + "." + strings.ToLower(table)
+}
+
+func (t *ClickHouseTransformer) Transformer(src ddl_parser.Statement) (bool, ddl_parser.Statement, error) {
+	// 先生成 MySQL SQL，使库表列的改写生效后重新解析
+	value, err := src.GenerateSQL()
+	if err != nil {
+		return false, nil, err
+	}
+	query, ok := value.(string)
+	if !ok {
+		return false, nil, fmt.Errorf("clickhouse transformer unsupported statement sql: %v", value)
+	}
+	t.mu.Lock()
+	node, err := t.parser.ParseOneStmt(query, "", "")
+	t.mu.Unlock()
+	if err != nil {
+		return false, nil, fmt.Errorf("clickhouse transformer parse sql:%s err: %s", query, err.Error())
+	}
+	md := src.Metadata()
+	var sqls []string
+	switch v := node.(type) {
+	case *ast.CreateDatabaseStmt:
+		sqls = []string{fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", clickHouseName(v.Name.String()))}
+	case *ast.DropDatabaseStmt:
+		sqls = []string{fmt.Sprintf("DROP DATABASE IF EXISTS %s", clickHouseName(v.Name.String()))}
+		t.dropSortingKeys(v.Name.String(), "")
+	case *ast.CreateTableStmt:
+		sqls, err = t.createTable(src.DDLType(), md, v)
+	case *ast.DropTableStmt:
+		if v.IsView {
+			return false, nil, ddl_parser.NewSkippedError(src.DDLType(), "view is not supported")
+		}
+		sqls = []string{fmt.Sprintf("DROP TABLE IF EXISTS %s", clickHouseTable(md.Database, md.Table))}
+		t.dropSortingKeys(md.Database, md.Table)
+	case *ast.TruncateTableStmt:
+		sqls = []string{fmt.Sprintf("TRUNCATE TABLE IF EXISTS %s", clickHouseTable(md.Database, md.Table))}
+	case *ast.RenameTableStmt:
+		sqls = []string{fmt.Sprintf("RENAME TABLE %s TO %s", clickHouseTable(md.Database, md.Table), clickHouseTable(md.RenameDatabase, md.RenameTable))}
+		t.renameSortingKeyTable(md.Database, md.Table, md.RenameDatabase, md.RenameTable)
+	case *ast.AlterTableStmt:
+		sqls, err = t.alterTable(src.DDLType(), md, v)
+	default:
+		return false, nil, ddl_parser.NewSkippedError(src.DDLType(), "%T is not supported", node)
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	return true, &ClickHouseStatement{ddlType: src.DDLType(), metadata: md, sqls: sqls}, nil
+}
+
+func (t *ClickHouseTransformer) createTable(ddlType schema_store.DDL, md ddl_parser.Metadata, stmt *ast.CreateTableStmt) ([]string, error) {
+	table := clickHouseTable(md.Database, md.Table)
+	if stmt.ReferTable != nil {
+		referDatabase, referTable := stmt.ReferTable.Schema.String(), stmt.ReferTable.Name.String()
+		if referDatabase == "" {
+			referDatabase = md.Database
+		}
+		t.keyMu.Lock()
+		if keys, ok := t.sortingKeys[sortingKeyTable(referDatabase, referTable)]; ok {
+			t.sortingKeys[sortingKeyTable(md.Database, md.Table)] = keys
+		}
+		t.keyMu.Unlock()
+		refer := clickHouseTable(referDatabase, referTable)
+		return []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s AS %s", table, refer)}, nil
+	}
+	if stmt.Select != nil {
+		return nil, ddl_parser.NewSkippedError(ddlType, "create table select is not supported")
+	}
+	primaryKeys := make([]string, 0)
+	for _, constraint := range stmt.Constraints {
+		if constraint.Tp != ast.ConstraintPrimaryKey {
+			continue
+		}
+		for _, key := range constraint.Keys {
+			if key.Column != nil {
+				primaryKeys = append(primaryKeys, key.Column.Name.String())
+			}
+		}
+	}
+	for _, col := range stmt.Cols {
+		if hasColumnOption(col, ast.ColumnOptionPrimaryKey) {
+			primaryKeys = append(primaryKeys, col.Name.String())
+		}
+	}
+	keys := make(map[string]struct{}, len(primaryKeys))
+	for _, key := range primaryKeys {
+		keys[strings.ToLower(key)] = struct{}{}
+	}
+
+	definitions := make([]string, 0, len(stmt.Cols)+1)
+	for _, col := range stmt.Cols {
+		_, primary := keys[strings.ToLower(col.Name.String())]
+		definitions = append(definitions, "  "+t.columnDefinition(col, primary))
+	}
+	definitions = append(definitions, fmt.Sprintf("  %s UInt64", clickHouseName(t.versionColumn)))
+
+	orderBy := "tuple()"
+	if len(primaryKeys) > 0 {
+		names := make([]string, 0, len(primaryKeys))
+		for _, key := range primaryKeys {
+			names = append(names, clickHouseName(key))
+		}
+		orderBy = fmt.Sprintf("(%s)", strings.Join(names, ", "))
+	}
+	t.SetSortingKey(md.Database, md.Table, primaryKeys...)
+	sql := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n%s\n) ENGINE = ReplacingMergeTree(%s)\nORDER BY %s",
+		table, strings.Join(definitions, ",\n"), clickHouseName(t.versionColumn), orderBy)
+	if comment := tableComment(stmt.Options); comment != "" {
+		sql += "\nCOMMENT " + clickHouseString(comment)
+	}
+	return []string{sql}, nil
+}
+
+func (t *ClickHouseTransformer) alterTable(ddlType schema_store.DDL, md ddl_parser.Metadata, stmt *ast.AlterTableStmt) ([]string, error) {
+	table := clickHouseTable(md.Database, md.Table)
+	sqls := make([]string, 0, len(stmt.Specs))
+	for _, spec := range stmt.Specs {
+		switch spec.Tp {
+		case ast.AlterTableAddColumns:
+			actions := make([]string, 0, len(spec.NewColumns))
+			for _, col := range spec.NewColumns {
+				action := "ADD COLUMN IF NOT EXISTS " + t.columnDefinition(col, false)
+				if spec.Position != nil {
+					switch spec.Position.Tp {
+					case ast.ColumnPositionFirst:
+						action += " FIRST"
+					case ast.ColumnPositionAfter:
+						action += " AFTER " + clickHouseName(spec.Position.RelativeColumn.Name.String())
+					}
+				}
+				actions = append(actions, action)
+			}
+			sqls = append(sqls, fmt.Sprintf("ALTER TABLE %s %s", table, strings.Join(actions, ", ")))
+		case ast.AlterTableDropColumn:
+			sqls = append(sqls, fmt.Sprintf("ALTER TABLE %s DROP COLUMN IF EXISTS %s", table, clickHouseName(spec.OldColumnName.Name.String())))
+		case ast.AlterTableModifyColumn:
+			for _, col := range spec.NewColumns {
+				key := t.isSortingKey(md.Database, md.Table, col.Name.String())
+				sqls = append(sqls, fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s", table, t.columnDefinition(col, key)))
+			}
+		case ast.AlterTableChangeColumn:
+			// 同一条 ALTER 中不能同时重命名和修改同一列，拆成两条
+			oldName := spec.OldColumnName.Name.String()
+			for _, col := range spec.NewColumns {
+				key := t.isSortingKey(md.Database, md.Table, oldName)
+				if !strings.EqualFold(oldName, col.Name.String()) {
+					sqls = append(sqls, fmt.Sprintf("ALTER TABLE %s RENAME COLUMN IF EXISTS %s TO %s", table, clickHouseName(oldName), clickHouseName(col.Name.String())))
+					t.renameSortingKeyColumn(md.Database, md.Table, oldName, col.Name.String())
+				}
+				sqls = append(sqls, fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s", table, t.columnDefinition(col, key)))
+			}
+		case ast.AlterTableRenameColumn:
+			sqls = append(sqls, fmt.Sprintf("ALTER TABLE %s RENAME COLUMN IF EXISTS %s TO %s", table,
+				clickHouseName(spec.OldColumnName.Name.String()), clickHouseName(spec.NewColumnName.Name.String())))
+			t.renameSortingKeyColumn(md.Database, md.Table, spec.OldColumnName.Name.String(), spec.NewColumnName.Name.String())
+		case ast.AlterTableRenameTable:
+			sqls = append(sqls, fmt.Sprintf("RENAME TABLE %s TO %s", table, clickHouseTable(md.RenameDatabase, md.RenameTable)))
+			t.renameSortingKeyTable(md.Database, md.Table, md.RenameDatabase, md.RenameTable)
+		case ast.AlterTableOption:
+			comment := ""
+			for _, option := range spec.Options {
+				if option.Tp != ast.TableOptionComment {
+					return nil, ddl_parser.NewSkippedError(ddlType, "table option is not supported")
+				}
+				comment = option.StrValue
+			}
+			sqls = append(sqls, fmt.Sprintf("ALTER TABLE %s MODIFY COMMENT %s", table, clickHouseString(comment)))
+		case ast.AlterTableAlgorithm, ast.AlterTableLock:
+		default:
+			return nil, ddl_parser.NewSkippedError(ddlType, "alter table spec %d is not supported", spec.Tp)
+		}
+	}
+	if len(sqls) == 0 {
+		return nil, ddl_parser.NewSkippedError(ddlType, "nothing to alter")
+	}
+	return sqls, nil
+}
+
+// columnDefinition 主键列、排序键列及 NOT NULL 列不使用 Nullable
+func (t *ClickHouseTransformer) columnDefinition(col *ast.ColumnDef, primary bool) string {
+	nullable := !primary && !hasColumnOption(col, ast.ColumnOptionPrimaryKey) && !hasColumnOption(col, ast.ColumnOptionNotNull)
+	definition := fmt.Sprintf("%s %s", clickHouseName(col.Name.String()), ClickHouseType(col.Tp, nullable))
+	if comment, ok := columnComment(col); ok {
+		definition += " COMMENT " + clickHouseString(comment)
+	}
+	return definition
+}
+
+// ClickHouseType MySQL 列类型对应的 ClickHouse 类型
+func ClickHouseType(ft *types.FieldType, nullable bool) string {
+	unsigned := pmysql.HasUnsignedFlag(ft.GetFlag())
+	integer := func(bits string) string {
+		if unsigned {
+			return "UInt" + bits
+		}
+		return "Int" + bits
+	}
+	var tp string
+	switch ft.GetType() {
+	case pmysql.TypeTiny:
+		tp = integer("8")
+	case pmysql.TypeShort:
+		tp = integer("16")
+	case pmysql.TypeInt24, pmysql.TypeLong:
+		tp = integer("32")
+	case pmysql.TypeLonglong:
+		tp = integer("64")
+	case pmysql.TypeFloat:
+		tp = "Float32"
+	case pmysql.TypeDouble:
+		tp = "Float64"
+	case pmysql.TypeNewDecimal:
+		precision, scale := ft.GetFlen(), ft.GetDecimal()
+		if precision <= 0 {
+			precision = 10
+		}
+		if scale < 0 {
+			scale = 0
+		}
+		tp = fmt.Sprintf("Decimal(%d, %d)", precision, scale)
+	case pmysql.TypeYear:
+		tp = "UInt16"
+	case pmysql.TypeDate:
+		tp = "Date32"
+	case pmysql.TypeDatetime, pmysql.TypeTimestamp:
+		fsp := ft.GetDecimal()
+		if fsp < 0 {
+			fsp = 0
+		}
+		tp = fmt.Sprintf("DateTime64(%d)", fsp)
+	case pmysql.TypeBit:
+		tp = "UInt64"
+	case pmysql.TypeEnum:
+		// LowCardinality 需要包在 Nullable 外层
+		if nullable {
+			return "LowCardinality(Nullable(String))"
+		}
+		return "LowCardinality(String)"
+	default:
+		// char、varchar、text、blob、json、set、time、geometry
+		tp = "String"
+	}
+	if nullable {
+		return fmt.Sprintf("Nullable(%s)", tp)
+	}
+	return tp
+}
+
+func hasColumnOption(col *ast.ColumnDef, tp ast.ColumnOptionType) bool {
+	for _, option := range col.Options {
+		if option.Tp == tp {
+			return true
+		}
+	}
+	return false
+}
+
+func clickHouseName(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func clickHouseTable(database, table string) string {
+	if database == "" {
+		return clickHouseName(table)
+	}
+	return clickHouseName(database) + "." + clickHouseName(table)
+}
+
+func clickHouseString(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+}
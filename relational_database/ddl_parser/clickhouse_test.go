@@ -0,0 +1,102 @@
+package ddl_parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xuenqlve/common/ddl_parser"
+)
+
+func TestClickHouseTransformer(t *testing.T) {
+	loader := NewPingCapLoader()
+	transform := func(query string) ([]string, error) {
+		stmts, err := loader.Parse(ddl_parser.DDL{Schema: "db", SQL: query})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sqls []string
+		for _, stmt := range stmts {
+			ok, dst, err := ddl_parser.GlobalTransformer.Transform(stmt, ddl_parser.DatabaseMySQL, ddl_parser.DatabaseClickHouse)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				t.Fatalf("%s not transformed", query)
+			}
+			value, _ := dst.GenerateSQL()
+			sqls = append(sqls, value.([]string)...)
+		}
+		return sqls, nil
+	}
+
+	sqls, err := transform("CREATE TABLE orders (id bigint unsigned NOT NULL AUTO_INCREMENT, status enum('new','paid') DEFAULT NULL, amount decimal(12,2) NOT NULL, created_at datetime(3) NOT NULL, note varchar(64) COMMENT 'note', PRIMARY KEY (id)) COMMENT='orders'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"CREATE TABLE IF NOT EXISTS `db`.`orders`",
+		"`id` UInt64,",
+		"`status` LowCardinality(Nullable(String)),",
+		"`amount` Decimal(12, 2),",
+		"`created_at` DateTime64(3),",
+		"`note` Nullable(String) COMMENT 'note',",
+		"`_version` UInt64",
+		"ENGINE = ReplacingMergeTree(`_version`)",
+		"ORDER BY (`id`)",
+		"COMMENT 'orders'",
+	} {
+		if !strings.Contains(sqls[0], expected) {
+			t.Fatalf("create table missing %q:\n%s", expected, sqls[0])
+		}
+	}
+
+	sqls, err = transform("ALTER TABLE orders ADD COLUMN paid_at timestamp NULL AFTER amount, DROP COLUMN note, MODIFY COLUMN amount decimal(14,2) NOT NULL, CHANGE status state varchar(16), RENAME COLUMN created_at TO create_time")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"ALTER TABLE `db`.`orders` ADD COLUMN IF NOT EXISTS `paid_at` Nullable(DateTime64(0)) AFTER `amount`",
+		"ALTER TABLE `db`.`orders` DROP COLUMN IF EXISTS `note`",
+		"ALTER TABLE `db`.`orders` MODIFY COLUMN `amount` Decimal(14, 2)",
+		"ALTER TABLE `db`.`orders` RENAME COLUMN IF EXISTS `status` TO `state`",
+		"ALTER TABLE `db`.`orders` MODIFY COLUMN `state` Nullable(String)",
+		"ALTER TABLE `db`.`orders` RENAME COLUMN IF EXISTS `created_at` TO `create_time`",
+	}
+	if strings.Join(sqls, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("alter table:\n%s", strings.Join(sqls, "\n"))
+	}
+
+	// 排序键列不能是 Nullable，重命名后仍然是排序键
+	sqls, err = transform("ALTER TABLE orders MODIFY COLUMN id bigint unsigned, CHANGE id order_id bigint unsigned, MODIFY amount decimal(16,2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{
+		"ALTER TABLE `db`.`orders` MODIFY COLUMN `id` UInt64",
+		"ALTER TABLE `db`.`orders` RENAME COLUMN IF EXISTS `id` TO `order_id`",
+		"ALTER TABLE `db`.`orders` MODIFY COLUMN `order_id` UInt64",
+		"ALTER TABLE `db`.`orders` MODIFY COLUMN `amount` Nullable(Decimal(16, 2))",
+	}
+	if strings.Join(sqls, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("alter sorting key:\n%s", strings.Join(sqls, "\n"))
+	}
+	sqls, err = transform("ALTER TABLE orders RENAME TO orders_v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sqls, err = transform("ALTER TABLE orders_v2 MODIFY order_id int"); err != nil || sqls[0] != "ALTER TABLE `db`.`orders_v2` MODIFY COLUMN `order_id` Int32" {
+		t.Fatalf("alter renamed table: %v %v", sqls, err)
+	}
+	transformer := NewClickHouseTransformer("")
+	transformer.SetSortingKey("db", "users", "ID")
+	if !transformer.isSortingKey("DB", "users", "id") || transformer.isSortingKey("db", "users", "name") {
+		t.Fatal("set sorting key")
+	}
+
+	if _, err = transform("ALTER TABLE orders ADD INDEX idx_state (state)"); !ddl_parser.IsSkipped(err) {
+		t.Fatalf("add index should be skipped, err: %v", err)
+	}
+	if _, err = transform("CREATE VIEW v AS SELECT id FROM orders"); !ddl_parser.IsSkipped(err) {
+		t.Fatalf("create view should be skipped, err: %v", err)
+	}
+}
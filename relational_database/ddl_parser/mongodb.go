@@ -0,0 +1,183 @@
+package ddl_parser
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/xuenqlve/common/ddl_parser"
+	"github.com/xuenqlve/common/schema_store"
+	sql_tool "github.com/xuenqlve/common/sql"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func init() {
+	ddl_parser.GlobalTransformer.RegisterTransformer(ddl_parser.DatabaseMongoDB, ddl_parser.DatabaseMySQL, NewMongoDBTransformer(nil))
+}
+
+// MongoColumnMapping 集合字段到表列的映射，key 为 database.collection，value 为 field -> column；
+// 没有配置的集合字段名即列名
+type MongoColumnMapping map[string]map[string]string
+
+// Column 返回字段对应的列，配置了映射的集合只接受映射中的字段，嵌套字段必须配置映射
+func (m MongoColumnMapping) Column(database, collection, field string) (string, bool) {
+	if columns, ok := m[database+"."+collection]; ok {
+		column, ok := columns[field]
+		return column, ok
+	}
+	if strings.Contains(field, ".") {
+		return "", false
+	}
+	return field, true
+}
+
+// MongoDBTransformer MongoDB 的索引及集合 DDL 转换为 MySQL 语句，
+// createIndexes/dropIndexes 转为 CREATE/DROP INDEX，renameCollection、drop、dropDatabase 转为对应的表、库操作；
+// 返回的语句由 PingCapLoader 解析，可以继续使用 Modify 等改写后 GenerateSQL
+type MongoDBTransformer struct {
+	mapping MongoColumnMapping
+	mu      sync.Mutex
+	loader  PingCapLoader
+}
+
+// NewMongoDBTransformer 替换默认注册的转换器时使用：
+// ddl_parser.GlobalTransformer.RegisterTransformer(ddl_parser.DatabaseMongoDB, ddl_parser.DatabaseMySQL, NewMongoDBTransformer(mapping))
+func NewMongoDBTransformer(mapping MongoColumnMapping) *MongoDBTransformer {
+	return &MongoDBTransformer{
+		mapping: mapping,
+		loader:  NewPingCapLoader(),
+	}
+}
+
+func (t *MongoDBTransformer) Transformer(src ddl_parser.Statement) (bool, ddl_parser.Statement, error) {
+	md := src.Metadata()
+	var sql string
+	switch src.DDLType() {
+	case schema_store.Create_Indexes:
+		s, ok := src.(*ddl_parser.TableConstraintsStatement)
+		if !ok {
+			return false, nil, ddl_parser.NewSkippedError(src.DDLType(), "%T is not supported", src)
+		}
+		var err error
+		if sql, err = t.createIndex(s); err != nil {
+			return false, nil, err
+		}
+	case schema_store.Drop_Indexes:
+		s, ok := src.(*ddl_parser.TableConstraintsStatement)
+		if !ok {
+			return false, nil, ddl_parser.NewSkippedError(src.DDLType(), "%T is not supported", src)
+		}
+		name, _ := s.IndexColumns()
+		if name == "" || name == "*" || name == "_id_" {
+			return false, nil, ddl_parser.NewSkippedError(src.DDLType(), "drop index %s is not supported", name)
+		}
+		sql = fmt.Sprintf("DROP INDEX %s ON %s", sql_tool.ColumnName(name), sql_tool.GenerateTableName(s.Database(), s.Table()))
+	case schema_store.Rename:
+		s, ok := src.(*ddl_parser.RenameTableStatement)
+		if !ok {
+			return false, nil, ddl_parser.NewSkippedError(src.DDLType(), "%T is not supported", src)
+		}
+		oldDatabase, oldTable := s.OldTable()
+		newDatabase, newTable := s.NewTable()
+		sql = fmt.Sprintf("RENAME TABLE %s TO %s", sql_tool.GenerateTableName(oldDatabase, oldTable), sql_tool.GenerateTableName(newDatabase, newTable))
+	case schema_store.Drop:
+		s, ok := src.(*ddl_parser.TableStatement)
+		if !ok {
+			return false, nil, ddl_parser.NewSkippedError(src.DDLType(), "%T is not supported", src)
+		}
+		sql = fmt.Sprintf("DROP TABLE IF EXISTS %s", sql_tool.GenerateTableName(s.Database(), s.Table()))
+	case schema_store.Drop_Database:
+		s, ok := src.(*ddl_parser.DatabaseStatement)
+		if !ok {
+			return false, nil, ddl_parser.NewSkippedError(src.DDLType(), "%T is not supported", src)
+		}
+		sql = fmt.Sprintf("DROP DATABASE IF EXISTS %s", sql_tool.ColumnName(s.Database()))
+	default:
+		return false, nil, ddl_parser.NewSkippedError(src.DDLType(), "%s.%s is not supported by mysql", md.Database, md.Table)
+	}
+
+	t.mu.Lock()
+	stmts, err := t.loader.Parse(ddl_parser.DDL{Schema: md.Database, SQL: sql})
+	t.mu.Unlock()
+	if err != nil {
+		return false, nil, err
+	}
+	if len(stmts) != 1 {
+		return false, nil, fmt.Errorf("mongodb transformer sql:%s got %d statements", sql, len(stmts))
+	}
+	return true, stmts[0], nil
+}
+
+func (t *MongoDBTransformer) createIndex(s *ddl_parser.TableConstraintsStatement) (string, error) {
+	name, fields := s.IndexColumns()
+	if name == "_id_" {
+		return "", ddl_parser.NewSkippedError(s.DDLType(), "_id index is the primary key")
+	}
+	directions := indexDirections(s)
+	columns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		column, ok := t.mapping.Column(s.Database(), s.Table(), field)
+		if !ok {
+			return "", ddl_parser.NewSkippedError(s.DDLType(), "index %s field %s has no column mapping", name, field)
+		}
+		switch direction := directions[field].(type) {
+		case string:
+			// text、2dsphere、hashed 等特殊索引
+			return "", ddl_parser.NewSkippedError(s.DDLType(), "index %s %s type %s is not supported", name, field, direction)
+		case nil:
+			columns = append(columns, sql_tool.ColumnName(column))
+		default:
+			if fmt.Sprint(direction) == "-1" {
+				columns = append(columns, sql_tool.ColumnName(column)+" DESC")
+			} else {
+				columns = append(columns, sql_tool.ColumnName(column))
+			}
+		}
+	}
+	if len(columns) == 0 {
+		return "", ddl_parser.NewSkippedError(s.DDLType(), "index %s has no field", name)
+	}
+	unique := ""
+	if s.IndexType() == ddl_parser.IndexTypeUnique {
+		unique = "UNIQUE "
+	}
+	return fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)", unique, sql_tool.ColumnName(name), sql_tool.GenerateTableName(s.Database(), s.Table()), strings.Join(columns, ", ")), nil
+}
+
+// indexDirections 从 createIndexes 命令中读取字段的排序方向或索引类型
+func indexDirections(s *ddl_parser.TableConstraintsStatement) map[string]any {
+	directions := make(map[string]any)
+	value, err := s.GenerateSQL()
+	if err != nil {
+		return directions
+	}
+	command, ok := value.(bson.D)
+	if !ok {
+		return directions
+	}
+	var collect func(doc bson.D)
+	collect = func(doc bson.D) {
+		for _, e := range doc {
+			switch v := e.Value.(type) {
+			case bson.D:
+				if e.Key == "key" {
+					for _, key := range v {
+						directions[key.Key] = key.Value
+					}
+				}
+			case []bson.D:
+				for _, index := range v {
+					collect(index)
+				}
+			case bson.A:
+				for _, item := range v {
+					if index, ok := item.(bson.D); ok {
+						collect(index)
+					}
+				}
+			}
+		}
+	}
+	collect(command)
+	return directions
+}
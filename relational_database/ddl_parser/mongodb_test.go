@@ -0,0 +1,82 @@
+package ddl_parser_test
+
+import (
+	"testing"
+
+	"github.com/xuenqlve/common/ddl_parser"
+	"github.com/xuenqlve/common/nosql/mongodb_schema"
+	mysql_ddl "github.com/xuenqlve/common/relational_database/ddl_parser"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMongoDBTransformer(t *testing.T) {
+	loader := mongodb_schema.NewDDLLoader()
+	transformer := mysql_ddl.NewMongoDBTransformer(mysql_ddl.MongoColumnMapping{
+		"db.users": {"profile.email": "email", "age": "age"},
+	})
+	cases := []struct {
+		command  bson.D
+		expected string
+		skipped  bool
+	}{
+		{
+			command: bson.D{{Key: "createIndexes", Value: "users"}, {Key: "indexes", Value: []bson.D{
+				{{Key: "key", Value: bson.D{{Key: "profile.email", Value: 1}}}, {Key: "name", Value: "uk_email"}, {Key: "unique", Value: true}},
+			}}},
+			expected: "create unique index `uk_email` on `db`.`users` (`email`)",
+		},
+		{
+			command: bson.D{{Key: "createIndexes", Value: "users"}, {Key: "indexes", Value: []bson.D{
+				{{Key: "key", Value: bson.D{{Key: "age", Value: -1}}}, {Key: "name", Value: "age_-1"}},
+			}}},
+			expected: "create index `age_-1` on `db`.`users` (`age` DESC)",
+		},
+		{
+			command: bson.D{{Key: "createIndexes", Value: "users"}, {Key: "indexes", Value: []bson.D{
+				{{Key: "key", Value: bson.D{{Key: "name", Value: 1}}}, {Key: "name", Value: "name_1"}},
+			}}},
+			skipped: true,
+		},
+		{
+			command: bson.D{{Key: "createIndexes", Value: "posts"}, {Key: "indexes", Value: []bson.D{
+				{{Key: "key", Value: bson.D{{Key: "body", Value: "text"}}}, {Key: "name", Value: "body_text"}},
+			}}},
+			skipped: true,
+		},
+		{
+			command:  bson.D{{Key: "dropIndexes", Value: "users"}, {Key: "index", Value: "uk_email"}},
+			expected: "drop index `uk_email` on `db`.`users`",
+		},
+		{
+			command:  bson.D{{Key: "renameCollection", Value: "db.users"}, {Key: "to", Value: "db.members"}},
+			expected: "rename table `db`.`users` to `db`.`members`",
+		},
+		{
+			command:  bson.D{{Key: "drop", Value: "members"}},
+			expected: "drop table if exists `db`.`members`",
+		},
+	}
+	for _, c := range cases {
+		stmts, err := loader.Parse(ddl_parser.DDL{Schema: "db", SQL: c.command})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ok, dst, err := transformer.Transformer(stmts[0])
+		if c.skipped {
+			if ok || !ddl_parser.IsSkipped(err) {
+				t.Fatalf("%v should be skipped, err: %v", c.command, err)
+			}
+			continue
+		}
+		if err != nil || !ok {
+			t.Fatalf("%v: %v", c.command, err)
+		}
+		sql, err := dst.GenerateSQL()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sql != c.expected {
+			t.Fatalf("%v: got %s, expected %s", c.command, sql, c.expected)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package ddl_parser
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/pingcap/tidb/pkg/parser"
 	"github.com/pingcap/tidb/pkg/parser/ast"
@@ -11,6 +12,7 @@ import (
 	"github.com/xuenqlve/common/ddl_parser"
 	"github.com/xuenqlve/common/log"
 	"github.com/xuenqlve/common/schema_store"
+	sql_tool "github.com/xuenqlve/common/sql"
 	"github.com/xuenqlve/common/transform"
 )
 
@@ -29,11 +31,20 @@ func (p *PingCapLoader) Parse(ddl ddl_parser.DDL) ([]ddl_parser.Statement, error
 	if !ok {
 		return nil, fmt.Errorf("sql:%s failed to parse ddl_parser statement", ddl.SQL)
 	}
-	stmt, err := p.parser.ParseOneStmt(sql, "", "")
+	stmtNodes, _, err := p.parser.Parse(sql, "", "")
 	if err != nil {
 		return nil, fmt.Errorf("sql:%s failed to parse ddl_parser statement: %s", ddl.SQL, err.Error())
 	}
-	return p.makeStatement(stmt, ddl)
+	// 一个 QueryEvent 中可能有多条语句
+	stmts := make([]ddl_parser.Statement, 0, len(stmtNodes))
+	for _, stmtNode := range stmtNodes {
+		statements, err := p.makeStatement(stmtNode, ddl)
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, statements...)
+	}
+	return stmts, nil
 }
 
 func (p *PingCapLoader) makeStatement(stmt ast.StmtNode, ddl ddl_parser.DDL) ([]ddl_parser.Statement, error) {
@@ -68,33 +79,97 @@ func (p *PingCapLoader) makeStatement(stmt ast.StmtNode, ddl ddl_parser.DDL) ([]
 			resetDb = true
 		}
 		table := v.Table.Name.String()
+		md := ddl_parser.Metadata{
+			Database: database,
+			Table:    table,
+		}
+		if v.ReferTable != nil {
+			referTable := ddl_parser.Table{
+				Database: v.ReferTable.Schema.String(),
+				Table:    v.ReferTable.Name.String(),
+			}
+			if referTable.Database == "" {
+				referTable.Database = ddl.Schema
+				resetDb = true
+			}
+			return []ddl_parser.Statement{ddl_parser.NewCreateTableLikeStatement(newPingCapStatement(schema_store.CREATE_TABLE_LIKE, v, md), database, resetDb, table, referTable)}, nil
+		}
 		columns := make([]string, 0, len(v.Cols))
+		columnComments := make(map[string]string)
 		for _, col := range v.Cols {
 			columns = append(columns, col.Name.String())
+			if comment, ok := columnComment(col); ok {
+				columnComments[col.Name.String()] = comment
+			}
 		}
 		constraints := make(map[string][]string, len(v.Constraints))
 		indexesType := make(map[string]ddl_parser.IndexType, len(v.Constraints))
 		for _, constraint := range v.Constraints {
 			cols := make([]string, 0, len(constraint.Keys))
 			for _, key := range constraint.Keys {
-				cols = append(cols, key.Column.Name.String())
+				if key.Column != nil {
+					cols = append(cols, key.Column.Name.String())
+				}
 			}
 			name := constraint.Name
 			if constraint.Tp == ast.ConstraintPrimaryKey {
 				name = "PRIMARY"
+			} else if name == "" && isIndexConstraint(constraint.Tp) && len(cols) > 0 {
+				// 与 MySQL 一致，未命名索引使用第一列的列名，重复时增加 _2、_3 后缀
+				name = defaultIndexName(cols[0], constraints)
+				constraint.Name = name
 			}
 			constraints[name] = cols
 			indexesType[name] = getIndexType(constraint.Tp)
 		}
+		// 列定义中的 PRIMARY KEY、UNIQUE
+		for _, col := range v.Cols {
+			for _, option := range col.Options {
+				switch option.Tp {
+				case ast.ColumnOptionPrimaryKey:
+					constraints["PRIMARY"] = []string{col.Name.String()}
+					indexesType["PRIMARY"] = ddl_parser.IndexTypePrimary
+				case ast.ColumnOptionUniqKey:
+					name := defaultIndexName(col.Name.String(), constraints)
+					constraints[name] = []string{col.Name.String()}
+					indexesType[name] = ddl_parser.IndexTypeUnique
+				}
+			}
+		}
+		ddlType := schema_store.CREATE_TABLE
+		if v.Select != nil {
+			ddlType = schema_store.CREATE_TABLE_SELECT
+		}
+		statement := ddl_parser.NewCreateTableColumnStatement(newPingCapStatement(ddlType, v, md), database, resetDb, table, columns, constraints, indexesType)
+		statement.SetComments(tableComment(v.Options), columnComments)
+		return []ddl_parser.Statement{statement}, nil
+	case *ast.CreateViewStmt:
+		database, table := v.ViewName.Schema.String(), v.ViewName.Name.String()
+		resetDb := false
+		if database == "" {
+			database = ddl.Schema
+			resetDb = true
+		}
 		md := ddl_parser.Metadata{
 			Database: database,
 			Table:    table,
 		}
-		return []ddl_parser.Statement{ddl_parser.NewCreateTableColumnStatement(newPingCapStatement(schema_store.CREATE_TABLE, v, md), database, resetDb, table, columns, constraints, indexesType)}, nil
+		return []ddl_parser.Statement{ddl_parser.NewTableStatement(newPingCapStatement(schema_store.CREATE_VIEW, v, md), database, resetDb, table)}, nil
 	case *ast.AlterTableStmt:
-		stmts := make([]ddl_parser.Statement, 0, len(v.Specs))
+		// 多个 spec 拆分成多条语句，ALGORITHM、LOCK 只影响执行方式，单独存在时才保留
+		specs := make([]*ast.AlterTableSpec, 0, len(v.Specs))
+		for _, spec := range v.Specs {
+			if spec.Tp == ast.AlterTableAlgorithm || spec.Tp == ast.AlterTableLock {
+				continue
+			}
+			specs = append(specs, spec)
+		}
+		if len(specs) == 0 {
+			specs = v.Specs
+		}
+		stmts := make([]ddl_parser.Statement, 0, len(specs))
 		s := *v
-		for _, specs := range v.Specs {
+		for _, specs := range specs {
 			sp := *specs
 			stmts = append(stmts, alterTableStatement(s, sp, ddl))
 		}
@@ -181,6 +256,7 @@ func alterTableStatement(stmt ast.AlterTableStmt, alterSpec ast.AlterTableSpec,
 		Database: database,
 		Table:    table,
 	}
+	ddlType := schema_store.ALTER_TABLE
 
 	switch alterSpec.Tp {
 	case ast.AlterTableRenameTable:
@@ -201,6 +277,7 @@ func alterTableStatement(stmt ast.AlterTableStmt, alterSpec ast.AlterTableSpec,
 		}
 		spec.Type = ddl_parser.AddColumn
 		spec.Columns = addColumns
+		spec.ColumnComments = columnComments(alterSpec.NewColumns)
 	case ast.AlterTableModifyColumn:
 		spec.Type = ddl_parser.ModifyColumn
 		cols := make([]string, 0, len(alterSpec.NewColumns))
@@ -208,6 +285,7 @@ func alterTableStatement(stmt ast.AlterTableStmt, alterSpec ast.AlterTableSpec,
 			cols = append(cols, col.Name.String())
 		}
 		spec.Columns = cols
+		spec.ColumnComments = columnComments(alterSpec.NewColumns)
 	case ast.AlterTableChangeColumn:
 		spec.Type = ddl_parser.ChangeColumn
 		cols := make([]string, 0, len(alterSpec.NewColumns))
@@ -216,6 +294,7 @@ func alterTableStatement(stmt ast.AlterTableStmt, alterSpec ast.AlterTableSpec,
 		}
 		spec.Columns = cols
 		spec.OldColumn = alterSpec.OldColumnName.String()
+		spec.ColumnComments = columnComments(alterSpec.NewColumns)
 	case ast.AlterTableDropColumn:
 		spec.Type = ddl_parser.DropColumn
 		spec.OldColumn = alterSpec.OldColumnName.String()
@@ -231,13 +310,20 @@ func alterTableStatement(stmt ast.AlterTableStmt, alterSpec ast.AlterTableSpec,
 		}
 		spec.Columns = cols
 	case ast.AlterTableAddConstraint:
-		spec.Type = ddl_parser.AddConstraint
 		cols := []string{}
 		for _, col := range alterSpec.Constraint.Keys {
-			cols = append(cols, col.Column.Name.String())
+			if col.Column != nil {
+				cols = append(cols, col.Column.Name.String())
+			}
 		}
 		spec.Type = ddl_parser.AddConstraint
 		spec.IndexName = alterSpec.Constraint.Name
+		if alterSpec.Constraint.Tp == ast.ConstraintPrimaryKey {
+			spec.IndexName = "PRIMARY"
+		} else if spec.IndexName == "" && isIndexConstraint(alterSpec.Constraint.Tp) && len(cols) > 0 {
+			// 未命名的 ADD INDEX/UNIQUE，MySQL 默认使用第一列的列名
+			spec.IndexName = cols[0]
+		}
 		spec.ConstraintColumn = cols
 		spec.IndexType = getIndexType(alterSpec.Constraint.Tp)
 	case ast.AlterTableDropIndex:
@@ -247,11 +333,28 @@ func alterTableStatement(stmt ast.AlterTableStmt, alterSpec ast.AlterTableSpec,
 		spec.Type = ddl_parser.RenameIndex
 		spec.NewConstraint = alterSpec.FromKey.String()
 		spec.OldConstraint = alterSpec.ToKey.String()
+	case ast.AlterTableOption:
+		spec.Type = ddl_parser.TableOption
+		spec.Comment = tableComment(alterSpec.Options)
+	case ast.AlterTableAddPartitions:
+		ddlType = schema_store.ADD_PARTITION
+		spec.Type = ddl_parser.AddPartition
+		for _, partition := range alterSpec.PartDefinitions {
+			spec.Partitions = append(spec.Partitions, partition.Name.String())
+		}
+	case ast.AlterTableDropPartition:
+		ddlType = schema_store.DROP_PARTITION
+		spec.Type = ddl_parser.DropPartition
+		spec.Partitions = partitionNames(alterSpec.PartitionNames)
+	case ast.AlterTableTruncatePartition:
+		ddlType = schema_store.TRUNCATE_PARTITION
+		spec.Type = ddl_parser.TruncatePartition
+		spec.Partitions = partitionNames(alterSpec.PartitionNames)
 	default:
 		log.Warnf("unknown alter table stmt.Text: %s", stmt.Text())
 	}
 
-	return ddl_parser.NewAlterTableStatement(newPingCapStatement(schema_store.ALTER_TABLE, &stmt, md), database, resetDb, table, spec)
+	return ddl_parser.NewAlterTableStatement(newPingCapStatement(ddlType, &stmt, md), database, resetDb, table, spec)
 }
 
 func dropTableStatement(stmt ast.DropTableStmt, astTable ast.TableName, ddl ddl_parser.DDL) ddl_parser.Statement {
@@ -268,7 +371,11 @@ func dropTableStatement(stmt ast.DropTableStmt, astTable ast.TableName, ddl ddl_
 		Database: database,
 		Table:    table,
 	}
-	return ddl_parser.NewTableStatement(newPingCapStatement(schema_store.DROP_TABLE, &stmt, md), database, resetDb, table)
+	ddlType := schema_store.DROP_TABLE
+	if stmt.IsView {
+		ddlType = schema_store.DROP_VIEW
+	}
+	return ddl_parser.NewTableStatement(newPingCapStatement(ddlType, &stmt, md), database, resetDb, table)
 }
 
 func renameTableStatement(stmt ast.RenameTableStmt, tableToTable ast.TableToTable, ddl ddl_parser.DDL) ddl_parser.Statement {
@@ -370,6 +477,8 @@ func (s *PingCapStatement) GenerateSQL() (any, error) {
 		return s.DropDatabaseStmt(*node)
 	case *ast.CreateTableStmt:
 		return s.CreateTableStmt(*node)
+	case *ast.CreateViewStmt:
+		return s.CreateViewStmt(*node)
 	case *ast.DropTableStmt:
 		return s.DropTableStmt(*node)
 	case *ast.RenameTableStmt:
@@ -429,6 +538,24 @@ func (s *PingCapStatement) CreateTableStmt(stmt ast.CreateTableStmt) (string, er
 		stmt.Table.Name = ast.NewCIStr(table)
 	}
 
+	// 类型、默认值按改名前的列名记录，需先于列重命名处理
+	if err := s.replaceColumnDefinitions(stmt.Cols); err != nil {
+		return "", err
+	}
+	if value, ok := s.changeEvent[ddl_parser.AddTableColumn]; ok {
+		columns, ok := value.([]ddl_parser.ColumnDefinition)
+		if !ok {
+			return "", fmt.Errorf("create_table statement change event AddTableColumn parameter:%v is not a []ddl_parser.ColumnDefinition", value)
+		}
+		for _, column := range columns {
+			col, err := newColumnDef(column)
+			if err != nil {
+				return "", err
+			}
+			stmt.Cols = append(stmt.Cols, col)
+		}
+	}
+
 	if value, ok := s.changeEvent[ddl_parser.ReplaceTableColumnMap]; ok {
 		columnMap, ok := value.(map[string]string)
 		if !ok {
@@ -516,12 +643,40 @@ func (s *PingCapStatement) CreateTableStmt(stmt ast.CreateTableStmt) (string, er
 		}
 
 	}
-	if len(stmt.Cols) == 0 {
+	if value, ok := s.changeEvent[ddl_parser.ReplaceReferTable]; ok {
+		referTable, ok := value.(ddl_parser.Table)
+		if !ok {
+			return "", fmt.Errorf("create_table statement change event ReplaceReferTable parameter:%v is not a ddl_parser.Table", value)
+		}
+		stmt.ReferTable.Schema = ast.NewCIStr(referTable.Database)
+		stmt.ReferTable.Name = ast.NewCIStr(referTable.Table)
+	}
+	// LIKE 及 SELECT 建表可以没有列定义
+	if len(stmt.Cols) == 0 && stmt.ReferTable == nil && stmt.Select == nil {
 		return "", fmt.Errorf("make create table sql fail, table columns is empty")
 	}
 	return restore(&stmt)
 }
 
+// CreateViewStmt 只改写视图名，SELECT 中引用的表不做改写
+func (s *PingCapStatement) CreateViewStmt(stmt ast.CreateViewStmt) (string, error) {
+	if value, ok := s.changeEvent[ddl_parser.ReplaceDatabase]; ok {
+		database, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("create_view statement change event ReplaceDatabase parameter:%v is not a string", value)
+		}
+		stmt.ViewName.Schema = ast.NewCIStr(database)
+	}
+	if value, ok := s.changeEvent[ddl_parser.ReplaceTable]; ok {
+		table, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("create_view statement change event ReplaceTable parameter:%v is not a string", value)
+		}
+		stmt.ViewName.Name = ast.NewCIStr(table)
+	}
+	return restore(&stmt)
+}
+
 func (s *PingCapStatement) DropTableStmt(stmt ast.DropTableStmt) (string, error) {
 	if len(stmt.Tables) != 1 {
 		return "", fmt.Errorf("drop_table ddl must be a single SQL statement")
@@ -700,6 +855,9 @@ func (s *PingCapStatement) AlterTableStmt(stmt ast.AlterTableStmt) (string, erro
 		}
 		stmt.Table.Name = ast.NewCIStr(table)
 	}
+	if err := s.replaceColumnDefinitions(specs.NewColumns); err != nil {
+		return "", err
+	}
 	if value, ok := s.changeEvent[ddl_parser.ReplaceTableColumnMap]; ok {
 		colMap, ok := value.(map[string]string)
 		if !ok {
@@ -777,6 +935,71 @@ func (s *PingCapStatement) AlterTableStmt(stmt ast.AlterTableStmt) (string, erro
 	return restore(&stmt)
 }
 
+// replaceColumnDefinitions 处理 ReplaceColumnType、ReplaceColumnDefault
+func (s *PingCapStatement) replaceColumnDefinitions(cols []*ast.ColumnDef) error {
+	if value, ok := s.changeEvent[ddl_parser.ReplaceColumnType]; ok {
+		typeMap, ok := value.(map[string]string)
+		if !ok {
+			return fmt.Errorf("%s statement change event ReplaceColumnType parameter:%v is not a map[string]string", s.ddlType, value)
+		}
+		for _, col := range cols {
+			tp, ok := typeMap[col.Name.Name.String()]
+			if !ok {
+				continue
+			}
+			def, err := newColumnDef(ddl_parser.ColumnDefinition{Name: col.Name.Name.String(), Type: tp})
+			if err != nil {
+				return err
+			}
+			col.Tp = def.Tp
+		}
+	}
+	if value, ok := s.changeEvent[ddl_parser.ReplaceColumnDefault]; ok {
+		defaultMap, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s statement change event ReplaceColumnDefault parameter:%v is not a map[string]any", s.ddlType, value)
+		}
+		for _, col := range cols {
+			defaultValue, ok := defaultMap[col.Name.Name.String()]
+			if !ok {
+				continue
+			}
+			options := make([]*ast.ColumnOption, 0, len(col.Options)+1)
+			for _, option := range col.Options {
+				if option.Tp != ast.ColumnOptionDefaultValue {
+					options = append(options, option)
+				}
+			}
+			col.Options = append(options, &ast.ColumnOption{Tp: ast.ColumnOptionDefaultValue, Expr: valueExpr(defaultValue)})
+		}
+	}
+	return nil
+}
+
+// newColumnDef 解析列定义，类型文本交由 parser 校验
+func newColumnDef(column ddl_parser.ColumnDefinition) (*ast.ColumnDef, error) {
+	stmt, err := parser.New().ParseOneStmt(fmt.Sprintf("CREATE TABLE t (%s %s)", sql_tool.ColumnName(column.Name), column.Type), "", "")
+	if err != nil {
+		return nil, fmt.Errorf("column %s type %s: %v", column.Name, column.Type, err)
+	}
+	create, ok := stmt.(*ast.CreateTableStmt)
+	if !ok || len(create.Cols) != 1 {
+		return nil, fmt.Errorf("column %s type %s is invalid", column.Name, column.Type)
+	}
+	col := create.Cols[0]
+	if column.Default != nil {
+		col.Options = append(col.Options, &ast.ColumnOption{Tp: ast.ColumnOptionDefaultValue, Expr: valueExpr(column.Default)})
+	}
+	return col, nil
+}
+
+func valueExpr(value any) ast.ExprNode {
+	if t, ok := value.(time.Time); ok {
+		value = t.Format(time.DateTime)
+	}
+	return ast.NewValueExpr(value, "", "")
+}
+
 func (s *PingCapStatement) generateSQL() (string, error) {
 	writer := &strings.Builder{}
 	ctx := format.NewRestoreCtx(format.RestoreStringSingleQuotes|format.RestoreKeyWordLowercase|format.RestoreNameBackQuotes, writer)
@@ -798,6 +1021,67 @@ func restore(node ast.Node) (string, error) {
 	return writer.String(), nil
 }
 
+func isIndexConstraint(tp ast.ConstraintType) bool {
+	switch tp {
+	case ast.ConstraintKey, ast.ConstraintIndex, ast.ConstraintUniq, ast.ConstraintUniqKey, ast.ConstraintUniqIndex,
+		ast.ConstraintFulltext, ast.ConstraintVector, ast.ConstraintColumnar:
+		return true
+	default:
+		return false
+	}
+}
+
+func defaultIndexName(column string, exist map[string][]string) string {
+	if _, ok := exist[column]; !ok && !strings.EqualFold(column, "PRIMARY") {
+		return column
+	}
+	for i := 2; ; i++ {
+		name := fmt.Sprintf("%s_%d", column, i)
+		if _, ok := exist[name]; !ok {
+			return name
+		}
+	}
+}
+
+func tableComment(options []*ast.TableOption) string {
+	for _, option := range options {
+		if option.Tp == ast.TableOptionComment {
+			return option.StrValue
+		}
+	}
+	return ""
+}
+
+func columnComment(col *ast.ColumnDef) (string, bool) {
+	for _, option := range col.Options {
+		if option.Tp != ast.ColumnOptionComment {
+			continue
+		}
+		if value, ok := option.Expr.(ast.ValueExpr); ok {
+			return value.GetString(), true
+		}
+	}
+	return "", false
+}
+
+func columnComments(cols []*ast.ColumnDef) map[string]string {
+	comments := make(map[string]string)
+	for _, col := range cols {
+		if comment, ok := columnComment(col); ok {
+			comments[col.Name.String()] = comment
+		}
+	}
+	return comments
+}
+
+func partitionNames(names []ast.CIStr) []string {
+	partitions := make([]string, 0, len(names))
+	for _, name := range names {
+		partitions = append(partitions, name.String())
+	}
+	return partitions
+}
+
 func getIndexType(tp ast.ConstraintType) ddl_parser.IndexType {
 	switch tp {
 	case ast.ConstraintPrimaryKey:
@@ -0,0 +1,178 @@
+package ddl_parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xuenqlve/common/ddl_parser"
+	"github.com/xuenqlve/common/schema_store"
+)
+
+func TestPingCapLoaderParse(t *testing.T) {
+	loader := NewPingCapLoader()
+	stmts, err := loader.Parse(ddl_parser.DDL{Schema: "db", SQL: `CREATE TABLE t1 LIKE t0;
+CREATE TABLE t2 AS SELECT * FROM t0;
+CREATE VIEW v1 AS SELECT id FROM t0;
+DROP VIEW v1;
+ALTER TABLE t1 ADD COLUMN c1 int COMMENT 'c1 comment', ADD UNIQUE (c1), ALGORITHM=INPLACE, LOCK=NONE;
+ALTER TABLE t1 COMMENT = 't1 comment';
+ALTER TABLE t3 ADD PARTITION (PARTITION p3 VALUES LESS THAN (300));
+ALTER TABLE t3 DROP PARTITION p1, p2;
+ALTER TABLE t3 TRUNCATE PARTITION p0`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []schema_store.DDL{
+		schema_store.CREATE_TABLE_LIKE,
+		schema_store.CREATE_TABLE_SELECT,
+		schema_store.CREATE_VIEW,
+		schema_store.DROP_VIEW,
+		schema_store.ALTER_TABLE,
+		schema_store.ALTER_TABLE,
+		schema_store.ALTER_TABLE,
+		schema_store.ADD_PARTITION,
+		schema_store.DROP_PARTITION,
+		schema_store.TRUNCATE_PARTITION,
+	}
+	if len(stmts) != len(expected) {
+		t.Fatalf("statement count: %d", len(stmts))
+	}
+	for i, stmt := range stmts {
+		if stmt.DDLType() != expected[i] {
+			t.Fatalf("statement %d type: %s, expected %s", i, stmt.DDLType(), expected[i])
+		}
+	}
+	// 按原有类型配置的过滤规则仍然匹配细分后的类型
+	alterFilter := ddl_parser.AcceptDDLType([]string{schema_store.ALTER_TABLE.String()})
+	dropFilter := ddl_parser.AcceptDDLType([]string{schema_store.DROP_TABLE.String()})
+	if !alterFilter.Apply(stmts[7]) || !alterFilter.Apply(stmts[9]) || !dropFilter.Apply(stmts[3]) || dropFilter.Apply(stmts[7]) {
+		t.Fatal("ddl type filter should match the base type")
+	}
+	if !ddl_parser.AcceptDDLType([]string{schema_store.DROP_PARTITION.String()}).Apply(stmts[8]) {
+		t.Fatal("ddl type filter should match the type")
+	}
+
+	like := stmts[0].(*ddl_parser.CreateTableLikeStatement)
+	if database, table := like.ReferTable(); database != "db" || table != "t0" {
+		t.Fatalf("refer table: %s.%s", database, table)
+	}
+	ddl_parser.Modify(like, ddl_parser.WithTableRename("db", "t0", "t0_new"))
+	sql, err := like.GenerateSQL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sql.(string), "`db`.`t0_new`") {
+		t.Fatalf("create table like sql: %s", sql)
+	}
+
+	addColumn := stmts[4].(*ddl_parser.AlterTableStatement).AlterSpec()
+	if addColumn.Type != ddl_parser.AddColumn || addColumn.ColumnComments["c1"] != "c1 comment" {
+		t.Fatalf("add column spec: %+v", addColumn)
+	}
+	addIndex := stmts[5].(*ddl_parser.AlterTableStatement).AlterSpec()
+	if addIndex.Type != ddl_parser.AddConstraint || addIndex.IndexName != "c1" || addIndex.IndexType != ddl_parser.IndexTypeUnique {
+		t.Fatalf("add unique spec: %+v", addIndex)
+	}
+	if comment := stmts[6].(*ddl_parser.AlterTableStatement).AlterSpec().Comment; comment != "t1 comment" {
+		t.Fatalf("table comment: %s", comment)
+	}
+	if partitions := stmts[8].(*ddl_parser.AlterTableStatement).AlterSpec().Partitions; len(partitions) != 2 || partitions[1] != "p2" {
+		t.Fatalf("drop partitions: %v", partitions)
+	}
+	for _, stmt := range stmts {
+		if _, err = stmt.GenerateSQL(); err != nil {
+			t.Fatalf("%s generate sql: %v", stmt.DDLType(), err)
+		}
+	}
+}
+
+func TestPingCapLoaderCreateTableComments(t *testing.T) {
+	loader := NewPingCapLoader()
+	stmts, err := loader.Parse(ddl_parser.DDL{Schema: "db", SQL: "CREATE TABLE t (id int PRIMARY KEY, name varchar(32) COMMENT 'user name', KEY (name), KEY (name, id)) COMMENT 'users'"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt := stmts[0].(*ddl_parser.CreateTableColumnStatement)
+	if stmt.Comment() != "users" || stmt.ColumnComments()["name"] != "user name" {
+		t.Fatalf("comments: %s %v", stmt.Comment(), stmt.ColumnComments())
+	}
+	indexes := stmt.Constraints()
+	if _, ok := indexes["name"]; !ok {
+		t.Fatalf("indexes: %v", indexes)
+	}
+	if _, ok := indexes["name_2"]; !ok {
+		t.Fatalf("indexes: %v", indexes)
+	}
+}
+
+func TestModifyColumnDefinitions(t *testing.T) {
+	opts := []ddl_parser.ModifyOption{
+		ddl_parser.WithColumnType("db", "t", "id", "bigint"),
+		ddl_parser.WithColumnDefault("db", "t", "name", "unknown"),
+		ddl_parser.WithAddColumn("db", "t", ddl_parser.ColumnDefinition{Name: "_source", Type: "varchar(64)"}, ddl_parser.SourceTableValue()),
+		ddl_parser.WithColumnRename("db", "t", "id", "uid"),
+	}
+	loader := NewPingCapLoader()
+	stmts, err := loader.Parse(ddl_parser.DDL{Schema: "db", SQL: "CREATE TABLE t (id int PRIMARY KEY, name varchar(32)); ALTER TABLE t MODIFY COLUMN id int NOT NULL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"create table if not exists `db`.`t` (`uid` bigint primary key,`name` varchar(32) default 'unknown',`_source` varchar(64))",
+		"alter table `db`.`t` modify column `uid` bigint not null",
+	}
+	for i, stmt := range stmts {
+		ddl_parser.Modify(stmt, opts...)
+		sql, err := stmt.GenerateSQL()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sql != expected[i] {
+			t.Fatalf("sql: %s", sql)
+		}
+	}
+
+	data := map[string]any{"id": 1}
+	old := map[string]any{"id": 1}
+	ddl_parser.ModifyRow(ddl_parser.RowMeta{Database: "db", Table: "t"}, data, old, opts...)
+	if data["uid"] != int64(1) || data["name"] != "unknown" || data["_source"] != "t" || len(data) != 3 {
+		t.Fatalf("data: %v", data)
+	}
+	if old["uid"] != int64(1) || len(old) != 1 {
+		t.Fatalf("old: %v", old)
+	}
+}
+
+// TestRouterDDL 路由规则本身的测试见 ddl_parser/router_test.go
+func TestRouterDDL(t *testing.T) {
+	router, err := ddl_parser.NewRouter(ddl_parser.RouterConfig{
+		Tables:    []ddl_parser.RouteRule{{Regex: `shard_(\d+)\.orders_.*`, Target: "all.orders", Merge: true, Columns: map[string]string{"order_no": "no"}}},
+		Databases: []ddl_parser.RouteRule{{Pattern: "shard_*", Target: "db_$1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loader := NewPingCapLoader()
+	stmts, err := loader.Parse(ddl_parser.DDL{Schema: "shard_1", SQL: "ALTER TABLE orders_1 ADD COLUMN order_no int; RENAME TABLE users TO users_old; CREATE DATABASE shard_2; ALTER TABLE legacy ADD COLUMN order_no int"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"alter table `all`.`orders` add column `no` int",
+		"rename table `db_1`.`users` to `db_1`.`users_old`",
+		"create database if not exists `db_2`",
+		// 与行数据一样按表重命名后的名称匹配路由
+		"alter table `all`.`orders` add column `no` int",
+	}
+	for i, stmt := range stmts {
+		ddl_parser.Modify(stmt, ddl_parser.WithTableRename("shard_1", "legacy", "orders_legacy"), router)
+		sql, err := stmt.GenerateSQL()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sql != expected[i] {
+			t.Fatalf("sql: %s", sql)
+		}
+	}
+}
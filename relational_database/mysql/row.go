@@ -1,6 +1,10 @@
 package mysql
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/xuenqlve/common/ddl_parser"
+)
 
 type RowData struct {
 	Key       string         `json:"key" c:"key"`
@@ -27,3 +31,9 @@ func (d *RowData) IsColumnSetDefault(columnName string) bool {
 func (d *RowData) SetColumnDefault(column string) {
 	d.Data[column] = defaultStruct{}
 }
+
+// Modify 将 ddl_parser.ModifyOption 应用到行数据，GuideKeys 与变更前镜像一样只做列的重命名和删除
+func (d *RowData) Modify(meta ddl_parser.RowMeta, opts ...ddl_parser.ModifyOption) {
+	ddl_parser.ModifyRow(meta, d.Data, d.Old, opts...)
+	ddl_parser.ModifyRow(meta, nil, d.GuideKeys, opts...)
+}
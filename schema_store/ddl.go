@@ -14,7 +14,18 @@ var (
 	TRUNCATE_TABLE  DDL = "TRUNCATE TABLE"
 	CREATE_INDEX    DDL = "CREATE INDEX"
 	DROP_INDEX      DDL = "DROP INDEX"
-	UNKNOWN         DDL = "UNKNOWN"
+	// CREATE_TABLE_LIKE CREATE TABLE ... LIKE
+	CREATE_TABLE_LIKE DDL = "CREATE TABLE LIKE"
+	// CREATE_TABLE_SELECT CREATE TABLE ... SELECT
+	CREATE_TABLE_SELECT DDL = "CREATE TABLE SELECT"
+	CREATE_VIEW         DDL = "CREATE VIEW"
+	// DROP_VIEW 原先归为 DROP TABLE
+	DROP_VIEW DDL = "DROP VIEW"
+	// ADD_PARTITION DROP_PARTITION TRUNCATE_PARTITION 原先归为 ALTER TABLE
+	ADD_PARTITION      DDL = "ADD PARTITION"
+	DROP_PARTITION     DDL = "DROP PARTITION"
+	TRUNCATE_PARTITION DDL = "TRUNCATE PARTITION"
+	UNKNOWN            DDL = "UNKNOWN"
 
 	//mongo
 	Create_Indexes DDL = "createIndexes"
@@ -23,7 +34,9 @@ var (
 	Drop_Database  DDL = "dropDatabase"
 	Drop_Indexes   DDL = "dropIndexes"
 	Rename         DDL = "renameCollection"
-	NOOP           DDL = "NOOP"
+	// Modify collMod，如修改 validator、隐藏索引
+	Modify DDL = "collMod"
+	NOOP   DDL = "NOOP"
 )
 
 type DDL string
@@ -32,26 +45,52 @@ func (d DDL) String() string {
 	return string(d)
 }
 
-var allDDLOperation = []DDL{CREATE_DATABASE, DROP_DATABASE, CREATE_TABLE, DROP_TABLE, RENAME_TABLE, ALTER_TABLE, TRUNCATE_TABLE, CREATE_INDEX, DROP_INDEX}
+// baseDDL 细分出的类型及细分前所属的类型
+var baseDDL = map[DDL]DDL{
+	DROP_VIEW:          DROP_TABLE,
+	ADD_PARTITION:      ALTER_TABLE,
+	DROP_PARTITION:     ALTER_TABLE,
+	TRUNCATE_PARTITION: ALTER_TABLE,
+}
+
+// Base 返回细分前的类型，没有细分时返回自身。
+// 按类型过滤时同时匹配 Base，配置了 ALTER TABLE 的过滤规则仍然接收分区操作
+func (d DDL) Base() DDL {
+	if base, ok := baseDDL[d]; ok {
+		return base
+	}
+	return d
+}
+
+var allDDLOperation = []DDL{CREATE_DATABASE, DROP_DATABASE, CREATE_TABLE, DROP_TABLE, RENAME_TABLE, ALTER_TABLE, TRUNCATE_TABLE, CREATE_INDEX, DROP_INDEX,
+	CREATE_TABLE_LIKE, CREATE_TABLE_SELECT, CREATE_VIEW, DROP_VIEW, ADD_PARTITION, DROP_PARTITION, TRUNCATE_PARTITION}
 
 func GetAllDDLOperation() []DDL {
 	return allDDLOperation
 }
 
 var DDLMap = map[string]DDL{
-	CREATE_DATABASE.String(): CREATE_DATABASE,
-	DROP_DATABASE.String():   DROP_DATABASE,
-	CREATE_TABLE.String():    CREATE_TABLE,
-	ALTER_TABLE.String():     ALTER_TABLE,
-	DROP_TABLE.String():      DROP_TABLE,
-	RENAME_TABLE.String():    RENAME_TABLE,
-	TRUNCATE_TABLE.String():  TRUNCATE_TABLE,
-	CREATE_INDEX.String():    CREATE_INDEX,
-	DROP_INDEX.String():      DROP_INDEX,
-	Create_Indexes.String():  Create_Indexes,
-	Create_Table.String():    Create_Table,
-	Drop.String():            Drop,
-	Drop_Database.String():   Drop_Database,
-	Drop_Indexes.String():    Drop_Indexes,
-	Rename.String():          Rename,
+	CREATE_DATABASE.String():     CREATE_DATABASE,
+	DROP_DATABASE.String():       DROP_DATABASE,
+	CREATE_TABLE.String():        CREATE_TABLE,
+	ALTER_TABLE.String():         ALTER_TABLE,
+	DROP_TABLE.String():          DROP_TABLE,
+	RENAME_TABLE.String():        RENAME_TABLE,
+	TRUNCATE_TABLE.String():      TRUNCATE_TABLE,
+	CREATE_INDEX.String():        CREATE_INDEX,
+	DROP_INDEX.String():          DROP_INDEX,
+	CREATE_TABLE_LIKE.String():   CREATE_TABLE_LIKE,
+	CREATE_TABLE_SELECT.String(): CREATE_TABLE_SELECT,
+	CREATE_VIEW.String():         CREATE_VIEW,
+	DROP_VIEW.String():           DROP_VIEW,
+	ADD_PARTITION.String():       ADD_PARTITION,
+	DROP_PARTITION.String():      DROP_PARTITION,
+	TRUNCATE_PARTITION.String():  TRUNCATE_PARTITION,
+	Create_Indexes.String():      Create_Indexes,
+	Create_Table.String():        Create_Table,
+	Drop.String():                Drop,
+	Drop_Database.String():       Drop_Database,
+	Drop_Indexes.String():        Drop_Indexes,
+	Rename.String():              Rename,
+	Modify.String():              Modify,
 }
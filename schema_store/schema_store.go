@@ -25,14 +25,15 @@ type LoadSchemaTool interface {
 
 func NewBaseSchemaStore(load LoadSchemaTool) SchemaStore {
 	return &BaseSchemaStore{
-		schemas:        map[SchemaKey]any{},
+		schemas:        map[string]any{},
 		LoadSchemaTool: load,
 	}
 }
 
 type BaseSchemaStore struct {
 	sync.RWMutex
-	schemas map[SchemaKey]any
+	// 按 UniqueID 缓存，SchemaKey 通常是指针，不能直接作为 map key
+	schemas map[string]any
 	LoadSchemaTool
 }
 
@@ -52,7 +53,7 @@ func (s *BaseSchemaStore) GetSchema(key SchemaKey) (any, error) {
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	s.schemas[key] = schema
+	s.schemas[key.UniqueID()] = schema
 	return schema, nil
 }
 
@@ -61,7 +62,7 @@ func (s *BaseSchemaStore) getFromCache(key SchemaKey, lock bool) (any, bool) {
 		s.RLock()
 		defer s.RUnlock()
 	}
-	cachedSchema, ok := s.schemas[key]
+	cachedSchema, ok := s.schemas[key.UniqueID()]
 	if ok {
 		return cachedSchema, true
 	}
@@ -71,20 +72,20 @@ func (s *BaseSchemaStore) getFromCache(key SchemaKey, lock bool) (any, bool) {
 func (s *BaseSchemaStore) InvalidateSchemaCache(key SchemaKey) {
 	s.Lock()
 	defer s.Unlock()
-	delete(s.schemas, key)
+	delete(s.schemas, key.UniqueID())
 }
 
 func (s *BaseSchemaStore) InvalidateCache() {
 	s.Lock()
 	defer s.Unlock()
 	// make a new map here
-	s.schemas = make(map[SchemaKey]any)
+	s.schemas = make(map[string]any)
 }
 
 func (s *BaseSchemaStore) IsInCache(key SchemaKey) bool {
 	s.RLock()
 	defer s.RUnlock()
-	if _, ok := s.schemas[key]; ok {
+	if _, ok := s.schemas[key.UniqueID()]; ok {
 		return true
 	} else {
 		return false